@@ -0,0 +1,564 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+const (
+	alarmsFile      = "alarms.json"
+	alarmRunnerFile = "alarm-runner.json"
+)
+
+var (
+	alarmCmdFlagPlay       string
+	alarmCmdFlagVolumeRamp string
+	alarmCmdFlagOver       time.Duration
+	alarmCmdFlagGrace      time.Duration
+	alarmCmdFlagDetach     bool
+)
+
+var alarmCmd = &cobra.Command{
+	Use:   "alarm",
+	Short: "Schedule playback at fixed times",
+}
+
+var alarmAddCmd = &cobra.Command{
+	Use:   "add [schedule]",
+	Short: "Add an alarm",
+	Long:  `Add an alarm that starts playback at a time of day such as "07:30", optionally followed by the days it fires on, for example "07:30 mon-fri", "09:00 sat,sun", "06:45 weekdays" or "22:00 daily". Alarms are fired by "spotctl alarm run".`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  alarmAdd,
+}
+
+var alarmListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show the list of alarms",
+	RunE:  alarmList,
+}
+
+var alarmRemoveCmd = &cobra.Command{
+	Use:   "remove [id]",
+	Short: "Remove an alarm",
+	Args:  cobra.ExactArgs(1),
+	RunE:  alarmRemove,
+}
+
+var alarmRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the process that fires alarms",
+	Long:  `Run the process that fires alarms. Alarms missed while the computer was suspended or the runner was stopped are still fired if they are no older than --grace.`,
+	RunE:  alarmRun,
+}
+
+// alarm is a persisted playback schedule.
+type alarm struct {
+	ID         int           `json:"id"`
+	Schedule   string        `json:"schedule"`
+	Play       string        `json:"play"`
+	Device     string        `json:"device,omitempty"`
+	VolumeFrom int           `json:"volume_from"`
+	VolumeTo   int           `json:"volume_to"`
+	RampOver   time.Duration `json:"ramp_over,omitempty"`
+}
+
+func (a alarm) hasVolume() bool {
+	return a.VolumeFrom >= 0 && a.VolumeTo >= 0
+}
+
+type alarmStore struct {
+	NextID int     `json:"next_id"`
+	Alarms []alarm `json:"alarms"`
+}
+
+// alarmSchedule is a time of day together with the weekdays it applies to.
+type alarmSchedule struct {
+	hour   int
+	minute int
+	days   [7]bool
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseAlarmSchedule parses a schedule such as "07:30 mon-fri". A schedule
+// without days fires every day.
+func parseAlarmSchedule(s string) (alarmSchedule, error) {
+	var sched alarmSchedule
+
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 || len(fields) > 2 {
+		return sched, fmt.Errorf("invalid schedule %q, expected a time of day optionally followed by days", s)
+	}
+
+	t, err := time.Parse("15:04", fields[0])
+	if err != nil {
+		return sched, fmt.Errorf("invalid time of day %q, expected HH:MM", fields[0])
+	}
+	sched.hour, sched.minute = t.Hour(), t.Minute()
+
+	days := "daily"
+	if len(fields) == 2 {
+		days = fields[1]
+	}
+
+	switch days {
+	case "daily", "everyday":
+		days = "sun-sat"
+	case "weekdays":
+		days = "mon-fri"
+	case "weekends":
+		days = "sat,sun"
+	}
+
+	for _, part := range strings.Split(days, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := parseWeekday(bounds[0])
+		if err != nil {
+			return sched, err
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = parseWeekday(bounds[1]); err != nil {
+				return sched, err
+			}
+		}
+
+		// ranges wrap around the end of the week, e.g. fri-mon
+		for d := from; ; d = (d + 1) % 7 {
+			sched.days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+
+	return sched, nil
+}
+
+func parseWeekday(s string) (int, error) {
+	for i, name := range weekdayNames {
+		// accept abbreviations such as "tue" and "tues" as well as full names
+		if strings.HasPrefix(s, name) && strings.HasPrefix(strings.ToLower(time.Weekday(i).String()), s) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid day %q, expected one of %s", s, strings.Join(weekdayNames, ", "))
+}
+
+func (s alarmSchedule) String() string {
+	var days []string
+	for i, on := range s.days {
+		if on {
+			days = append(days, weekdayNames[i])
+		}
+	}
+
+	return fmt.Sprintf("%02d:%02d %s", s.hour, s.minute, strings.Join(days, ","))
+}
+
+// next returns the first time strictly after t at which the schedule fires,
+// in t's location. Times that don't exist because of a DST change are moved
+// past it, e.g. 02:30 becomes 03:30 when clocks spring forward, and times
+// that happen twice when clocks fall back fire the first time only.
+func (s alarmSchedule) next(t time.Time) time.Time {
+	for i := 0; i <= 7; i++ {
+		// use noon to find the weekday, which is never skipped by DST
+		if day := time.Date(t.Year(), t.Month(), t.Day()+i, 12, 0, 0, 0, t.Location()); !s.days[day.Weekday()] {
+			continue
+		}
+
+		at := time.Date(t.Year(), t.Month(), t.Day()+i, s.hour, s.minute, 0, 0, t.Location())
+		if at.Hour() != s.hour || at.Minute() != s.minute {
+			// time.Date normalizes skipped times with the offset from after
+			// the change, which lands before it
+			_, before := at.Zone()
+			_, after := at.Add(12 * time.Hour).Zone()
+			at = at.Add(time.Duration(after-before) * time.Second)
+		}
+		if at.After(t) {
+			return at
+		}
+	}
+
+	return time.Time{}
+}
+
+// dueAlarms returns the alarms that are scheduled in (last, now]. Alarms
+// whose latest scheduled time in that window is no older than grace are
+// due; the others were missed, e.g. while the computer was suspended.
+func dueAlarms(alarms []alarm, last, now time.Time, grace time.Duration) (due, missed []alarm) {
+	for _, a := range alarms {
+		sched, err := parseAlarmSchedule(a.Schedule)
+		if err != nil {
+			continue
+		}
+
+		at := sched.next(last)
+		if at.IsZero() || at.After(now) {
+			continue
+		}
+		for n := sched.next(at); !n.IsZero() && !n.After(now); n = sched.next(n) {
+			at = n
+		}
+
+		if now.Sub(at) <= grace {
+			due = append(due, a)
+		} else {
+			missed = append(missed, a)
+		}
+	}
+
+	return due, missed
+}
+
+// alarmRunner fires alarms as they become due.
+type alarmRunner struct {
+	clock clock
+	grace time.Duration
+	// poll bounds the time between checks. Monotonic timers don't advance
+	// while the computer is suspended, so the wall clock is re-read
+	// regularly to notice the time that passed.
+	poll   time.Duration
+	alarms func() ([]alarm, error)
+	fire   func(a alarm) error
+	// checked is called with the time up to which alarms have been handled.
+	checked func(t time.Time) error
+}
+
+func (r *alarmRunner) run(last time.Time, cancel <-chan struct{}) error {
+	for {
+		// strip the monotonic reading so that comparisons use the wall clock
+		now := r.clock.Now().Round(0)
+
+		alarms, err := r.alarms()
+		if err != nil {
+			return err
+		}
+
+		due, missed := dueAlarms(alarms, last, now, r.grace)
+		for _, a := range missed {
+			fmt.Printf("%s Skipped alarm %d (%s) missed by more than %s.\n", now.Format(time.Stamp), a.ID, a.Schedule, r.grace)
+		}
+		for _, a := range due {
+			fmt.Printf("%s Firing alarm %d (%s).\n", now.Format(time.Stamp), a.ID, a.Schedule)
+			if err := r.fire(a); err != nil {
+				fmt.Printf("%s Alarm %d failed: %s\n", now.Format(time.Stamp), a.ID, err)
+			}
+		}
+
+		last = now
+		if err := r.checked(last); err != nil {
+			return err
+		}
+
+		wake := now.Add(r.poll)
+		for _, a := range alarms {
+			if sched, err := parseAlarmSchedule(a.Schedule); err == nil {
+				if at := sched.next(now); !at.IsZero() && at.Before(wake) {
+					wake = at
+				}
+			}
+		}
+
+		if !sleepUntil(r.clock, wake, cancel) {
+			return nil
+		}
+	}
+}
+
+// rampVolume changes the volume linearly from one level to another over a
+// duration, one percent at a time.
+func rampVolume(c clock, p playbackController, opt *spotify.PlayOptions, from, to int, over time.Duration, cancel <-chan struct{}) error {
+	start := c.Now()
+	steps := to - from
+	if steps < 0 {
+		steps = -steps
+	}
+	if steps == 0 || over <= 0 {
+		return p.VolumeOpt(to, opt)
+	}
+
+	for i := 1; i <= steps; i++ {
+		if !sleepUntil(c, start.Add(over*time.Duration(i)/time.Duration(steps)), cancel) {
+			return nil
+		}
+
+		vol := from + i
+		if to < from {
+			vol = from - i
+		}
+		if err := p.VolumeOpt(vol, opt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func alarmAdd(cmd *cobra.Command, args []string) error {
+	sched, err := parseAlarmSchedule(args[0])
+	if err != nil {
+		return err
+	}
+
+	if alarmCmdFlagPlay == "" {
+		return errors.New("--play is required")
+	}
+	ref, err := spotifyuri.Parse(alarmCmdFlagPlay)
+	if err != nil {
+		return err
+	}
+
+	a := alarm{
+		Schedule:   sched.String(),
+		Play:       ref.URI(),
+		Device:     deviceNameFlag,
+		VolumeFrom: -1,
+		VolumeTo:   -1,
+		RampOver:   alarmCmdFlagOver,
+	}
+
+	if alarmCmdFlagVolumeRamp != "" {
+		a.VolumeFrom, a.VolumeTo, err = parseVolumeRamp(alarmCmdFlagVolumeRamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	list, err := readAlarms()
+	if err != nil {
+		return err
+	}
+
+	list.NextID++
+	a.ID = list.NextID
+	list.Alarms = append(list.Alarms, a)
+
+	if err := writeAlarms(list); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added alarm %d, next firing at %s.\n", a.ID, sched.next(time.Now()).Format("Mon Jan 2 15:04"))
+
+	return nil
+}
+
+// parseVolumeRamp parses a volume such as "40" or a ramp such as "0-40".
+func parseVolumeRamp(s string) (int, int, error) {
+	bounds := strings.SplitN(s, "-", 2)
+
+	var vols []int
+	for _, b := range bounds {
+		v, err := strconv.Atoi(strings.TrimSpace(b))
+		if err != nil || v < 0 || v > 100 {
+			return 0, 0, fmt.Errorf("invalid volume %q, expected a percentage between 0 and 100", b)
+		}
+		vols = append(vols, v)
+	}
+
+	if len(vols) == 1 {
+		return vols[0], vols[0], nil
+	}
+
+	return vols[0], vols[1], nil
+}
+
+func alarmList(cmd *cobra.Command, args []string) error {
+	list, err := readAlarms()
+	if err != nil {
+		return err
+	}
+
+	if len(list.Alarms) == 0 {
+		fmt.Println("No alarms.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSCHEDULE\tNEXT\tPLAY\tDEVICE\tVOLUME")
+	for _, a := range list.Alarms {
+		next := ""
+		if sched, err := parseAlarmSchedule(a.Schedule); err == nil {
+			next = sched.next(time.Now()).Format("Mon Jan 2 15:04")
+		}
+
+		volume := ""
+		if a.hasVolume() {
+			volume = fmt.Sprintf("%d%%", a.VolumeTo)
+			if a.VolumeFrom != a.VolumeTo {
+				volume = fmt.Sprintf("%d-%d%% over %s", a.VolumeFrom, a.VolumeTo, a.RampOver)
+			}
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", a.ID, a.Schedule, next, a.Play, a.Device, volume)
+	}
+
+	return w.Flush()
+}
+
+func alarmRemove(cmd *cobra.Command, args []string) error {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid alarm id %q", args[0])
+	}
+
+	list, err := readAlarms()
+	if err != nil {
+		return err
+	}
+
+	for i, a := range list.Alarms {
+		if a.ID == id {
+			list.Alarms = append(list.Alarms[:i], list.Alarms[i+1:]...)
+			return writeAlarms(list)
+		}
+	}
+
+	return fmt.Errorf("alarm %d not found", id)
+}
+
+// alarmRunnerState is persisted by the runner so that alarms due while it
+// wasn't running can be caught up on and so that only one runs at a time.
+type alarmRunnerState struct {
+	PID     int       `json:"pid,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+func alarmRun(cmd *cobra.Command, args []string) error {
+	path, err := dataFilePath(alarmRunnerFile)
+	if err != nil {
+		return err
+	}
+
+	var runnerState alarmRunnerState
+	if err := readJSONFile(path, &runnerState); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if runnerState.PID != 0 && runnerState.PID != os.Getpid() && processAlive(runnerState.PID) {
+		return fmt.Errorf("the alarm runner is already running (pid %d)", runnerState.PID)
+	}
+
+	if alarmCmdFlagDetach {
+		pid, err := startDetached("alarm", "run", "--grace", alarmCmdFlagGrace.String())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Running alarms in the background (pid %d).\n", pid)
+		return nil
+	}
+
+	last := time.Now()
+	if !runnerState.Checked.IsZero() && runnerState.Checked.Before(last) {
+		// catch up on alarms that were due while the runner wasn't running
+		last = runnerState.Checked
+	}
+
+	runnerState.PID = os.Getpid()
+	if err := writeJSONFile(path, runnerState); err != nil {
+		return err
+	}
+	defer func() {
+		runnerState.PID = 0
+		writeJSONFile(path, runnerState)
+	}()
+
+	cancel := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		<-sig
+		close(cancel)
+	}()
+
+	runner := &alarmRunner{
+		clock: realClock{},
+		grace: alarmCmdFlagGrace,
+		poll:  time.Minute,
+		alarms: func() ([]alarm, error) {
+			list, err := readAlarms()
+			return list.Alarms, err
+		},
+		fire: func(a alarm) error {
+			return fireAlarm(a, cancel)
+		},
+		checked: func(t time.Time) error {
+			runnerState.Checked = t
+			return writeJSONFile(path, runnerState)
+		},
+	}
+
+	fmt.Println("Waiting for alarms. Press Ctrl-C to stop.")
+
+	return runner.run(last, cancel)
+}
+
+// fireAlarm starts the playback of an alarm. The volume ramp runs in the
+// background so that it doesn't delay other alarms.
+func fireAlarm(a alarm, cancel <-chan struct{}) error {
+	ref, err := spotifyuri.Parse(a.Play)
+	if err != nil {
+		return err
+	}
+
+	opt := playByID(ref)
+	opt.DeviceID = findDeviceByName(a.Device)
+	volOpt := &spotify.PlayOptions{DeviceID: opt.DeviceID}
+
+	if a.hasVolume() {
+		if err := client.VolumeOpt(a.VolumeFrom, volOpt); err != nil {
+			return err
+		}
+	}
+
+	if err := client.PlayOpt(opt); err != nil {
+		return err
+	}
+
+	if a.hasVolume() && a.VolumeFrom != a.VolumeTo {
+		go func() {
+			if err := rampVolume(realClock{}, &client, volOpt, a.VolumeFrom, a.VolumeTo, a.RampOver, cancel); err != nil {
+				fmt.Printf("%s Alarm %d volume ramp failed: %s\n", time.Now().Format(time.Stamp), a.ID, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+func readAlarms() (alarmStore, error) {
+	var list alarmStore
+
+	path, err := dataFilePath(alarmsFile)
+	if err != nil {
+		return list, err
+	}
+
+	if err := readJSONFile(path, &list); err != nil && !os.IsNotExist(err) {
+		return list, err
+	}
+
+	return list, nil
+}
+
+func writeAlarms(list alarmStore) error {
+	path, err := dataFilePath(alarmsFile)
+	if err != nil {
+		return err
+	}
+
+	return writeJSONFile(path, list)
+}
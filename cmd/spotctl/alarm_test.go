@@ -0,0 +1,300 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// suspendingClock is a fakeClock that jumps over a suspension when a wait
+// crosses the time the computer was suspended at.
+type suspendingClock struct {
+	*fakeClock
+	suspendAt time.Time
+	resumeAt  time.Time
+}
+
+func (c *suspendingClock) After(d time.Duration) <-chan time.Time {
+	if !c.suspendAt.IsZero() && c.now.Add(d).After(c.suspendAt) {
+		c.now = c.resumeAt
+		c.suspendAt = time.Time{}
+		return c.fakeClock.After(0)
+	}
+
+	return c.fakeClock.After(d)
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s isn't available: %s", name, err)
+	}
+
+	return loc
+}
+
+func TestParseAlarmSchedule(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "07:30", want: "07:30 sun,mon,tue,wed,thu,fri,sat"},
+		{in: "07:30 daily", want: "07:30 sun,mon,tue,wed,thu,fri,sat"},
+		{in: "7:05 weekdays", want: "07:05 mon,tue,wed,thu,fri"},
+		{in: "09:00 weekends", want: "09:00 sun,sat"},
+		{in: "09:00 Sat,Sun", want: "09:00 sun,sat"},
+		{in: "22:00 fri-mon", want: "22:00 sun,mon,fri,sat"},
+		{in: "06:45 tues,thursday", want: "06:45 tue,thu"},
+		{in: "", err: true},
+		{in: "25:00", err: true},
+		{in: "07:30 someday", err: true},
+		{in: "07:30 mon fri", err: true},
+	}
+
+	for _, tt := range tests {
+		sched, err := parseAlarmSchedule(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseAlarmSchedule(%q) = %s, want an error", tt.in, sched)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAlarmSchedule(%q) failed: %s", tt.in, err)
+			continue
+		}
+		if got := sched.String(); got != tt.want {
+			t.Errorf("parseAlarmSchedule(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAlarmScheduleNext(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+
+	tests := []struct {
+		schedule string
+		from     time.Time
+		want     time.Time
+	}{
+		// Friday 2024-03-01 rolls over the weekend
+		{"07:30 mon-fri", time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 7, 30, 0, 0, time.UTC)},
+		{"07:30 mon-fri", time.Date(2024, 3, 1, 7, 30, 0, 0, time.UTC), time.Date(2024, 3, 4, 7, 30, 0, 0, time.UTC)},
+		{"07:30 mon-fri", time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 7, 30, 0, 0, time.UTC)},
+		{"22:00 fri-mon", time.Date(2024, 3, 4, 23, 0, 0, 0, time.UTC), time.Date(2024, 3, 8, 22, 0, 0, 0, time.UTC)},
+		// the year rolls over too
+		{"08:00 wed", time.Date(2024, 12, 26, 9, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)},
+		// 02:30 doesn't exist when clocks spring forward on 2024-03-10
+		{"02:30", time.Date(2024, 3, 10, 0, 0, 0, 0, ny), time.Date(2024, 3, 10, 3, 30, 0, 0, ny)},
+		{"02:30", time.Date(2024, 3, 10, 3, 30, 0, 0, ny), time.Date(2024, 3, 11, 2, 30, 0, 0, ny)},
+		// 01:30 happens twice when clocks fall back on 2024-11-03, it fires
+		// the first time only
+		{"01:30", time.Date(2024, 11, 3, 0, 0, 0, 0, ny), time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC)},
+		{"01:30", time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC).In(ny), time.Date(2024, 11, 4, 1, 30, 0, 0, ny)},
+	}
+
+	for _, tt := range tests {
+		sched, err := parseAlarmSchedule(tt.schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sched.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("next(%q, %s) = %s, want %s", tt.schedule, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestDueAlarms(t *testing.T) {
+	alarms := []alarm{
+		{ID: 1, Schedule: "07:30 mon-fri"},
+		{ID: 2, Schedule: "09:00 sat,sun"},
+		{ID: 3, Schedule: "invalid"},
+	}
+	day := func(d, h, m int) time.Time {
+		return time.Date(2024, 3, d, h, m, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		last, now time.Time
+		due       []int
+		missed    []int
+	}{
+		{"before", day(1, 7, 0), day(1, 7, 29), nil, nil},
+		{"on time", day(1, 7, 29), day(1, 7, 30), []int{1}, nil},
+		{"already fired", day(1, 7, 30), day(1, 7, 31), nil, nil},
+		{"suspended within grace", day(1, 7, 0), day(1, 7, 40), []int{1}, nil},
+		{"suspended past grace", day(1, 7, 0), day(1, 9, 0), nil, []int{1}},
+		{"suspended over the weekend", day(1, 7, 0), day(3, 9, 10), []int{2}, []int{1}},
+		{"suspended over days fires once", day(4, 7, 0), day(7, 7, 35), []int{1}, nil},
+	}
+
+	for _, tt := range tests {
+		due, missed := dueAlarms(alarms, tt.last, tt.now, 15*time.Minute)
+		if got := alarmIDs(due); !equalInts(got, tt.due) {
+			t.Errorf("%s: due = %v, want %v", tt.name, got, tt.due)
+		}
+		if got := alarmIDs(missed); !equalInts(got, tt.missed) {
+			t.Errorf("%s: missed = %v, want %v", tt.name, got, tt.missed)
+		}
+	}
+}
+
+func TestAlarmRunner(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+
+	tests := []struct {
+		name      string
+		schedule  string
+		start     time.Time
+		stop      time.Time
+		suspendAt time.Time
+		resumeAt  time.Time
+		fired     []time.Time
+	}{
+		{
+			name:     "fires on time",
+			schedule: "07:30 daily",
+			start:    time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC),
+			stop:     time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC),
+			fired:    []time.Time{time.Date(2024, 3, 1, 7, 30, 0, 0, time.UTC)},
+		},
+		{
+			name:     "rolls over the weekend",
+			schedule: "07:30 weekdays",
+			start:    time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC),
+			stop:     time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC),
+			fired:    []time.Time{time.Date(2024, 3, 4, 7, 30, 0, 0, time.UTC)},
+		},
+		{
+			name:      "suspended across the fire time within grace",
+			schedule:  "07:30 daily",
+			start:     time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC),
+			stop:      time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC),
+			suspendAt: time.Date(2024, 3, 1, 7, 10, 0, 0, time.UTC),
+			resumeAt:  time.Date(2024, 3, 1, 7, 40, 0, 0, time.UTC),
+			fired:     []time.Time{time.Date(2024, 3, 1, 7, 40, 0, 0, time.UTC)},
+		},
+		{
+			name:      "suspended across the fire time past grace",
+			schedule:  "07:30 daily",
+			start:     time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC),
+			stop:      time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+			suspendAt: time.Date(2024, 3, 1, 7, 10, 0, 0, time.UTC),
+			resumeAt:  time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "spring forward",
+			schedule: "02:30 daily",
+			start:    time.Date(2024, 3, 10, 0, 0, 0, 0, ny),
+			stop:     time.Date(2024, 3, 10, 6, 0, 0, 0, ny),
+			fired:    []time.Time{time.Date(2024, 3, 10, 3, 30, 0, 0, ny)},
+		},
+		{
+			name:     "fall back",
+			schedule: "01:30 daily",
+			start:    time.Date(2024, 11, 3, 0, 0, 0, 0, ny),
+			stop:     time.Date(2024, 11, 3, 6, 0, 0, 0, ny),
+			fired:    []time.Time{time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tt := range tests {
+		cancel := make(chan struct{})
+		c := &suspendingClock{
+			fakeClock: &fakeClock{now: tt.start, stopAt: tt.stop, cancel: cancel},
+			suspendAt: tt.suspendAt,
+			resumeAt:  tt.resumeAt,
+		}
+
+		var (
+			fired   []time.Time
+			checked time.Time
+		)
+		r := &alarmRunner{
+			clock: c,
+			grace: 15 * time.Minute,
+			poll:  time.Minute,
+			alarms: func() ([]alarm, error) {
+				return []alarm{{ID: 1, Schedule: tt.schedule}}, nil
+			},
+			fire: func(a alarm) error {
+				fired = append(fired, c.Now())
+				return nil
+			},
+			checked: func(t time.Time) error {
+				checked = t
+				return nil
+			},
+		}
+
+		if err := r.run(tt.start, cancel); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if len(fired) != len(tt.fired) {
+			t.Errorf("%s: fired at %v, want %v", tt.name, fired, tt.fired)
+			continue
+		}
+		for i := range fired {
+			if !fired[i].Equal(tt.fired[i]) {
+				t.Errorf("%s: fired at %v, want %v", tt.name, fired, tt.fired)
+				break
+			}
+		}
+		if checked.After(tt.stop) || tt.stop.Sub(checked) > r.poll {
+			t.Errorf("%s: checked up to %s, want about %s", tt.name, checked, tt.stop)
+		}
+	}
+}
+
+func TestParseVolumeRamp(t *testing.T) {
+	tests := []struct {
+		in       string
+		from, to int
+		err      bool
+	}{
+		{in: "40", from: 40, to: 40},
+		{in: "0-40", from: 0, to: 40},
+		{in: "80-20", from: 80, to: 20},
+		{in: "101", err: true},
+		{in: "-5", err: true},
+		{in: "loud", err: true},
+	}
+
+	for _, tt := range tests {
+		from, to, err := parseVolumeRamp(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseVolumeRamp(%q) = %d, %d, want an error", tt.in, from, to)
+			}
+			continue
+		}
+		if err != nil || from != tt.from || to != tt.to {
+			t.Errorf("parseVolumeRamp(%q) = %d, %d, %v, want %d, %d", tt.in, from, to, err, tt.from, tt.to)
+		}
+	}
+}
+
+func alarmIDs(alarms []alarm) []int {
+	var ids []int
+	for _, a := range alarms {
+		ids = append(ids, a.ID)
+	}
+
+	return ids
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/zmb3/spotify"
+)
+
+// apiBaseURL is a variable so that tests can call a test server.
+var apiBaseURL = "https://api.spotify.com/v1/"
+
+// getAPI gets a Web API endpoint and decodes its JSON response into v. It's
+// for the fields the vendored client doesn't decode, such as album labels.
+func getAPI(path string, v interface{}) error {
+	return callAPI("GET", path, v)
+}
+
+// postAPI posts to a Web API endpoint that the vendored client doesn't
+// support, such as the queue. Its response is ignored.
+func postAPI(path string) error {
+	return callAPI("POST", path, nil)
+}
+
+// callAPI calls a Web API endpoint and decodes its JSON response into v, if
+// not nil. Responses without content leave v as it is.
+func callAPI(method, path string, v interface{}) error {
+	tok, err := client.Token()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, apiBaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	tok.SetAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error.Message != "" {
+			return fmt.Errorf("spotify: %s", e.Error.Message)
+		}
+		return fmt.Errorf("spotify: %s", resp.Status)
+	}
+
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// playerState gets the state of the player. When no device is active,
+// Spotify responds without content, which the vendored client fails on,
+// and the state has no item.
+func playerState() (*spotify.PlayerState, error) {
+	var state spotify.PlayerState
+	if err := getAPI("me/player", &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// currentlyPlaying gets what's playing, with no item when nothing is, like
+// playerState.
+func currentlyPlaying() (*spotify.CurrentlyPlaying, error) {
+	var playing spotify.CurrentlyPlaying
+	if err := getAPI("me/player/currently-playing", &playing); err != nil {
+		return nil, err
+	}
+
+	return &playing, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zmb3/spotify"
+	"golang.org/x/oauth2"
+)
+
+// useTestAPI points the Web API calls to a test server with handler until
+// cleanup is called.
+func useTestAPI(handler http.HandlerFunc) (cleanup func()) {
+	server := httptest.NewServer(handler)
+
+	oldURL, oldClient := apiBaseURL, client
+	apiBaseURL = server.URL + "/"
+	client = spotify.NewAuthenticator("").NewClient(&oauth2.Token{AccessToken: "token"})
+
+	return func() {
+		apiBaseURL, client = oldURL, oldClient
+		server.Close()
+	}
+}
+
+func TestPlayerStateNoDevice(t *testing.T) {
+	defer useTestAPI(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("authorization %q, want %q", got, "Bearer token")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})()
+
+	state, err := playerState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Item != nil || state.Playing {
+		t.Errorf("playerState() = %+v, want nothing playing", state)
+	}
+
+	playing, err := currentlyPlaying()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playing.Item != nil {
+		t.Errorf("currentlyPlaying() = %+v, want nothing playing", playing)
+	}
+}
+
+func TestPlayerState(t *testing.T) {
+	defer useTestAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/me/player" {
+			t.Errorf("path %s, want /me/player", r.URL.Path)
+		}
+		w.Write([]byte(`{"is_playing": true, "progress_ms": 1000, "item": {"uri": "spotify:track:a", "name": "A"}, "device": {"name": "Kitchen"}}`))
+	})()
+
+	state, err := playerState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Playing || state.Progress != 1000 || state.Item == nil || state.Item.URI != "spotify:track:a" || state.Device.Name != "Kitchen" {
+		t.Errorf("playerState() = %+v", state)
+	}
+}
+
+func TestCallAPIError(t *testing.T) {
+	defer useTestAPI(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"status": 403, "message": "Player command failed: Premium required"}}`))
+	})()
+
+	_, err := playerState()
+	if err == nil || err.Error() != "spotify: Player command failed: Premium required" {
+		t.Errorf("playerState() error = %v", err)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+var (
+	artistRelatedCmdFlagDepth int
+	artistRelatedCmdFlagLimit int
+)
+
+var artistCmd = &cobra.Command{
+	Use:         "artist <name|uri>",
+	Short:       "Show an artist and their top tracks",
+	Long:        `Show the genres, followers and top tracks of an artist in your country. The artist can be given by URI, URL, ID or name.`,
+	Args:        cobra.MinimumNArgs(1),
+	RunE:        artist,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserReadPrivate},
+}
+
+var artistAlbumsCmd = &cobra.Command{
+	Use:         "albums <name|uri>",
+	Short:       "Show the discography of an artist",
+	Long:        `Show the albums, singles, compilations and appearances of an artist available in your country, newest first.`,
+	Args:        cobra.MinimumNArgs(1),
+	RunE:        artistAlbums,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserReadPrivate},
+}
+
+var artistRelatedCmd = &cobra.Command{
+	Use:   "related <name|uri>",
+	Short: "Show the artists related to an artist",
+	Long:  `Show the artists related to an artist as a tree. With --depth, the artists related to those are shown as well, down to that depth. Artists already shown aren't expanded again.`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  artistRelated,
+}
+
+// artistTopTracksLimit is the number of top tracks play --top-tracks plays.
+const artistTopTracksLimit = 10
+
+// findArtist finds an artist by URI, URL, ID or name.
+func findArtist(args []string) (*spotify.FullArtist, error) {
+	id, _, err := findSeed(strings.Join(args, " "), spotifyuri.Artist)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.GetArtist(id)
+}
+
+// currentUserCountry returns the country of the current user, which is the
+// market of artist top tracks and albums. It falls back to US if the country
+// isn't known.
+func currentUserCountry() string {
+	if u, err := client.CurrentUser(); err == nil && u.Country != "" {
+		return u.Country
+	}
+
+	return "US"
+}
+
+func artist(cmd *cobra.Command, args []string) error {
+	a, err := findArtist(args)
+	if err != nil {
+		return err
+	}
+
+	tracks, err := client.GetArtistsTopTracks(a.ID, currentUserCountry())
+	if err != nil {
+		return err
+	}
+
+	genres := strings.Join(a.Genres, ", ")
+	if genres == "" {
+		genres = "-"
+	}
+
+	fmt.Printf("Artist: %s\n", a.Name)
+	fmt.Printf("Genres: %s\n", genres)
+	fmt.Printf("Followers: %d\n", a.Followers.Count)
+	fmt.Printf("Popularity: %d\n", a.Popularity)
+	fmt.Printf("URI: %s\n", a.URI)
+
+	if len(tracks) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	rows := make([][]string, len(tracks))
+	for i, t := range tracks {
+		rows[i] = []string{strconv.Itoa(i + 1), t.Name, t.Album.Name, durationToStr(t.Duration), strconv.Itoa(t.Popularity)}
+	}
+
+	return printTable([]string{"#", "TOP TRACK", "ALBUM", "DURATION", "POPULARITY"}, rows)
+}
+
+// artistAlbumGroups are the groups of a discography in the order they're
+// shown.
+var artistAlbumGroups = []struct {
+	title string
+	typ   spotify.AlbumType
+}{
+	{"Albums", spotify.AlbumTypeAlbum},
+	{"Singles and EPs", spotify.AlbumTypeSingle},
+	{"Compilations", spotify.AlbumTypeCompilation},
+	{"Appears on", spotify.AlbummTypeAppearsOn},
+}
+
+func artistAlbums(cmd *cobra.Command, args []string) error {
+	a, err := findArtist(args)
+	if err != nil {
+		return err
+	}
+
+	country := currentUserCountry()
+
+	groups := make([][]spotify.SimpleAlbum, len(artistAlbumGroups))
+	var ids []spotify.ID
+	for i, g := range artistAlbumGroups {
+		typ := g.typ
+		seen := make(map[string]bool)
+
+		err := allPages(func(opt *spotify.Options) (bool, error) {
+			opt.Country = &country
+
+			page, err := client.GetArtistAlbumsOpt(a.ID, opt, &typ)
+			if err != nil {
+				return false, err
+			}
+
+			for _, album := range page.Albums {
+				// the same album is often listed once per edition
+				if key := strings.ToLower(album.Name); !seen[key] {
+					seen[key] = true
+					groups[i] = append(groups[i], album)
+					ids = append(ids, album.ID)
+				}
+			}
+
+			return page.Next != "", nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// release dates and track counts are only part of full albums
+	details, err := fullAlbums(ids)
+	if err != nil {
+		return err
+	}
+
+	printed := false
+	for i, g := range artistAlbumGroups {
+		albums := groups[i]
+		if len(albums) == 0 {
+			continue
+		}
+
+		sort.SliceStable(albums, func(i, j int) bool {
+			return releaseDate(details, albums[i].ID) > releaseDate(details, albums[j].ID)
+		})
+
+		rows := make([][]string, len(albums))
+		for j, album := range albums {
+			year, tracks := "", ""
+			if d := details[album.ID]; d != nil {
+				if len(d.ReleaseDate) >= 4 {
+					year = d.ReleaseDate[:4]
+				}
+				tracks = strconv.Itoa(d.Tracks.Total)
+			}
+			rows[j] = []string{year, album.Name, tracks, string(album.URI)}
+		}
+
+		if printed {
+			fmt.Println()
+		}
+		printed = true
+
+		fmt.Printf("%s (%d):\n", g.title, len(albums))
+		if err := printTable([]string{"YEAR", "NAME", "TRACKS", "URI"}, rows); err != nil {
+			return err
+		}
+	}
+
+	if !printed {
+		fmt.Printf("%s has no albums available in %s.\n", a.Name, country)
+	}
+
+	return nil
+}
+
+func releaseDate(albums map[spotify.ID]*spotify.FullAlbum, id spotify.ID) string {
+	if a := albums[id]; a != nil {
+		return a.ReleaseDate
+	}
+
+	return ""
+}
+
+func artistRelated(cmd *cobra.Command, args []string) error {
+	if artistRelatedCmdFlagDepth < 1 || artistRelatedCmdFlagDepth > 3 {
+		return errors.New("--depth must be between 1 and 3")
+	}
+	if artistRelatedCmdFlagLimit < 1 {
+		return errors.New("--limit must be positive")
+	}
+
+	a, err := findArtist(args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(a.Name)
+
+	seen := map[spotify.ID]bool{a.ID: true}
+	return printRelatedArtists(a.ID, "", 1, seen)
+}
+
+// printRelatedArtists prints the artists related to id as branches of a tree
+// below prefix, and the artists related to those until depth reaches
+// --depth. Artists in seen are printed but not expanded.
+func printRelatedArtists(id spotify.ID, prefix string, depth int, seen map[spotify.ID]bool) error {
+	related, err := client.GetRelatedArtists(id)
+	if err != nil {
+		return err
+	}
+	if len(related) > artistRelatedCmdFlagLimit {
+		related = related[:artistRelatedCmdFlagLimit]
+	}
+
+	// mark the siblings first so that they're expanded at the shallowest
+	// depth they're at
+	expand := make([]bool, len(related))
+	for i, r := range related {
+		expand[i] = !seen[r.ID]
+		seen[r.ID] = true
+	}
+
+	for i, r := range related {
+		branch, indent := "├── ", "│   "
+		if i == len(related)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		note := ""
+		if !expand[i] {
+			note = " (see above)"
+		}
+		fmt.Printf("%s%s%s%s\n", prefix, branch, r.Name, note)
+
+		if expand[i] && depth < artistRelatedCmdFlagDepth {
+			if err := printRelatedArtists(r.ID, prefix+indent, depth+1, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// artistTopTracksToPlay replaces the artist context of opt with the top
+// tracks of the artist.
+func artistTopTracksToPlay(opt *spotify.PlayOptions) error {
+	var ref spotifyuri.Ref
+	if opt.PlaybackContext != nil {
+		ref, _ = spotifyuri.Parse(string(*opt.PlaybackContext))
+	}
+	if ref.Type != spotifyuri.Artist {
+		return errors.New("--top-tracks only plays artists, try --type artist")
+	}
+
+	tracks, err := client.GetArtistsTopTracks(spotify.ID(ref.ID), currentUserCountry())
+	if err != nil {
+		return err
+	}
+	if len(tracks) == 0 {
+		return errors.New("the artist has no top tracks")
+	}
+	if len(tracks) > artistTopTracksLimit {
+		tracks = tracks[:artistTopTracksLimit]
+	}
+
+	opt.PlaybackContext = nil
+	opt.URIs = nil
+	for _, t := range tracks {
+		opt.URIs = append(opt.URIs, t.URI)
+	}
+
+	return nil
+}
@@ -41,7 +41,7 @@ func login(cmd *cobra.Command, args []string) error {
 
 	tok := <-ch
 
-	if err := saveToken(tok); err != nil {
+	if err := saveToken(tok, tokenScopes); err != nil {
 		return err
 	}
 
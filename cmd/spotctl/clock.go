@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+// clock abstracts the passage of time so that long-running timers can be
+// driven by a fake clock.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// playbackController is the subset of spotify.Client used by timers that
+// control playback, so that they can be exercised without the Spotify API.
+type playbackController interface {
+	PlayerState() (*spotify.PlayerState, error)
+	PlayOpt(opt *spotify.PlayOptions) error
+	PauseOpt(opt *spotify.PlayOptions) error
+	VolumeOpt(percent int, opt *spotify.PlayOptions) error
+}
+
+// sleepUntil blocks until t or until cancel is closed. It returns false if
+// it was canceled.
+func sleepUntil(c clock, t time.Time, cancel <-chan struct{}) bool {
+	d := t.Sub(c.Now())
+	if d <= 0 {
+		return true
+	}
+
+	select {
+	case <-c.After(d):
+		return true
+	case <-cancel:
+		return false
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"time"
+)
+
+// fakeClock is a clock whose time only moves when it's waited for. When
+// cancel is set, the first wait that would end after stopAt closes it and
+// never ends, so that timers can be canceled at a point of their choice.
+type fakeClock struct {
+	now    time.Time
+	stopAt time.Time
+	cancel chan struct{}
+	waits  []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+
+	if c.cancel != nil && c.now.Add(d).After(c.stopAt) {
+		close(c.cancel)
+		c.cancel = nil
+		return nil
+	}
+
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+
+	return ch
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const configFile = "config.json"
+
+// config is the content of the optional config file in the data directory.
+type config struct {
+	// SmartPlaylists maps the names of smart playlists to their rules.
+	SmartPlaylists map[string]smartPlaylistConfig `json:"smart_playlists,omitempty"`
+	// Moods override and add to the built-in moods of play --mood.
+	Moods map[string]moodPreset `json:"moods,omitempty"`
+	// History configures the history log.
+	History historyConfig `json:"history"`
+	// Scrobble sets up the services plays are scrobbled to.
+	Scrobble scrobbleConfig `json:"scrobble"`
+}
+
+// readConfig reads the config file. A missing config file is an empty
+// config.
+func readConfig() (config, error) {
+	var c config
+
+	path := filepath.Join(dataDir, configFile)
+	if err := readJSONFile(path, &c); err != nil && !os.IsNotExist(err) {
+		return c, fmt.Errorf("can't read %s: %s", path, err)
+	}
+
+	return c, nil
+}
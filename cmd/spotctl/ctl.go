@@ -1,24 +1,36 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
+	"github.com/jingweno/spotctl/spotifyuri"
 	"github.com/spf13/cobra"
 	"github.com/zmb3/spotify"
 )
 
 var (
-	playCmdFlagType string
-	deviceNameFlag  string
+	playCmdFlagType        string
+	playCmdFlagInteractive bool
+	playCmdFlagLimit       int
+	playCmdFlagExplain     bool
+	playCmdFlagFile        string
+	playCmdFlagConcurrency int
+	playCmdFlagMood        string
+	playCmdFlagTopTracks   bool
+	deviceNameFlag         string
 )
 
 var playCmd = &cobra.Command{
-	Use:   "play [name]",
+	Use:   "play [name|-]",
 	Short: "Resume playback or play a track, album, artist or playlist by name",
-	Long:  `Resume playback or find a track, album, artist or playlist by name and play it. The search type can be specified with --type.`,
-	RunE:  play,
+	Long: `Resume playback or find a track, album, artist or playlist by name and play it. The search type can be specified with --type, otherwise the best match among tracks, albums, artists and playlists is played. With --interactive, the matches are listed to pick from and --type accepts a comma-separated list of types. A bare ID is played as a track unless --type tells otherwise. With - or --file, a list of URIs, URLs or "artist - title" lines is read from stdin or the file and played, the tracks past the first 100 being queued. With --top-tracks, the top 10 tracks of an artist are played instead of the artist. With --mood, tracks recommended for focus, chill, workout, party or sleep are played, seeded by your top artists. The moods can be tuned in ~/.spotctl.d/config.json, see spotctl radio --help for the attributes:
+
+  {"moods": {"focus": {"energy": "0.3..0.6", "instrumentalness": "0.8.."}}}`,
+	RunE: play,
 }
 
 var pauseCmd = &cobra.Command{
@@ -103,18 +115,51 @@ func repeat(cmd *cobra.Command, args []string) error {
 }
 
 func play(cmd *cobra.Command, args []string) error {
-	var (
-		opt = &spotify.PlayOptions{}
-		err error
-	)
+	opt := &spotify.PlayOptions{}
+	// queue are tracks to queue after those played
+	var queue []spotify.URI
+
+	file := playCmdFlagFile
+	if len(args) == 1 && args[0] == "-" {
+		file = "-"
+	}
+
+	if playCmdFlagMood != "" {
+		if file != "" || len(args) > 0 {
+			return errors.New("--mood can't be combined with a name or a file")
+		}
+
+		var err error
+		opt, err = moodToPlay(playCmdFlagMood)
+		if err != nil {
+			return err
+		}
+	} else if file != "" {
+		var err error
+		opt, queue, err = trackListToPlay(file, playCmdFlagConcurrency)
+		if err != nil {
+			return err
+		}
+	} else if len(args) > 0 {
+		// if args start with a spotify URI, URL or ID, play it directly, otherwise search for songs
+		ref, ok, err := parseURIArg(args[0], playCmdFlagType)
+		if err != nil {
+			return err
+		}
 
-	if len(args) > 0 {
-		// if args start with a spotify ID, play it directly, otherwise search for songs
-		if strings.Contains(args[0], "spotify:") {
-			opt = playByID(args[0]) // only play the first id
+		if ok {
+			opt = playByID(ref) // only play the first id
+		} else if playCmdFlagInteractive {
+			opt, err = pickToPlay(strings.Join(args, " "), playCmdFlagType, playCmdFlagLimit)
 		} else {
 			opt, err = searchToPlay(strings.Join(args, " "), playCmdFlagType)
-			if err != nil {
+		}
+		if err != nil {
+			return err
+		}
+
+		if playCmdFlagTopTracks {
+			if err := artistTopTracksToPlay(opt); err != nil {
 				return err
 			}
 		}
@@ -122,7 +167,16 @@ func play(cmd *cobra.Command, args []string) error {
 
 	opt.DeviceID = findDeviceByName(deviceNameFlag)
 
-	return client.PlayOpt(opt)
+	if err := client.PlayOpt(opt); err != nil {
+		return err
+	}
+
+	if len(queue) > 0 {
+		fmt.Fprintf(os.Stderr, "Playing the first %d tracks, the maximum a single play request accepts, and queuing the other %d.\n", len(opt.URIs), len(queue))
+		return queueTracks(queue, opt.DeviceID)
+	}
+
+	return nil
 }
 
 func devices(cmd *cobra.Command, args []string) error {
@@ -216,7 +270,7 @@ func status(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Spotify is currently playing on %s.\n", state.Device.Name)
 		fmt.Printf("Artist: %s\n", strings.Join(artists, ", "))
 		fmt.Printf("Album: %s\n", state.Item.Album.Name)
-		fmt.Printf("Track: %s\n", state.Item.Name)
+		fmt.Printf("Track: %s%s\n", state.Item.Name, likedMark(state.Item.ID))
 		fmt.Printf("Position: %s / %s\n", durationToStr(state.Progress), durationToStr(state.Item.Duration))
 	} else {
 		fmt.Println("Spotify is currently paused.")
@@ -225,6 +279,21 @@ func status(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// likedMark returns a heart if the track is saved in the library. It's empty
+// if the library can't be read, e.g. because the scope wasn't granted.
+func likedMark(id spotify.ID) string {
+	if !hasScope(spotify.ScopeUserLibraryRead) {
+		return ""
+	}
+
+	saved, err := client.UserHasTracks(id)
+	if err != nil || len(saved) == 0 || !saved[0] {
+		return ""
+	}
+
+	return " ♥"
+}
+
 // findDeviceByName finds the device by name.
 // If name is empty, the first Computer device ID is returned if it's available;
 // otherwise it returns the first device ID.
@@ -249,17 +318,36 @@ func findDeviceByName(name string) *spotify.ID {
 	return nil
 }
 
-func playByID(id string) *spotify.PlayOptions {
+// parseURIArg parses arg if it's a Spotify URI, URL or a bare ID of type t.
+// Bare IDs are taken for tracks when t is auto or empty. It returns false if
+// arg is free text.
+func parseURIArg(arg, t string) (spotifyuri.Ref, bool, error) {
+	if spotifyuri.LooksLikeURI(arg) {
+		ref, err := spotifyuri.Parse(arg)
+		return ref, err == nil, err
+	}
+
+	if t == "auto" || t == "" {
+		t = string(spotifyuri.Track)
+	}
+	if typ, err := spotifyuri.ParseType(t); err == nil && spotifyuri.IsID(arg) {
+		return spotifyuri.Ref{Type: typ, ID: arg}, true, nil
+	}
+
+	return spotifyuri.Ref{}, false, nil
+}
+
+func playByID(ref spotifyuri.Ref) *spotify.PlayOptions {
 	var (
 		uris    []spotify.URI
 		context *spotify.URI
 	)
 
-	if strings.Contains(id, "spotify:track") {
-		uris = append(uris, spotify.URI(id))
-	} else {
-		uri := spotify.URI(id)
+	uri := spotify.URI(ref.URI())
+	if ref.IsContext() {
 		context = &uri
+	} else {
+		uris = append(uris, uri)
 	}
 
 	return &spotify.PlayOptions{
@@ -269,6 +357,10 @@ func playByID(id string) *spotify.PlayOptions {
 }
 
 func searchToPlay(query, t string) (*spotify.PlayOptions, error) {
+	if t == "auto" {
+		return rankToPlay(query, playCmdFlagExplain)
+	}
+
 	var st spotify.SearchType
 	switch t {
 	case "track":
@@ -316,5 +408,82 @@ func searchToPlay(query, t string) (*spotify.PlayOptions, error) {
 		}
 	}
 
+	if opt == nil {
+		return nil, fmt.Errorf("no %s found for %q", t, query)
+	}
+
 	return opt, nil
 }
+
+// pickToPlay searches for items of the comma-separated types t and lets the
+// user pick the one to play.
+func pickToPlay(query, t string, limit int) (*spotify.PlayOptions, error) {
+	if t == "auto" {
+		t = "track,album,artist,playlist"
+	}
+
+	st, err := parseSearchTypes(t)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := searchItems(query, st, limit, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no %s found for %q", t, query)
+	}
+
+	rows := make([][]string, len(items))
+	for i, item := range items {
+		rows[i] = item.columns()
+	}
+
+	i, err := pick(fmt.Sprintf("Results for %q", query), searchItemHeader, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := spotifyuri.Parse(string(items[i].URI))
+	if err != nil {
+		return nil, err
+	}
+
+	return playByID(ref), nil
+}
+
+// rankToPlay searches tracks, albums, artists and playlists at once and
+// plays the best match.
+func rankToPlay(query string, explain bool) (*spotify.PlayOptions, error) {
+	st := spotify.SearchTypeTrack | spotify.SearchTypeAlbum | spotify.SearchTypeArtist | spotify.SearchTypePlaylist
+	items, err := searchItems(query, st, 10, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("nothing found for %q", query)
+	}
+
+	ranked := rankSearchItems(query, items)
+
+	if explain {
+		for i, r := range ranked {
+			if i == 5 {
+				break
+			}
+			fmt.Printf("%5.1f  %s %q by %s\n", r.score, r.item.Type, r.item.Name, strings.Join(r.item.Artists, ", "))
+			for _, reason := range r.reasons {
+				fmt.Printf("         %s\n", reason)
+			}
+		}
+		fmt.Printf("Playing %s %q.\n", ranked[0].item.Type, ranked[0].item.Name)
+	}
+
+	ref, err := spotifyuri.Parse(string(ranked[0].item.URI))
+	if err != nil {
+		return nil, err
+	}
+
+	return playByID(ref), nil
+}
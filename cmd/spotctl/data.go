@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dataFilePath returns the path of a file in the spotctl data directory,
+// creating the directory if it doesn't exist yet.
+func dataFilePath(name ...string) (string, error) {
+	path := filepath.Join(append([]string{dataDir}, name...)...)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// readJSONFile decodes the JSON content of path into v.
+func readJSONFile(path string, v interface{}) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+// writeJSONFile encodes v into path. The file is replaced atomically so that
+// concurrent readers never see a partially written file.
+func writeJSONFile(path string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// readJSONLines calls decode with each non-empty line of a file holding a
+// JSON value per line. A missing file has no lines.
+func readJSONLines(path string, decode func(line []byte) error) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+
+		if err := decode(s.Bytes()); err != nil {
+			return fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+	}
+
+	return s.Err()
+}
+
+// appendJSONLines appends values to a file holding a JSON value per line.
+func appendJSONLines(path string, values []interface{}) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
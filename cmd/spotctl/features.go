@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/zmb3/spotify"
+)
+
+// audioFeaturesBatchSize is the maximum number of tracks per audio features
+// request.
+const audioFeaturesBatchSize = 100
+
+// audioFeatures gets the audio features of tracks. Tracks without audio
+// features are left out.
+func audioFeatures(ids []spotify.ID) (map[spotify.ID]*spotify.AudioFeatures, error) {
+	features := make(map[spotify.ID]*spotify.AudioFeatures)
+
+	err := inBatches(len(ids), audioFeaturesBatchSize, func(start, end int) error {
+		batch, err := client.GetAudioFeatures(ids[start:end]...)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range batch {
+			if f != nil {
+				features[f.ID] = f
+			}
+		}
+		return nil
+	})
+
+	return features, err
+}
+
+// camelotKey is a key in the Camelot notation DJs use for harmonic mixing:
+// keys a fifth apart have adjacent numbers from 1 to 12, minor keys are A and
+// major keys B.
+type camelotKey struct {
+	number int
+	major  bool
+}
+
+// newCamelotKey converts a Spotify pitch class and mode. It returns false if
+// the key wasn't detected.
+func newCamelotKey(key, mode int) (camelotKey, bool) {
+	if key < 0 || key > 11 {
+		return camelotKey{}, false
+	}
+
+	if mode == 1 {
+		return camelotKey{(7*key+7)%12 + 1, true}, true
+	}
+
+	return camelotKey{(7*key+4)%12 + 1, false}, true
+}
+
+func (k camelotKey) String() string {
+	if k.major {
+		return fmt.Sprintf("%dB", k.number)
+	}
+
+	return fmt.Sprintf("%dA", k.number)
+}
+
+// index orders the keys around the wheel: 1A, 1B, 2A, 2B and so on.
+func (k camelotKey) index() int {
+	i := (k.number - 1) * 2
+	if k.major {
+		i++
+	}
+
+	return i
+}
+
+// relation describes how well a mixes into b: the same key, a step around the
+// wheel, the relative major or minor, or a clash.
+func (k camelotKey) relation(b camelotKey) (string, bool) {
+	step := (b.number - k.number + 12) % 12
+
+	switch {
+	case step == 0 && k.major == b.major:
+		return "same key", true
+	case step == 0:
+		return "relative key", true
+	case k.major == b.major && step == 1:
+		return "+1", true
+	case k.major == b.major && step == 11:
+		return "-1", true
+	default:
+		return "clash", false
+	}
+}
+
+// distance is the number of steps around the wheel between the keys, plus
+// one if they differ in mode.
+func (k camelotKey) distance(b camelotKey) int {
+	d := (b.number - k.number + 12) % 12
+	if d > 6 {
+		d = 12 - d
+	}
+	if k.major != b.major {
+		d++
+	}
+
+	return d
+}
+
+// tempoDifference returns the relative difference between two tempos in
+// percent, counting double and half time as the same tempo.
+func tempoDifference(a, b float64) float64 {
+	if a <= 0 || b <= 0 {
+		return 100
+	}
+
+	diff := 100.0
+	for _, f := range []float64{0.5, 1, 2} {
+		if d := math.Abs(a-b*f) / a * 100; d < diff {
+			diff = d
+		}
+	}
+
+	return diff
+}
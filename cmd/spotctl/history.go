@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+const (
+	historyFile     = "history.jsonl"
+	historySyncFile = "history-sync.json"
+
+	// historyAutoSyncInterval is how often other commands sync the history
+	// if auto_sync is set in the config file.
+	historyAutoSyncInterval = 10 * time.Minute
+)
+
+var (
+	historyCmdFlagFrom    string
+	historyCmdFlagTo      string
+	historyCmdFlagArtist  string
+	historyCmdFlagContext string
+	historyCmdFlagLimit   int
+	historyCmdFlagOutput  string
+	historyCmdFlagNoSync  bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the tracks you played",
+	Long: `Show the tracks you played, latest last. Spotify only keeps the last 50 plays, so they're merged into a local log in ~/.spotctl.d/history.jsonl every time the history is shown. To keep the log complete without running "spotctl history" regularly, let every command sync it at most every 10 minutes with this in ~/.spotctl.d/config.json:
+
+  {"history": {"auto_sync": true}}
+
+Syncing needs access to the recently played tracks, which is asked for the first time "spotctl history" is run.
+
+The plays can be filtered by date, artist and context, which is a context type such as playlist or album, or the URI or URL of a playlist, album or artist.`,
+	Args:        cobra.NoArgs,
+	RunE:        history,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserReadRecentlyPlayed},
+}
+
+// historyConfig is the history section of the config file.
+type historyConfig struct {
+	// AutoSync syncs the history after any command that talks to Spotify.
+	AutoSync bool `json:"auto_sync"`
+}
+
+// historyEntry is a play in the history log.
+type historyEntry struct {
+	PlayedAt    time.Time   `json:"played_at"`
+	URI         spotify.URI `json:"uri"`
+	Name        string      `json:"name"`
+	Artists     []string    `json:"artists,omitempty"`
+	Duration    int         `json:"duration_ms,omitempty"`
+	ContextType string      `json:"context_type,omitempty"`
+	ContextURI  spotify.URI `json:"context_uri,omitempty"`
+}
+
+// key identifies a play. The same track can't be played twice at once.
+func (e historyEntry) key() string {
+	return e.PlayedAt.UTC().Format(time.RFC3339Nano) + " " + string(e.URI)
+}
+
+// readHistory reads the history log. A missing log is empty.
+func readHistory() ([]historyEntry, error) {
+	path, err := dataFilePath(historyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []historyEntry
+	err = readJSONLines(path, func(line []byte) error {
+		var e historyEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	})
+
+	return entries, err
+}
+
+// appendHistory appends the entries that aren't in the history log yet, in
+// the order they were played. It returns the number of entries appended.
+func appendHistory(entries []historyEntry) (int, error) {
+	existing, err := readHistory()
+	if err != nil {
+		return 0, err
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range existing {
+		seen[e.key()] = true
+	}
+
+	var added []historyEntry
+	for _, e := range entries {
+		if !seen[e.key()] {
+			seen[e.key()] = true
+			added = append(added, e)
+		}
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+
+	sort.SliceStable(added, func(i, j int) bool {
+		return added[i].PlayedAt.Before(added[j].PlayedAt)
+	})
+
+	path, err := dataFilePath(historyFile)
+	if err != nil {
+		return 0, err
+	}
+
+	lines := make([]interface{}, len(added))
+	for i, e := range added {
+		lines[i] = e
+	}
+	if err := appendJSONLines(path, lines); err != nil {
+		return 0, err
+	}
+
+	return len(added), nil
+}
+
+// syncHistory merges the recently played tracks into the history log.
+func syncHistory() (int, error) {
+	items, err := client.PlayerRecentlyPlayedOpt(&spotify.RecentlyPlayedOptions{Limit: 50})
+	if err != nil {
+		return 0, err
+	}
+
+	entries := make([]historyEntry, len(items))
+	for i, item := range items {
+		entries[i] = historyEntry{
+			PlayedAt:    item.PlayedAt,
+			URI:         item.Track.URI,
+			Name:        item.Track.Name,
+			Artists:     artistNames(item.Track.Artists),
+			Duration:    item.Track.Duration,
+			ContextType: item.PlaybackContext.Type,
+			ContextURI:  item.PlaybackContext.URI,
+		}
+	}
+
+	n, err := appendHistory(entries)
+	if err != nil {
+		return n, err
+	}
+
+	path, err := dataFilePath(historySyncFile)
+	if err != nil {
+		return n, err
+	}
+
+	return n, writeJSONFile(path, struct {
+		SyncedAt time.Time `json:"synced_at"`
+	}{time.Now()})
+}
+
+// autoSyncHistory syncs the history if auto_sync is set in the config file
+// and it wasn't synced in the last historyAutoSyncInterval. If the token may
+// not read it, how to allow it is printed once. It's best effort: failures
+// are printed without failing the command, and the next command tries
+// again.
+func autoSyncHistory() {
+	c, err := readConfig()
+	if err != nil || !c.History.AutoSync {
+		return
+	}
+
+	path, err := dataFilePath(historySyncFile)
+	if err != nil {
+		return
+	}
+
+	var state struct {
+		SyncedAt time.Time `json:"synced_at"`
+		Hinted   bool      `json:"hinted,omitempty"`
+	}
+	readJSONFile(path, &state)
+
+	if !hasScope(spotify.ScopeUserReadRecentlyPlayed) {
+		if !state.Hinted {
+			fmt.Fprintln(os.Stderr, `The history can't be synced until spotctl may read your recently played tracks, run "spotctl history" once to allow it.`)
+			state.Hinted = true
+			writeJSONFile(path, state)
+		}
+		return
+	}
+
+	if time.Since(state.SyncedAt) < historyAutoSyncInterval {
+		return
+	}
+
+	if _, err := syncHistory(); err != nil {
+		fmt.Fprintf(os.Stderr, "Syncing the history failed: %s\n", err)
+	}
+}
+
+// historyFilter narrows down history entries. Zero values match everything.
+type historyFilter struct {
+	from        time.Time
+	to          time.Time
+	artist      string
+	contextType string
+	contextURI  spotify.URI
+}
+
+func newHistoryFilter() (historyFilter, error) {
+	var (
+		f   historyFilter
+		err error
+	)
+
+	if historyCmdFlagFrom != "" {
+		if f.from, err = parseDate(historyCmdFlagFrom); err != nil {
+			return f, err
+		}
+	}
+	if historyCmdFlagTo != "" {
+		if f.to, err = parseDate(historyCmdFlagTo); err != nil {
+			return f, err
+		}
+		// a date includes the whole day
+		if !strings.Contains(historyCmdFlagTo, "T") {
+			f.to = f.to.AddDate(0, 0, 1)
+		}
+	}
+
+	f.artist = strings.ToLower(historyCmdFlagArtist)
+
+	switch c := strings.ToLower(historyCmdFlagContext); c {
+	case "":
+	case "album", "artist", "playlist":
+		f.contextType = c
+	default:
+		ref, err := spotifyuri.Parse(historyCmdFlagContext)
+		if err != nil {
+			return f, fmt.Errorf("invalid context %q, expected album, artist, playlist or a URI", historyCmdFlagContext)
+		}
+		f.contextURI = spotify.URI(ref.URI())
+	}
+
+	return f, nil
+}
+
+func (f historyFilter) match(e historyEntry) bool {
+	if !f.from.IsZero() && e.PlayedAt.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && !e.PlayedAt.Before(f.to) {
+		return false
+	}
+	if f.contextType != "" && e.ContextType != f.contextType {
+		return false
+	}
+	if f.contextURI != "" && e.ContextURI != f.contextURI {
+		return false
+	}
+
+	if f.artist != "" {
+		for _, a := range e.Artists {
+			if strings.Contains(strings.ToLower(a), f.artist) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func history(cmd *cobra.Command, args []string) error {
+	filter, err := newHistoryFilter()
+	if err != nil {
+		return err
+	}
+
+	if !historyCmdFlagNoSync {
+		if _, err := syncHistory(); err != nil {
+			return err
+		}
+	}
+
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+
+	var matched []historyEntry
+	for _, e := range entries {
+		if filter.match(e) {
+			matched = append(matched, e)
+		}
+	}
+
+	if historyCmdFlagLimit > 0 && len(matched) > historyCmdFlagLimit {
+		matched = matched[len(matched)-historyCmdFlagLimit:]
+	}
+
+	return printHistory(matched, historyCmdFlagOutput)
+}
+
+func printHistory(entries []historyEntry, output string) error {
+	switch output {
+	case outputTable:
+		rows := make([][]string, len(entries))
+		for i, e := range entries {
+			rows[i] = []string{
+				e.PlayedAt.Local().Format("2006-01-02 15:04"),
+				e.Name,
+				strings.Join(e.Artists, ", "),
+				durationToStr(e.Duration),
+				string(e.ContextURI),
+			}
+		}
+		return printTable([]string{"PLAYED", "TRACK", "ARTIST", "DURATION", "CONTEXT"}, rows)
+	case outputJSON:
+		if entries == nil {
+			entries = []historyEntry{}
+		}
+		return printJSON(entries)
+	case outputURI:
+		for _, e := range entries {
+			fmt.Println(e.URI)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %s", output)
+	}
+}
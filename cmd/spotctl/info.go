@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+var (
+	infoCmdFlagAlbum bool
+	infoCmdFlagPlay  int
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info [uri]",
+	Short: "Show the details of a track or album",
+	Long:  `Show the details of a track or album given by URI, URL or ID, or of the current track. Tracks are shown with their audio features, albums with their tracks. With --album, the album of a track is shown, and with --play N, the album is played from its Nth track.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  info,
+}
+
+// albumInfo is a full album with the fields the vendored client doesn't
+// decode.
+type albumInfo struct {
+	spotify.FullAlbum
+	Label string `json:"label"`
+}
+
+func info(cmd *cobra.Command, args []string) error {
+	var ref spotifyuri.Ref
+
+	if len(args) == 0 {
+		playing, err := currentlyPlaying()
+		if err != nil {
+			return err
+		}
+		if playing.Item == nil {
+			return errors.New("nothing is playing, give the URI of a track or album")
+		}
+		ref = spotifyuri.Ref{Type: spotifyuri.Track, ID: string(playing.Item.ID)}
+	} else {
+		t := spotifyuri.Track
+		if infoCmdFlagAlbum || infoCmdFlagPlay > 0 {
+			t = spotifyuri.Album
+		}
+
+		// bare IDs are tracks, or albums with --album
+		var err error
+		if spotifyuri.LooksLikeURI(args[0]) {
+			ref, err = spotifyuri.Parse(args[0])
+		} else {
+			ref, err = spotifyuri.ParseAs(args[0], t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	switch ref.Type {
+	case spotifyuri.Track:
+		track, err := client.GetTrack(spotify.ID(ref.ID))
+		if err != nil {
+			return err
+		}
+
+		if !infoCmdFlagAlbum && infoCmdFlagPlay == 0 {
+			return printTrackInfo(track)
+		}
+		ref = spotifyuri.Ref{Type: spotifyuri.Album, ID: string(track.Album.ID)}
+	case spotifyuri.Album:
+	default:
+		return fmt.Errorf("%s is a %s, expected a track or album", args[0], ref.Type)
+	}
+
+	album, err := getAlbumInfo(spotify.ID(ref.ID))
+	if err != nil {
+		return err
+	}
+
+	if infoCmdFlagPlay > 0 {
+		return playAlbumTrack(album, infoCmdFlagPlay)
+	}
+
+	return printAlbumInfo(album)
+}
+
+// getAlbumInfo gets an album with all its tracks.
+func getAlbumInfo(id spotify.ID) (*albumInfo, error) {
+	var album albumInfo
+	if err := getAPI("albums/"+string(id), &album); err != nil {
+		return nil, err
+	}
+
+	for len(album.Tracks.Tracks) < album.Tracks.Total {
+		page, err := client.GetAlbumTracksOpt(id, pageSize, len(album.Tracks.Tracks))
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Tracks) == 0 {
+			break
+		}
+		album.Tracks.Tracks = append(album.Tracks.Tracks, page.Tracks...)
+	}
+
+	return &album, nil
+}
+
+func printTrackInfo(t *spotify.FullTrack) error {
+	fmt.Printf("Track: %s\n", t.Name)
+	fmt.Printf("Artist: %s\n", strings.Join(artistNames(t.Artists), ", "))
+	fmt.Printf("Album: %s\n", t.Album.Name)
+	fmt.Printf("Disc: %d\n", t.DiscNumber)
+	fmt.Printf("Track number: %d\n", t.TrackNumber)
+	fmt.Printf("Duration: %s\n", durationToStr(t.Duration))
+	fmt.Printf("Explicit: %s\n", yesNo(t.Explicit))
+	fmt.Printf("ISRC: %s\n", orDash(t.ExternalIDs["isrc"]))
+	fmt.Printf("Popularity: %d\n", t.Popularity)
+	fmt.Printf("Markets: %s\n", marketsToStr(t.AvailableMarkets))
+	fmt.Printf("URI: %s\n", t.URI)
+
+	features, err := client.GetAudioFeatures(t.ID)
+	if err != nil {
+		return err
+	}
+	if len(features) == 0 || features[0] == nil {
+		return nil
+	}
+	f := features[0]
+
+	key := "-"
+	if ck, ok := newCamelotKey(f.Key, f.Mode); ok {
+		key = fmt.Sprintf("%s (%s)", keyName(f.Key, f.Mode), ck)
+	}
+
+	fmt.Printf("Key: %s\n", key)
+	fmt.Printf("Tempo: %.1f BPM\n", f.Tempo)
+	fmt.Printf("Time signature: %d/4\n", f.TimeSignature)
+	fmt.Printf("Loudness: %.1f dB\n", f.Loudness)
+	fmt.Printf("Energy: %.2f\n", f.Energy)
+	fmt.Printf("Danceability: %.2f\n", f.Danceability)
+	fmt.Printf("Valence: %.2f\n", f.Valence)
+	fmt.Printf("Acousticness: %.2f\n", f.Acousticness)
+	fmt.Printf("Instrumentalness: %.2f\n", f.Instrumentalness)
+	fmt.Printf("Liveness: %.2f\n", f.Liveness)
+	fmt.Printf("Speechiness: %.2f\n", f.Speechiness)
+
+	return nil
+}
+
+func printAlbumInfo(a *albumInfo) error {
+	var total int
+	for _, t := range a.Tracks.Tracks {
+		total += t.Duration
+	}
+
+	fmt.Printf("Album: %s\n", a.Name)
+	fmt.Printf("Artist: %s\n", strings.Join(artistNames(a.Artists), ", "))
+	fmt.Printf("Type: %s\n", a.AlbumType)
+	fmt.Printf("Label: %s\n", orDash(a.Label))
+	fmt.Printf("Released: %s\n", orDash(a.ReleaseDate))
+	fmt.Printf("Tracks: %d (%s)\n", len(a.Tracks.Tracks), durationToStr(total))
+	fmt.Printf("UPC: %s\n", orDash(a.ExternalIDs["upc"]))
+	fmt.Printf("Popularity: %d\n", a.Popularity)
+	if len(a.Genres) > 0 {
+		fmt.Printf("Genres: %s\n", strings.Join(a.Genres, ", "))
+	}
+	fmt.Printf("Markets: %s\n", marketsToStr(a.AvailableMarkets))
+	for _, c := range a.Copyrights {
+		fmt.Printf("Copyright: %s\n", copyrightToStr(c))
+	}
+	fmt.Printf("URI: %s\n", a.URI)
+	fmt.Println()
+
+	discs := 0
+	for _, t := range a.Tracks.Tracks {
+		if t.DiscNumber > discs {
+			discs = t.DiscNumber
+		}
+	}
+
+	rows := make([][]string, len(a.Tracks.Tracks))
+	for i, t := range a.Tracks.Tracks {
+		number := strconv.Itoa(t.TrackNumber)
+		if discs > 1 {
+			number = fmt.Sprintf("%d-%d", t.DiscNumber, t.TrackNumber)
+		}
+
+		explicit := ""
+		if t.Explicit {
+			explicit = "E"
+		}
+
+		rows[i] = []string{strconv.Itoa(i + 1), number, t.Name, strings.Join(artistNames(t.Artists), ", "), durationToStr(t.Duration), explicit}
+	}
+
+	return printTable([]string{"#", "TRACK", "NAME", "ARTIST", "DURATION", "EXPLICIT"}, rows)
+}
+
+// playAlbumTrack plays an album from its nth track, counting from 1.
+func playAlbumTrack(a *albumInfo, n int) error {
+	if n > len(a.Tracks.Tracks) {
+		return fmt.Errorf("can't play track %d, %q has %d tracks", n, a.Name, len(a.Tracks.Tracks))
+	}
+
+	t := a.Tracks.Tracks[n-1]
+	fmt.Printf("Playing %q from track %d, %q.\n", a.Name, n, t.Name)
+
+	return client.PlayOpt(&spotify.PlayOptions{
+		DeviceID:        findDeviceByName(deviceNameFlag),
+		PlaybackContext: &a.URI,
+		PlaybackOffset:  &spotify.PlaybackOffset{URI: t.URI},
+	})
+}
+
+var pitchClasses = []string{"C", "C♯", "D", "E♭", "E", "F", "F♯", "G", "A♭", "A", "B♭", "B"}
+
+// keyName names a Spotify pitch class and mode, such as "F♯ minor".
+func keyName(key, mode int) string {
+	if key < 0 || key >= len(pitchClasses) {
+		return "-"
+	}
+
+	if mode == 1 {
+		return pitchClasses[key] + " major"
+	}
+
+	return pitchClasses[key] + " minor"
+}
+
+// marketsToStr formats country codes as their number followed by the sorted
+// codes.
+func marketsToStr(markets []string) string {
+	if len(markets) == 0 {
+		return "-"
+	}
+
+	sorted := append([]string{}, markets...)
+	sort.Strings(sorted)
+
+	return fmt.Sprintf("%d (%s)", len(sorted), strings.Join(sorted, " "))
+}
+
+// copyrightToStr formats a copyright with its symbol: © for the copyright
+// and ℗ for the sound recording.
+func copyrightToStr(c spotify.Copyright) string {
+	symbol := "©"
+	if c.Type == "P" {
+		symbol = "℗"
+	}
+
+	if strings.HasPrefix(c.Text, "©") || strings.HasPrefix(c.Text, "℗") || strings.HasPrefix(c.Text, "(C)") || strings.HasPrefix(c.Text, "(P)") {
+		return c.Text
+	}
+
+	return symbol + " " + c.Text
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
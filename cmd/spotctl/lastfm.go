@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	lastFMBaseURL     = "https://ws.audioscrobbler.com/2.0/"
+	lastFMAuthURL     = "https://www.last.fm/api/auth/"
+	lastFMSessionFile = "lastfm-session.json"
+	lastFMBatchSize   = 50
+)
+
+// lastFMConfig configures a service speaking the Last.fm API.
+type lastFMConfig struct {
+	BaseURL string `json:"base_url,omitempty"`
+	AuthURL string `json:"auth_url,omitempty"`
+	APIKey  string `json:"api_key"`
+	Secret  string `json:"secret"`
+	// SessionKey is the key "spotctl scrobble login" saves otherwise.
+	SessionKey string `json:"session_key,omitempty"`
+}
+
+// lastFMSession is the session saved by "spotctl scrobble login".
+type lastFMSession struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// lastFM scrobbles with signed calls to the Last.fm API.
+type lastFM struct {
+	config lastFMConfig
+}
+
+func newLastFM(c lastFMConfig) (*lastFM, error) {
+	if c.APIKey == "" || c.Secret == "" {
+		return nil, errors.New("the lastfm scrobble config needs an api_key and a secret")
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = lastFMBaseURL
+	}
+	if c.AuthURL == "" {
+		c.AuthURL = lastFMAuthURL
+	}
+
+	return &lastFM{config: c}, nil
+}
+
+// loadSession reads the session key saved by "spotctl scrobble login"
+// unless the config has one.
+func (l *lastFM) loadSession() error {
+	if l.config.SessionKey != "" {
+		return nil
+	}
+
+	path, err := dataFilePath(lastFMSessionFile)
+	if err != nil {
+		return err
+	}
+
+	var session lastFMSession
+	if err := readJSONFile(path, &session); err != nil || session.Key == "" {
+		return errors.New(`spotctl isn't allowed to scrobble to Last.fm yet, run "spotctl scrobble login"`)
+	}
+	l.config.SessionKey = session.Key
+
+	return nil
+}
+
+func (l *lastFM) name() string {
+	return "lastfm"
+}
+
+func (l *lastFM) batchSize() int {
+	return lastFMBatchSize
+}
+
+func (l *lastFM) submit(ss []scrobble) error {
+	params := url.Values{"sk": {l.config.SessionKey}}
+	for i, s := range ss {
+		n := "[" + strconv.Itoa(i) + "]"
+		params.Set("artist"+n, s.Artist)
+		params.Set("track"+n, s.Track)
+		params.Set("timestamp"+n, strconv.FormatInt(s.StartedAt.Unix(), 10))
+		if s.Album != "" {
+			params.Set("album"+n, s.Album)
+		}
+		if s.Duration > 0 {
+			params.Set("duration"+n, strconv.Itoa(s.Duration/1000))
+		}
+	}
+
+	return l.call("track.scrobble", params, nil)
+}
+
+func (l *lastFM) nowPlaying(s scrobble) error {
+	params := url.Values{
+		"sk":     {l.config.SessionKey},
+		"artist": {s.Artist},
+		"track":  {s.Track},
+	}
+	if s.Album != "" {
+		params.Set("album", s.Album)
+	}
+	if s.Duration > 0 {
+		params.Set("duration", strconv.Itoa(s.Duration/1000))
+	}
+
+	return l.call("track.updateNowPlaying", params, nil)
+}
+
+// login asks the user to allow spotctl on the authorization page and saves
+// the session key.
+func (l *lastFM) login() error {
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := l.call("auth.getToken", url.Values{}, &token); err != nil {
+		return err
+	}
+
+	u := l.config.AuthURL + "?" + url.Values{"api_key": {l.config.APIKey}, "token": {token.Token}}.Encode()
+	fmt.Println("Please allow spotctl to scrobble by visiting the following page in your browser, then press Enter:", u)
+	bufio.NewReader(os.Stdin).ReadString('\n')
+
+	var resp struct {
+		Session lastFMSession `json:"session"`
+	}
+	if err := l.call("auth.getSession", url.Values{"token": {token.Token}}, &resp); err != nil {
+		return err
+	}
+
+	path, err := dataFilePath(lastFMSessionFile)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONFile(path, resp.Session); err != nil {
+		return err
+	}
+
+	fmt.Printf("Scrobbling to Last.fm as %s.\n", resp.Session.Name)
+
+	return nil
+}
+
+// call makes a signed call to an API method and decodes its response into
+// v, if not nil.
+func (l *lastFM) call(method string, params url.Values, v interface{}) error {
+	params.Set("method", method)
+	params.Set("api_key", l.config.APIKey)
+	params.Set("api_sig", lastFMSignature(params, l.config.Secret))
+	params.Set("format", "json")
+
+	resp, err := scrobbleHTTPClient.PostForm(l.config.BaseURL, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var e struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(content, &e) == nil && e.Error != 0 {
+		msg := e.Message
+		if lastFMConfigError(e.Error) {
+			msg += ", check the api_key and secret of lastfm in the config file"
+		}
+		return &scrobbleError{service: l.name(), msg: msg, temporary: lastFMTemporaryError(e.Error), config: lastFMConfigError(e.Error)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &scrobbleError{service: l.name(), msg: resp.Status, temporary: resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests}
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+// lastFMTemporaryError reports whether calls failing with an API error code
+// may succeed later. Invalid parameters and resources and config errors
+// won't. Session errors are temporary so that scrobbles are kept until the
+// user logs in again.
+func lastFMTemporaryError(code int) bool {
+	return code != 6 && code != 7 && !lastFMConfigError(code)
+}
+
+// lastFMConfigError reports whether an API error code means that the API
+// key or secret in the config file is wrong: the key is invalid (10) or
+// suspended (26), or the signature doesn't match (13).
+func lastFMConfigError(code int) bool {
+	return code == 10 || code == 13 || code == 26
+}
+
+// lastFMSignature signs the parameters of a call: it's the MD5 of the
+// parameters sorted by name, each name followed by its value, and the
+// secret. The format isn't signed.
+func lastFMSignature(params url.Values, secret string) string {
+	var names []string
+	for name := range params {
+		switch name {
+		case "format", "callback", "api_sig":
+		default:
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteString(params.Get(name))
+	}
+	b.WriteString(secret)
+
+	return fmt.Sprintf("%x", md5.Sum([]byte(b.String())))
+}
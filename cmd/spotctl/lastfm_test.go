@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLastFMSignature(t *testing.T) {
+	tests := []struct {
+		params url.Values
+		secret string
+		want   string
+	}{
+		{
+			// the example of the Last.fm authentication docs
+			params: url.Values{
+				"api_key": {"xxxxxxxxxx"},
+				"method":  {"auth.getSession"},
+				"token":   {"yyyyyy"},
+			},
+			secret: "ilovecher",
+			want:   "b87d61da3cda91a8b6746c4aef55d6f8",
+		},
+		{
+			// the format and an earlier signature aren't signed
+			params: url.Values{
+				"api_key": {"xxxxxxxxxx"},
+				"method":  {"auth.getSession"},
+				"token":   {"yyyyyy"},
+				"format":  {"json"},
+				"api_sig": {"0123456789abcdef"},
+			},
+			secret: "ilovecher",
+			want:   "b87d61da3cda91a8b6746c4aef55d6f8",
+		},
+		{
+			params: url.Values{
+				"api_key":      {"key"},
+				"method":       {"track.scrobble"},
+				"sk":           {"session"},
+				"artist[0]":    {"Daft Punk"},
+				"track[0]":     {"Get Lucky"},
+				"timestamp[0]": {"1718452800"},
+				"artist[1]":    {"Miles Davis"},
+				"track[1]":     {"So What"},
+				"timestamp[1]": {"1718453100"},
+			},
+			secret: "secret",
+			want:   "02312b9a830607edf9309b7645d6f773",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := lastFMSignature(tt.params, tt.secret); got != tt.want {
+			t.Errorf("lastFMSignature(%v) = %s, want %s", tt.params, got, tt.want)
+		}
+	}
+}
+
+// newTestLastFM returns a lastFM calling a test server that records the
+// form of the last call and responds with status and body.
+func newTestLastFM(t *testing.T, status int, body string) (*lastFM, *url.Values, func()) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("method %s, want POST", r.Method)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		form = r.PostForm
+
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+
+	l, err := newLastFM(lastFMConfig{BaseURL: server.URL, APIKey: "key", Secret: "secret", SessionKey: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l, &form, server.Close
+}
+
+func TestLastFMSubmit(t *testing.T) {
+	l, form, close := newTestLastFM(t, http.StatusOK, `{"scrobbles": {}}`)
+	defer close()
+
+	ss := []scrobble{
+		{
+			StartedAt: time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC),
+			Track:     "Get Lucky",
+			Artist:    "Daft Punk",
+			Album:     "Random Access Memories",
+			Duration:  369626,
+		},
+		{
+			StartedAt: time.Date(2024, time.June, 15, 12, 5, 0, 0, time.UTC),
+			Track:     "So What",
+			Artist:    "Miles Davis",
+		},
+	}
+	if err := l.submit(ss); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"method":       "track.scrobble",
+		"api_key":      "key",
+		"sk":           "session",
+		"format":       "json",
+		"artist[0]":    "Daft Punk",
+		"track[0]":     "Get Lucky",
+		"timestamp[0]": "1718452800",
+		"album[0]":     "Random Access Memories",
+		"duration[0]":  "369",
+		"artist[1]":    "Miles Davis",
+		"track[1]":     "So What",
+		"timestamp[1]": "1718453100",
+		"api_sig":      lastFMSignature(*form, "secret"),
+	}
+	for name, value := range want {
+		if got := form.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	// unknown albums and durations are left out
+	for _, name := range []string{"album[1]", "duration[1]"} {
+		if _, ok := (*form)[name]; ok {
+			t.Errorf("%s = %q, want none", name, form.Get(name))
+		}
+	}
+	if len(*form) != len(want) {
+		t.Errorf("got %d parameters, want %d: %v", len(*form), len(want), *form)
+	}
+}
+
+func TestLastFMNowPlaying(t *testing.T) {
+	l, form, close := newTestLastFM(t, http.StatusOK, `{"nowplaying": {}}`)
+	defer close()
+
+	s := scrobble{Track: "So What", Artist: "Miles Davis", Album: "Kind Of Blue", Duration: 562000}
+	if err := l.nowPlaying(s); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"method":   "track.updateNowPlaying",
+		"sk":       "session",
+		"artist":   "Miles Davis",
+		"track":    "So What",
+		"album":    "Kind Of Blue",
+		"duration": "562",
+	}
+	for name, value := range want {
+		if got := form.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if _, ok := (*form)["timestamp"]; ok {
+		t.Errorf("now playing has a timestamp")
+	}
+}
+
+func TestLastFMErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		body      string
+		permanent bool
+		config    bool
+	}{
+		// invalid parameters
+		{http.StatusBadRequest, `{"error": 6, "message": "Invalid parameters"}`, true, false},
+		// invalid resource
+		{http.StatusBadRequest, `{"error": 7, "message": "Invalid resource specified"}`, true, false},
+		// invalid session key, kept until the user logs in again
+		{http.StatusForbidden, `{"error": 9, "message": "Invalid session key"}`, false, false},
+		// invalid API key, kept until the config file is fixed
+		{http.StatusForbidden, `{"error": 10, "message": "Invalid API key"}`, false, true},
+		// service offline
+		{http.StatusServiceUnavailable, `{"error": 11, "message": "Service Offline"}`, false, false},
+		// invalid signature
+		{http.StatusForbidden, `{"error": 13, "message": "Invalid method signature supplied"}`, false, true},
+		// temporary error
+		{http.StatusInternalServerError, `{"error": 16, "message": "There was a temporary error"}`, false, false},
+		// suspended API key
+		{http.StatusForbidden, `{"error": 26, "message": "Suspended API key"}`, false, true},
+		// rate limit exceeded
+		{http.StatusTooManyRequests, `{"error": 29, "message": "Rate limit exceeded"}`, false, false},
+		{http.StatusBadGateway, `<html>Bad Gateway</html>`, false, false},
+		{http.StatusTooManyRequests, ``, false, false},
+		{http.StatusNotFound, ``, true, false},
+	}
+
+	for _, tt := range tests {
+		l, _, close := newTestLastFM(t, tt.status, tt.body)
+		err := l.submit([]scrobble{{Track: "So What", Artist: "Miles Davis"}})
+		close()
+
+		if err == nil {
+			t.Errorf("%d %s: submit succeeded", tt.status, tt.body)
+			continue
+		}
+		if got := permanentScrobbleError(err); got != tt.permanent {
+			t.Errorf("%d %s: permanent = %t, want %t (%s)", tt.status, tt.body, got, tt.permanent, err)
+		}
+		if e, ok := err.(*scrobbleError); !ok || e.config != tt.config {
+			t.Errorf("%d %s: config error = %t, want %t (%s)", tt.status, tt.body, ok && e.config, tt.config, err)
+		}
+	}
+}
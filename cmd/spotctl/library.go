@@ -0,0 +1,574 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+// libraryBatchSize is the maximum number of tracks per library request.
+const libraryBatchSize = 50
+
+var likeCmd = &cobra.Command{
+	Use:         "like [uri]...",
+	Short:       "Save the current track or the given tracks to your library",
+	RunE:        like,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserLibraryModify},
+}
+
+var unlikeCmd = &cobra.Command{
+	Use:         "unlike [uri]...",
+	Short:       "Remove the current track or the given tracks from your library",
+	RunE:        unlike,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserLibraryModify},
+}
+
+var likedCmd = &cobra.Command{
+	Use:         "liked? [uri]...",
+	Aliases:     []string{"liked"},
+	Short:       "Check whether the current track or the given tracks are in your library",
+	RunE:        liked,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserLibraryRead},
+}
+
+func like(cmd *cobra.Command, args []string) error {
+	ids, err := trackIDsOrCurrent(args)
+	if err != nil {
+		return err
+	}
+
+	return inBatches(len(ids), libraryBatchSize, func(start, end int) error {
+		return client.AddTracksToLibrary(ids[start:end]...)
+	})
+}
+
+func unlike(cmd *cobra.Command, args []string) error {
+	ids, err := trackIDsOrCurrent(args)
+	if err != nil {
+		return err
+	}
+
+	return inBatches(len(ids), libraryBatchSize, func(start, end int) error {
+		return client.RemoveTracksFromLibrary(ids[start:end]...)
+	})
+}
+
+func liked(cmd *cobra.Command, args []string) error {
+	ids, err := trackIDsOrCurrent(args)
+	if err != nil {
+		return err
+	}
+
+	saved, err := tracksInLibrary(ids)
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		uri := spotifyuri.Ref{Type: spotifyuri.Track, ID: string(id)}.URI()
+		if saved[i] {
+			fmt.Printf("♥ %s is in your library.\n", uri)
+		} else {
+			fmt.Printf("  %s is not in your library.\n", uri)
+		}
+	}
+
+	return nil
+}
+
+// tracksInLibrary reports for each track whether it's saved in the library.
+func tracksInLibrary(ids []spotify.ID) ([]bool, error) {
+	var saved []bool
+
+	err := inBatches(len(ids), libraryBatchSize, func(start, end int) error {
+		batch, err := client.UserHasTracks(ids[start:end]...)
+		saved = append(saved, batch...)
+		return err
+	})
+
+	return saved, err
+}
+
+// trackIDsOrCurrent parses the track URIs, URLs or IDs of args, or returns
+// the currently playing track if args is empty.
+func trackIDsOrCurrent(args []string) ([]spotify.ID, error) {
+	if len(args) == 0 {
+		state, err := client.PlayerState()
+		if err != nil {
+			return nil, err
+		}
+		if state.Item == nil {
+			return nil, errors.New("nothing is currently playing")
+		}
+
+		return []spotify.ID{state.Item.ID}, nil
+	}
+
+	ids := make([]spotify.ID, len(args))
+	for i, arg := range args {
+		ref, err := spotifyuri.ParseAs(arg, spotifyuri.Track)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = spotify.ID(ref.ID)
+	}
+
+	return ids, nil
+}
+
+// inBatches calls f with the bounds of consecutive batches of up to size
+// items out of n.
+func inBatches(n, size int, f func(start, end int) error) error {
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+
+		if err := f(start, end); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	libraryCmdFlagAddedAfter  string
+	libraryCmdFlagAddedBefore string
+	libraryCmdFlagArtist      string
+	libraryCmdFlagYear        string
+	libraryCmdFlagSort        string
+	libraryCmdFlagReverse     bool
+	libraryCmdFlagLimit       int
+	libraryCmdFlagOutput      string
+	libraryCmdFlagPlay        int
+)
+
+var libraryCmd = &cobra.Command{
+	Use:   "library",
+	Short: "List the tracks, albums and artists in your library",
+	Long:  `List the saved tracks, saved albums or followed artists in your library. The items can be filtered by when they were added, by artist and by release year, sorted, and printed as a table, JSON or URIs. With --play N, the Nth listed item is played.`,
+}
+
+var libraryTracksCmd = &cobra.Command{
+	Use:         "tracks",
+	Short:       "List your saved tracks",
+	Args:        cobra.NoArgs,
+	RunE:        libraryTracks,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserLibraryRead},
+}
+
+var libraryAlbumsCmd = &cobra.Command{
+	Use:         "albums",
+	Short:       "List your saved albums",
+	Args:        cobra.NoArgs,
+	RunE:        libraryAlbums,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserLibraryRead},
+}
+
+var libraryArtistsCmd = &cobra.Command{
+	Use:         "artists",
+	Short:       "List the artists you follow",
+	Args:        cobra.NoArgs,
+	RunE:        libraryArtists,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserFollowRead},
+}
+
+// libraryItem is a saved track or album or a followed artist.
+type libraryItem struct {
+	searchItem
+	ISRC    string `json:"isrc,omitempty"`
+	AddedAt string `json:"added_at,omitempty"`
+	// AddedBy is the ID of the user who added a playlist track.
+	AddedBy string `json:"added_by,omitempty"`
+}
+
+func (i libraryItem) columns() []string {
+	added := i.AddedAt
+	if t, err := time.Parse(time.RFC3339, i.AddedAt); err == nil {
+		added = t.Local().Format("2006-01-02")
+	}
+
+	return append(i.searchItem.columns()[1:], added)
+}
+
+var libraryItemHeader = append(append([]string{}, searchItemHeader[1:]...), "ADDED")
+
+// librarySortKeys maps the --sort keys to functions reporting whether a
+// sorts before b.
+var librarySortKeys = map[string]func(a, b libraryItem) bool{
+	"added": func(a, b libraryItem) bool { return a.AddedAt > b.AddedAt },
+	"name":  func(a, b libraryItem) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"artist": func(a, b libraryItem) bool {
+		return strings.ToLower(strings.Join(a.Artists, ", ")) < strings.ToLower(strings.Join(b.Artists, ", "))
+	},
+	"album":      func(a, b libraryItem) bool { return strings.ToLower(a.Album) < strings.ToLower(b.Album) },
+	"year":       func(a, b libraryItem) bool { return a.Year < b.Year },
+	"duration":   func(a, b libraryItem) bool { return a.Duration < b.Duration },
+	"popularity": func(a, b libraryItem) bool { return a.Popularity > b.Popularity },
+}
+
+// libraryFilter narrows down library items. Zero values match everything.
+type libraryFilter struct {
+	addedAfter  time.Time
+	addedBefore time.Time
+	artist      string
+	fromYear    int
+	toYear      int
+}
+
+// newLibraryFilter parses the filter flags. The added-at and year filters
+// only apply to saved tracks and albums.
+func newLibraryFilter(addedAt, year bool) (libraryFilter, error) {
+	var (
+		f   libraryFilter
+		err error
+	)
+
+	if !addedAt && (libraryCmdFlagAddedAfter != "" || libraryCmdFlagAddedBefore != "") {
+		return f, errors.New("followed artists can't be filtered by when they were added")
+	}
+	if !year && libraryCmdFlagYear != "" {
+		return f, errors.New("followed artists can't be filtered by year")
+	}
+
+	if libraryCmdFlagAddedAfter != "" {
+		if f.addedAfter, err = parseDate(libraryCmdFlagAddedAfter); err != nil {
+			return f, err
+		}
+	}
+	if libraryCmdFlagAddedBefore != "" {
+		if f.addedBefore, err = parseDate(libraryCmdFlagAddedBefore); err != nil {
+			return f, err
+		}
+	}
+	if libraryCmdFlagYear != "" {
+		if f.fromYear, f.toYear, err = parseYearRange(libraryCmdFlagYear); err != nil {
+			return f, err
+		}
+	}
+	f.artist = strings.ToLower(libraryCmdFlagArtist)
+
+	return f, nil
+}
+
+// matchAdded reports whether the item matches the added-at and artist
+// filters, which don't need the release year.
+func (f libraryFilter) matchAdded(i libraryItem) bool {
+	if !f.addedAfter.IsZero() || !f.addedBefore.IsZero() {
+		added, err := time.Parse(time.RFC3339, i.AddedAt)
+		if err != nil {
+			return false
+		}
+		if !f.addedAfter.IsZero() && added.Before(f.addedAfter) {
+			return false
+		}
+		if !f.addedBefore.IsZero() && !added.Before(f.addedBefore) {
+			return false
+		}
+	}
+
+	if f.artist != "" {
+		names := i.Artists
+		if i.Type == "artist" {
+			names = []string{i.Name}
+		}
+
+		found := false
+		for _, name := range names {
+			if strings.Contains(strings.ToLower(name), f.artist) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchYear reports whether the item was released in the year range.
+func (f libraryFilter) matchYear(i libraryItem) bool {
+	if f.fromYear == 0 {
+		return true
+	}
+
+	year, err := strconv.Atoi(i.Year)
+	return err == nil && year >= f.fromYear && year <= f.toYear
+}
+
+func libraryTracks(cmd *cobra.Command, args []string) error {
+	filter, err := newLibraryFilter(true, true)
+	if err != nil {
+		return err
+	}
+
+	var items []libraryItem
+	err = allPages(func(opt *spotify.Options) (bool, error) {
+		page, err := client.CurrentUsersTracksOpt(opt)
+		if err != nil {
+			return false, err
+		}
+
+		for _, t := range page.Tracks {
+			if item := trackItem(t.FullTrack, t.AddedAt); filter.matchAdded(item) {
+				items = append(items, item)
+			}
+		}
+
+		return page.Next != "", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// release years aren't part of saved tracks, so only look them up for
+	// the tracks left after the other filters
+	if err := fillLibraryYears(items); err != nil {
+		return err
+	}
+
+	return listLibrary(filterLibraryYear(items, filter))
+}
+
+func libraryAlbums(cmd *cobra.Command, args []string) error {
+	filter, err := newLibraryFilter(true, true)
+	if err != nil {
+		return err
+	}
+
+	var items []libraryItem
+	err = allPages(func(opt *spotify.Options) (bool, error) {
+		page, err := client.CurrentUsersAlbumsOpt(opt)
+		if err != nil {
+			return false, err
+		}
+
+		for _, a := range page.Albums {
+			item := libraryItem{
+				searchItem: searchItem{
+					Type:       "album",
+					Name:       a.Name,
+					Artists:    artistNames(a.Artists),
+					Popularity: a.Popularity,
+					URI:        a.URI,
+				},
+				AddedAt: a.AddedAt,
+			}
+			if len(a.ReleaseDate) >= 4 {
+				item.Year = a.ReleaseDate[:4]
+			}
+			for _, t := range a.Tracks.Tracks {
+				item.Duration += t.Duration
+			}
+
+			if filter.matchAdded(item) {
+				items = append(items, item)
+			}
+		}
+
+		return page.Next != "", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return listLibrary(filterLibraryYear(items, filter))
+}
+
+func libraryArtists(cmd *cobra.Command, args []string) error {
+	filter, err := newLibraryFilter(false, false)
+	if err != nil {
+		return err
+	}
+
+	var (
+		items []libraryItem
+		after string
+	)
+	err = allPages(func(opt *spotify.Options) (bool, error) {
+		page, err := client.CurrentUsersFollowedArtistsOpt(*opt.Limit, after)
+		if err != nil {
+			return false, err
+		}
+
+		for _, a := range page.Artists {
+			item := libraryItem{
+				searchItem: searchItem{
+					Type:       "artist",
+					Name:       a.Name,
+					Popularity: a.Popularity,
+					URI:        a.URI,
+				},
+			}
+			if filter.matchAdded(item) {
+				items = append(items, item)
+			}
+		}
+
+		after = page.Cursor.After
+		return page.Next != "" && after != "", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return listLibrary(items)
+}
+
+// fillLibraryYears fills in the release year of the tracks of items.
+func fillLibraryYears(items []libraryItem) error {
+	search := make([]searchItem, len(items))
+	for i, item := range items {
+		search[i] = item.searchItem
+	}
+
+	if err := fillAlbumDetails(search); err != nil {
+		return err
+	}
+
+	for i := range items {
+		items[i].searchItem = search[i]
+	}
+
+	return nil
+}
+
+func filterLibraryYear(items []libraryItem, f libraryFilter) []libraryItem {
+	var filtered []libraryItem
+	for _, item := range items {
+		if f.matchYear(item) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return filtered
+}
+
+// listLibrary sorts and prints items, or plays one of them with --play.
+func listLibrary(items []libraryItem) error {
+	if libraryCmdFlagSort != "" {
+		less, ok := librarySortKeys[libraryCmdFlagSort]
+		if !ok {
+			return fmt.Errorf("unsupported sort key %s", libraryCmdFlagSort)
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			return less(items[i], items[j])
+		})
+	}
+
+	if libraryCmdFlagReverse {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	if libraryCmdFlagLimit > 0 && len(items) > libraryCmdFlagLimit {
+		items = items[:libraryCmdFlagLimit]
+	}
+
+	if libraryCmdFlagPlay != 0 {
+		return playLibraryItem(items, libraryCmdFlagPlay)
+	}
+
+	return printLibraryItems(items, libraryCmdFlagOutput)
+}
+
+// printLibraryItems prints items numbered from 1 in the output format.
+func printLibraryItems(items []libraryItem, output string) error {
+	switch output {
+	case outputTable:
+		rows := make([][]string, len(items))
+		for i, item := range items {
+			rows[i] = append(append([]string{strconv.Itoa(i + 1)}, item.columns()...), string(item.URI))
+		}
+		return printTable(append(append([]string{"#"}, libraryItemHeader...), "URI"), rows)
+	case outputJSON:
+		if items == nil {
+			items = []libraryItem{}
+		}
+		return printJSON(items)
+	case outputURI:
+		for _, item := range items {
+			fmt.Println(item.URI)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %s", output)
+	}
+}
+
+// playLibraryItem plays the nth item, counting from 1. A track is followed
+// by the tracks listed after it.
+func playLibraryItem(items []libraryItem, n int) error {
+	if n < 1 || n > len(items) {
+		return fmt.Errorf("can't play item %d, there are %d items", n, len(items))
+	}
+
+	ref, err := spotifyuri.Parse(string(items[n-1].URI))
+	if err != nil {
+		return err
+	}
+
+	opt := playByID(ref)
+	if ref.Type == spotifyuri.Track {
+		for _, item := range items[n:] {
+			if len(opt.URIs) == maxPlayURIs {
+				break
+			}
+			opt.URIs = append(opt.URIs, item.URI)
+		}
+	}
+	opt.DeviceID = findDeviceByName(deviceNameFlag)
+
+	return client.PlayOpt(opt)
+}
+
+// parseDate parses a date such as 2018-01-31 in the local time zone, or an
+// RFC 3339 time.
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q, expected a date such as 2018-01-31", s)
+	}
+
+	return t, nil
+}
+
+// parseYearRange parses a year such as 1999 or a range of years such as
+// 1990-1999.
+func parseYearRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid year %q, expected a year such as 1999 or a range such as 1990-1999", s)
+	}
+
+	to := from
+	if len(parts) == 2 {
+		if to, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return 0, 0, fmt.Errorf("invalid year %q, expected a year such as 1999 or a range such as 1990-1999", s)
+		}
+	}
+
+	if to < from {
+		return 0, 0, fmt.Errorf("invalid year range %q, %d is after %d", s, from, to)
+	}
+
+	return from, to, nil
+}
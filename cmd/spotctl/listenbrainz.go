@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+)
+
+const (
+	listenBrainzBaseURL   = "https://api.listenbrainz.org/"
+	listenBrainzBatchSize = 100
+)
+
+// listenBrainzConfig configures a service speaking the ListenBrainz API.
+type listenBrainzConfig struct {
+	BaseURL string `json:"base_url,omitempty"`
+	Token   string `json:"token"`
+}
+
+// listenBrainz scrobbles with the ListenBrainz JSON API.
+type listenBrainz struct {
+	config listenBrainzConfig
+}
+
+// listenBrainzListen is a listen as submitted to ListenBrainz. Now playing
+// listens have no time.
+type listenBrainzListen struct {
+	ListenedAt    int64                     `json:"listened_at,omitempty"`
+	TrackMetadata listenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type listenBrainzTrackMetadata struct {
+	ArtistName     string                 `json:"artist_name"`
+	TrackName      string                 `json:"track_name"`
+	ReleaseName    string                 `json:"release_name,omitempty"`
+	AdditionalInfo map[string]interface{} `json:"additional_info"`
+}
+
+func newListenBrainz(c listenBrainzConfig) (*listenBrainz, error) {
+	if c.Token == "" {
+		return nil, errors.New("the listenbrainz scrobble config needs a token")
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = listenBrainzBaseURL
+	}
+	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/") + "/"
+
+	return &listenBrainz{config: c}, nil
+}
+
+func (l *listenBrainz) name() string {
+	return "listenbrainz"
+}
+
+func (l *listenBrainz) batchSize() int {
+	return listenBrainzBatchSize
+}
+
+func (l *listenBrainz) submit(ss []scrobble) error {
+	listens := make([]listenBrainzListen, len(ss))
+	for i, s := range ss {
+		listens[i] = newListenBrainzListen(s)
+		listens[i].ListenedAt = s.StartedAt.Unix()
+	}
+
+	listenType := "import"
+	if len(listens) == 1 {
+		listenType = "single"
+	}
+
+	return l.post(listenType, listens)
+}
+
+func (l *listenBrainz) nowPlaying(s scrobble) error {
+	return l.post("playing_now", []listenBrainzListen{newListenBrainzListen(s)})
+}
+
+func newListenBrainzListen(s scrobble) listenBrainzListen {
+	info := map[string]interface{}{
+		"media_player":              "Spotify",
+		"music_service":             "spotify.com",
+		"submission_client":         "spotctl",
+		"submission_client_version": version,
+	}
+	if s.Duration > 0 {
+		info["duration_ms"] = s.Duration
+	}
+	if ref, err := spotifyuri.Parse(string(s.URI)); err == nil {
+		info["spotify_id"] = ref.URL()
+		info["origin_url"] = ref.URL()
+	}
+
+	return listenBrainzListen{
+		TrackMetadata: listenBrainzTrackMetadata{
+			ArtistName:     s.Artist,
+			TrackName:      s.Track,
+			ReleaseName:    s.Album,
+			AdditionalInfo: info,
+		},
+	}
+}
+
+// post submits listens of a type: single, import or playing_now.
+func (l *listenBrainz) post(listenType string, listens []listenBrainzListen) error {
+	body, err := json.Marshal(struct {
+		ListenType string               `json:"listen_type"`
+		Payload    []listenBrainzListen `json:"payload"`
+	}{listenType, listens})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", l.config.BaseURL+"1/submit-listens", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+l.config.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := scrobbleHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg := resp.Status
+
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			msg = e.Error
+		}
+
+		// bad requests fail the same way every time, and so does an invalid
+		// token until the config file is fixed
+		return &scrobbleError{
+			service:   l.name(),
+			msg:       msg,
+			temporary: resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnauthorized,
+			config:    resp.StatusCode == http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// listenBrainzRequest is a submission as the server sees it.
+type listenBrainzRequest struct {
+	ListenType string `json:"listen_type"`
+	Payload    []struct {
+		ListenedAt    *int64 `json:"listened_at"`
+		TrackMetadata struct {
+			ArtistName     string                 `json:"artist_name"`
+			TrackName      string                 `json:"track_name"`
+			ReleaseName    string                 `json:"release_name"`
+			AdditionalInfo map[string]interface{} `json:"additional_info"`
+		} `json:"track_metadata"`
+	} `json:"payload"`
+}
+
+// newTestListenBrainz returns a listenBrainz posting to a test server that
+// records the last request and responds with status and body.
+func newTestListenBrainz(t *testing.T, status int, body string) (*listenBrainz, *listenBrainzRequest, func()) {
+	var req listenBrainzRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/1/submit-listens" {
+			t.Errorf("request %s %s, want POST /1/submit-listens", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Token token" {
+			t.Errorf("authorization %q, want %q", got, "Token token")
+		}
+		req = listenBrainzRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+
+	// the base URL works with or without a trailing slash
+	l, err := newListenBrainz(listenBrainzConfig{BaseURL: server.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l, &req, server.Close
+}
+
+func TestListenBrainzSubmit(t *testing.T) {
+	l, req, close := newTestListenBrainz(t, http.StatusOK, `{"status": "ok"}`)
+	defer close()
+
+	getLucky := scrobble{
+		StartedAt: time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC),
+		URI:       "spotify:track:69kOkLUCkxIZYexIgSG8rq",
+		Track:     "Get Lucky",
+		Artist:    "Daft Punk",
+		Album:     "Random Access Memories",
+		Duration:  369626,
+	}
+	soWhat := scrobble{
+		StartedAt: time.Date(2024, time.June, 15, 12, 5, 0, 0, time.UTC),
+		Track:     "So What",
+		Artist:    "Miles Davis",
+	}
+
+	if err := l.submit([]scrobble{getLucky}); err != nil {
+		t.Fatal(err)
+	}
+	if req.ListenType != "single" || len(req.Payload) != 1 {
+		t.Fatalf("submitted %s of %d listens, want single of 1", req.ListenType, len(req.Payload))
+	}
+
+	p := req.Payload[0]
+	if p.ListenedAt == nil || *p.ListenedAt != 1718452800 {
+		t.Errorf("listened_at = %v, want 1718452800", p.ListenedAt)
+	}
+	m := p.TrackMetadata
+	if m.ArtistName != "Daft Punk" || m.TrackName != "Get Lucky" || m.ReleaseName != "Random Access Memories" {
+		t.Errorf("track_metadata = %+v", m)
+	}
+	wantInfo := map[string]interface{}{
+		"media_player":              "Spotify",
+		"music_service":             "spotify.com",
+		"submission_client":         "spotctl",
+		"submission_client_version": version,
+		"duration_ms":               float64(369626),
+		"spotify_id":                "https://open.spotify.com/track/69kOkLUCkxIZYexIgSG8rq",
+		"origin_url":                "https://open.spotify.com/track/69kOkLUCkxIZYexIgSG8rq",
+	}
+	if !reflect.DeepEqual(m.AdditionalInfo, wantInfo) {
+		t.Errorf("additional_info = %v, want %v", m.AdditionalInfo, wantInfo)
+	}
+
+	if err := l.submit([]scrobble{getLucky, soWhat}); err != nil {
+		t.Fatal(err)
+	}
+	if req.ListenType != "import" || len(req.Payload) != 2 {
+		t.Fatalf("submitted %s of %d listens, want import of 2", req.ListenType, len(req.Payload))
+	}
+	if p := req.Payload[1]; p.ListenedAt == nil || *p.ListenedAt != 1718453100 || p.TrackMetadata.TrackName != "So What" {
+		t.Errorf("second listen = %+v", p)
+	}
+	// unknown durations and tracks without URI are left out
+	for _, name := range []string{"duration_ms", "spotify_id", "origin_url"} {
+		if v, ok := req.Payload[1].TrackMetadata.AdditionalInfo[name]; ok {
+			t.Errorf("%s = %v, want none", name, v)
+		}
+	}
+}
+
+func TestListenBrainzNowPlaying(t *testing.T) {
+	l, req, close := newTestListenBrainz(t, http.StatusOK, `{"status": "ok"}`)
+	defer close()
+
+	s := scrobble{
+		StartedAt: time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC),
+		Track:     "So What",
+		Artist:    "Miles Davis",
+	}
+	if err := l.nowPlaying(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if req.ListenType != "playing_now" || len(req.Payload) != 1 {
+		t.Fatalf("submitted %s of %d listens, want playing_now of 1", req.ListenType, len(req.Payload))
+	}
+	if p := req.Payload[0]; p.ListenedAt != nil {
+		t.Errorf("listened_at = %d, want none", *p.ListenedAt)
+	}
+}
+
+func TestListenBrainzErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		body      string
+		msg       string
+		permanent bool
+	}{
+		{http.StatusBadRequest, `{"code": 400, "error": "JSON document is invalid"}`, "listenbrainz: JSON document is invalid", true},
+		{http.StatusUnauthorized, `{"code": 401, "error": "Invalid authorization token."}`, "listenbrainz: Invalid authorization token.", false},
+		{http.StatusTooManyRequests, ``, "listenbrainz: 429 Too Many Requests", false},
+		{http.StatusServiceUnavailable, `<html>down</html>`, "listenbrainz: 503 Service Unavailable", false},
+	}
+
+	for _, tt := range tests {
+		l, _, close := newTestListenBrainz(t, tt.status, tt.body)
+		err := l.submit([]scrobble{{Track: "So What", Artist: "Miles Davis"}})
+		close()
+
+		if err == nil {
+			t.Errorf("%d: submit succeeded", tt.status)
+			continue
+		}
+		if err.Error() != tt.msg {
+			t.Errorf("%d: error %q, want %q", tt.status, err, tt.msg)
+		}
+		if got := permanentScrobbleError(err); got != tt.permanent {
+			t.Errorf("%d: permanent = %t, want %t", tt.status, got, tt.permanent)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+const (
+	listensFile   = "listens.jsonl"
+	logRunnerFile = "log-runner.json"
+
+	// listenEndTolerance is how far from its end a track may be left and
+	// still count as played to the end, to allow for crossfades.
+	listenEndTolerance = 10 * time.Second
+
+	// listenDrift is how much further than the time that passed a track may
+	// move between samples without counting as a seek, since the progress
+	// and the time of a sample aren't read at once.
+	listenDrift = 2 * time.Second
+)
+
+var (
+	logCmdFlagInterval time.Duration
+	logCmdFlagDetach   bool
+	logCmdFlagScrobble bool
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Log the tracks you play, skip and finish",
+	Long: `Watch the player and log every track you play to ~/.spotctl.d/listens.jsonl, with the time listened, the completion ratio and whether it was skipped, which the history Spotify keeps doesn't tell.
+
+The player is polled every --interval. Pauses and seeks don't count as listening, and a track on repeat is logged once per play. When the player can't be reached for a while, the time in between isn't counted and the track playing isn't reported as skipped.
+
+With --scrobble, the plays are scrobbled too, see "spotctl scrobble --help".`,
+	Args: cobra.NoArgs,
+	RunE: logListens,
+}
+
+// listenRecord is a play of a track in the listening log.
+type listenRecord struct {
+	StartedAt  time.Time   `json:"started_at"`
+	URI        spotify.URI `json:"uri"`
+	Name       string      `json:"name"`
+	Artists    []string    `json:"artists,omitempty"`
+	Album      string      `json:"album,omitempty"`
+	Duration   int         `json:"duration_ms"`
+	Listened   int         `json:"listened_ms"`
+	Completion float64     `json:"completion"`
+	Skipped    bool        `json:"skipped"`
+	Device     string      `json:"device,omitempty"`
+	ContextURI spotify.URI `json:"context_uri,omitempty"`
+}
+
+// listenSample is the state of the player at a point in time. A sample
+// without URI means that nothing is playing.
+type listenSample struct {
+	at         time.Time
+	playing    bool
+	uri        spotify.URI
+	name       string
+	artists    []string
+	album      string
+	duration   int
+	progress   int
+	device     string
+	contextURI spotify.URI
+}
+
+func newListenSample(at time.Time, state *spotify.PlayerState) listenSample {
+	s := listenSample{at: at}
+	if state == nil || state.Item == nil {
+		return s
+	}
+
+	s.playing = state.Playing
+	s.uri = state.Item.URI
+	s.name = state.Item.Name
+	s.artists = artistNames(state.Item.Artists)
+	s.album = state.Item.Album.Name
+	s.duration = state.Item.Duration
+	s.progress = state.Progress
+	s.device = state.Device.Name
+	s.contextURI = state.PlaybackContext.URI
+
+	return s
+}
+
+// listenTracker turns samples of the player into plays. Time is only counted
+// as listened when the samples around it show the track moving forward by
+// no more than the time that passed, so pauses and seeks aren't counted.
+// Samples further apart than maxGap, such as when the API couldn't be
+// reached, only count the progress they show.
+type listenTracker struct {
+	maxGap time.Duration
+	cur    *listenRecord
+	last   listenSample
+}
+
+// observe records a sample and returns the plays it completed.
+func (t *listenTracker) observe(s listenSample) []listenRecord {
+	if t.cur == nil {
+		if s.uri != "" {
+			t.start(s, 0)
+		}
+		t.last = s
+		return nil
+	}
+
+	last := t.last
+	t.last = s
+
+	elapsed := msBetween(last.at, s.at)
+	gap := s.at.Sub(last.at) > t.maxGap
+	// the track played from the last sample on, as far as we can tell
+	running := last.playing && !gap
+
+	if s.uri != t.cur.URI {
+		head := 0
+		if s.uri != "" && !gap {
+			head = minInt(s.progress, elapsed)
+		}
+
+		tail := 0
+		if running {
+			tail = clampInt(elapsed-head, 0, last.duration-last.progress)
+		}
+
+		// stopping, such as when the device went away, isn't a skip
+		skipped := s.uri != "" && !gap && last.progress+tail < last.duration-int(listenEndTolerance/time.Millisecond)
+		done := t.finish(tail, skipped)
+
+		t.cur = nil
+		if s.uri != "" {
+			t.start(s, head)
+		}
+
+		return []listenRecord{done}
+	}
+
+	delta := s.progress - last.progress
+
+	switch {
+	case delta < 0 && last.progress+elapsed >= last.duration-int(listenEndTolerance/time.Millisecond):
+		// the track ended and started over
+		tail, head := 0, 0
+		if running {
+			tail = clampInt(elapsed, 0, last.duration-last.progress)
+		}
+		if !gap {
+			head = clampInt(s.progress, 0, elapsed-tail)
+		}
+
+		done := t.finish(tail, false)
+		t.start(s, head)
+
+		return []listenRecord{done}
+	case delta >= 0 && delta <= elapsed+int(listenDrift/time.Millisecond):
+		// the track moved forward, paused or not, by about the time that
+		// passed
+		t.cur.Listened += minInt(delta, elapsed)
+	case running && s.playing:
+		// a seek while playing
+		t.cur.Listened += elapsed
+	}
+
+	return nil
+}
+
+// flush returns the play in progress, if any was listened to, counting it
+// as listened up to at.
+func (t *listenTracker) flush(at time.Time) []listenRecord {
+	if t.cur == nil {
+		return nil
+	}
+
+	tail := 0
+	if t.last.playing && at.Sub(t.last.at) <= t.maxGap {
+		tail = clampInt(msBetween(t.last.at, at), 0, t.last.duration-t.last.progress)
+	}
+
+	done := t.finish(tail, false)
+	t.cur = nil
+	if done.Listened == 0 {
+		return nil
+	}
+
+	return []listenRecord{done}
+}
+
+// start starts a play with head milliseconds of it already listened.
+func (t *listenTracker) start(s listenSample, head int) {
+	t.cur = &listenRecord{
+		StartedAt:  s.at.Add(-time.Duration(s.progress) * time.Millisecond),
+		URI:        s.uri,
+		Name:       s.name,
+		Artists:    s.artists,
+		Album:      s.album,
+		Duration:   s.duration,
+		Listened:   head,
+		Device:     s.device,
+		ContextURI: s.contextURI,
+	}
+}
+
+// finish completes the current play with tail more milliseconds listened.
+func (t *listenTracker) finish(tail int, skipped bool) listenRecord {
+	r := *t.cur
+	r.Listened += tail
+	r.Skipped = skipped
+	if r.Duration > 0 {
+		r.Completion = float64(r.Listened) / float64(r.Duration)
+		if r.Completion > 1 {
+			r.Completion = 1
+		}
+	}
+
+	return r
+}
+
+func msBetween(from, to time.Time) int {
+	return int(to.Sub(from) / time.Millisecond)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func clampInt(n, lo, hi int) int {
+	if n > hi {
+		n = hi
+	}
+	if n < lo {
+		n = lo
+	}
+
+	return n
+}
+
+// readListens reads the listening log. A missing log is empty.
+func readListens() ([]listenRecord, error) {
+	path, err := dataFilePath(listensFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []listenRecord
+	err = readJSONLines(path, func(line []byte) error {
+		var r listenRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		records = append(records, r)
+		return nil
+	})
+
+	return records, err
+}
+
+// appendListens appends plays to the listening log.
+func appendListens(records []listenRecord) error {
+	path, err := dataFilePath(listensFile)
+	if err != nil {
+		return err
+	}
+
+	lines := make([]interface{}, len(records))
+	for i, r := range records {
+		lines[i] = r
+	}
+
+	return appendJSONLines(path, lines)
+}
+
+func logListens(cmd *cobra.Command, args []string) error {
+	if logCmdFlagInterval < time.Second {
+		return errors.New("--interval must be at least 1s")
+	}
+
+	path, err := dataFilePath(logRunnerFile)
+	if err != nil {
+		return err
+	}
+
+	var runnerState struct {
+		PID int `json:"pid,omitempty"`
+	}
+	if err := readJSONFile(path, &runnerState); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if runnerState.PID != 0 && runnerState.PID != os.Getpid() && processAlive(runnerState.PID) {
+		return fmt.Errorf("plays are already being logged (pid %d)", runnerState.PID)
+	}
+
+	if logCmdFlagDetach {
+		args := []string{"log", "--interval", logCmdFlagInterval.String()}
+		if logCmdFlagScrobble {
+			args = append(args, "--scrobble")
+		}
+
+		pid, err := startDetached(args...)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Logging plays in the background (pid %d).\n", pid)
+		return nil
+	}
+
+	runnerState.PID = os.Getpid()
+	if err := writeJSONFile(path, runnerState); err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	cancel := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		<-sig
+		close(cancel)
+	}()
+
+	c := realClock{}
+
+	var scrobbler *liveScrobbler
+	if logCmdFlagScrobble {
+		var err error
+		if scrobbler, err = newLiveScrobbler(c.Now()); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Logging plays. Press Ctrl-C to stop.")
+
+	return watchListens(c, playerState, logCmdFlagInterval, scrobbler, cancel)
+}
+
+// watchListens samples the player every interval with poll and logs and
+// scrobbles the plays, if scrobbler isn't nil, until cancel is closed.
+func watchListens(c clock, poll func() (*spotify.PlayerState, error), interval time.Duration, scrobbler *liveScrobbler, cancel <-chan struct{}) error {
+	tracker := &listenTracker{maxGap: 3 * interval}
+
+	for {
+		// a failed poll is left out, which shows up as a gap between samples
+		if state, err := poll(); err == nil {
+			sample := newListenSample(c.Now(), state)
+
+			done := tracker.observe(sample)
+			if err := logRecords(done); err != nil {
+				return err
+			}
+			if scrobbler != nil {
+				scrobbler.update(sample.at, done, tracker.cur, sample.playing)
+			}
+		}
+
+		if !sleepUntil(c, c.Now().Add(interval), cancel) {
+			break
+		}
+	}
+
+	now := c.Now()
+	done := tracker.flush(now)
+	if scrobbler != nil {
+		scrobbler.update(now, done, nil, false)
+	}
+
+	return logRecords(done)
+}
+
+// logRecords appends plays to the listening log and prints them.
+func logRecords(records []listenRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := appendListens(records); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		verb := "Played"
+		if r.Skipped {
+			verb = "Skipped"
+		}
+		fmt.Printf("%s %s %q by %s, %s of %s (%.0f%%).\n", r.StartedAt.Local().Format(time.Stamp), verb, r.Name, strings.Join(r.Artists, ", "), durationToStr(r.Listened), durationToStr(r.Duration), r.Completion*100)
+	}
+
+	return nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+var listenStart = time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+// playing is a sample of uri playing at progress, both in seconds.
+func playing(at int, uri spotify.URI, progress, duration int) listenSample {
+	return listenSample{
+		at:       listenStart.Add(time.Duration(at) * time.Second),
+		playing:  true,
+		uri:      uri,
+		duration: duration * 1000,
+		progress: progress * 1000,
+	}
+}
+
+// paused is a sample of uri paused at progress, both in seconds.
+func paused(at int, uri spotify.URI, progress, duration int) listenSample {
+	s := playing(at, uri, progress, duration)
+	s.playing = false
+	return s
+}
+
+// stopped is a sample of nothing playing.
+func stopped(at int) listenSample {
+	return listenSample{at: listenStart.Add(time.Duration(at) * time.Second)}
+}
+
+func TestListenTracker(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []listenSample
+		// flush is when the tracker is flushed, in seconds
+		flush int
+		want  []listenRecord
+	}{
+		{
+			name: "played to the end",
+			samples: []listenSample{
+				playing(0, "a", 0, 90),
+				playing(30, "a", 30, 90),
+				playing(60, "a", 60, 90),
+				playing(95, "b", 5, 100),
+			},
+			flush: 100,
+			want: []listenRecord{
+				{URI: "a", Listened: 90000, Completion: 1},
+				{URI: "b", Listened: 10000, Completion: 0.1},
+			},
+		},
+		{
+			name: "skipped",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				playing(30, "a", 30, 200),
+				playing(40, "b", 2, 100),
+			},
+			flush: 40,
+			want: []listenRecord{
+				{URI: "a", Listened: 38000, Completion: 0.19, Skipped: true},
+				{URI: "b", Listened: 2000, Completion: 0.02},
+			},
+		},
+		{
+			name: "pause and resume",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				playing(30, "a", 30, 200),
+				paused(60, "a", 40, 200),
+				paused(90, "a", 40, 200),
+				playing(120, "a", 60, 200),
+			},
+			flush: 120,
+			want: []listenRecord{
+				{URI: "a", Listened: 60000, Completion: 0.3},
+			},
+		},
+		{
+			name: "forward seek",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				playing(30, "a", 30, 200),
+				playing(60, "a", 150, 200),
+			},
+			flush: 70,
+			want: []listenRecord{
+				{URI: "a", Listened: 70000, Completion: 0.35},
+			},
+		},
+		{
+			name: "backward seek",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				playing(30, "a", 30, 200),
+				playing(60, "a", 10, 200),
+			},
+			flush: 60,
+			want: []listenRecord{
+				{URI: "a", Listened: 60000, Completion: 0.3},
+			},
+		},
+		{
+			name: "forward seek while paused",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				paused(30, "a", 30, 200),
+				paused(60, "a", 150, 200),
+			},
+			flush: 60,
+			want: []listenRecord{
+				{URI: "a", Listened: 30000, Completion: 0.15},
+			},
+		},
+		{
+			name: "repeat one",
+			samples: []listenSample{
+				playing(0, "a", 0, 60),
+				playing(30, "a", 30, 60),
+				playing(70, "a", 10, 60),
+			},
+			flush: 80,
+			want: []listenRecord{
+				{URI: "a", Listened: 60000, Completion: 1},
+				{URI: "a", Listened: 20000, Completion: 1.0 / 3},
+			},
+		},
+		{
+			name: "gap longer than maxGap",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				playing(30, "a", 30, 200),
+				playing(150, "a", 100, 200),
+			},
+			flush: 150,
+			want: []listenRecord{
+				{URI: "a", Listened: 100000, Completion: 0.5},
+			},
+		},
+		{
+			name: "track change inside a gap",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				playing(30, "a", 30, 200),
+				playing(200, "b", 20, 100),
+			},
+			flush: 210,
+			want: []listenRecord{
+				{URI: "a", Listened: 30000, Completion: 0.15},
+				{URI: "b", Listened: 10000, Completion: 0.1},
+			},
+		},
+		{
+			name: "flush after a gap",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				playing(30, "a", 30, 200),
+			},
+			flush: 200,
+			want: []listenRecord{
+				{URI: "a", Listened: 30000, Completion: 0.15},
+			},
+		},
+		{
+			name: "stop",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				playing(30, "a", 30, 200),
+				stopped(60),
+			},
+			flush: 90,
+			want: []listenRecord{
+				{URI: "a", Listened: 60000, Completion: 0.3},
+			},
+		},
+		{
+			name: "pause and stop",
+			samples: []listenSample{
+				playing(0, "a", 0, 200),
+				paused(30, "a", 30, 200),
+				stopped(60),
+			},
+			flush: 60,
+			want: []listenRecord{
+				{URI: "a", Listened: 30000, Completion: 0.15},
+			},
+		},
+		{
+			name: "start after stop",
+			samples: []listenSample{
+				stopped(0),
+				playing(30, "a", 10, 200),
+				playing(60, "a", 40, 200),
+			},
+			flush: 60,
+			want: []listenRecord{
+				{URI: "a", Listened: 30000, Completion: 0.15},
+			},
+		},
+		{
+			name: "never listened",
+			samples: []listenSample{
+				paused(0, "a", 0, 200),
+				paused(30, "a", 0, 200),
+			},
+			flush: 60,
+		},
+		{
+			name: "nothing playing",
+			samples: []listenSample{
+				stopped(0),
+				stopped(30),
+			},
+			flush: 60,
+		},
+	}
+
+	for _, tt := range tests {
+		tracker := &listenTracker{maxGap: time.Minute}
+
+		var got []listenRecord
+		for _, s := range tt.samples {
+			got = append(got, tracker.observe(s)...)
+		}
+		got = append(got, tracker.flush(listenStart.Add(time.Duration(tt.flush)*time.Second))...)
+
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d plays %+v, want %d", tt.name, len(got), got, len(tt.want))
+			continue
+		}
+		for i, r := range got {
+			w := tt.want[i]
+			if r.URI != w.URI || r.Listened != w.Listened || r.Completion != w.Completion || r.Skipped != w.Skipped {
+				t.Errorf("%s: play %d is %s listened %d (%g) skipped %t, want %s listened %d (%g) skipped %t",
+					tt.name, i, r.URI, r.Listened, r.Completion, r.Skipped, w.URI, w.Listened, w.Completion, w.Skipped)
+			}
+		}
+	}
+}
+
+func TestListenTrackerStartedAt(t *testing.T) {
+	tracker := &listenTracker{maxGap: time.Minute}
+	tracker.observe(playing(30, "a", 10, 200))
+
+	got := tracker.flush(listenStart.Add(40 * time.Second))
+	if len(got) != 1 {
+		t.Fatalf("got %d plays, want 1", len(got))
+	}
+	if want := listenStart.Add(20 * time.Second); !got[0].StartedAt.Equal(want) {
+		t.Errorf("started at %s, want %s", got[0].StartedAt, want)
+	}
+}
+
+func TestListensLog(t *testing.T) {
+	dir, cleanup := useTempDataDir(t)
+	defer cleanup()
+
+	if records, err := readListens(); err != nil || len(records) != 0 {
+		t.Fatalf("readListens() = %v, %v, want no plays", records, err)
+	}
+
+	for _, uri := range []spotify.URI{"a", "b"} {
+		if err := appendListens([]listenRecord{{URI: uri, Listened: 1000}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := readListens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].URI != "a" || records[1].URI != "b" {
+		t.Errorf("readListens() = %+v, want a and b", records)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, listensFile), []byte("{}\n\nnot json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readListens(); err == nil {
+		t.Errorf("readListens() of a broken log succeeded")
+	}
+}
+
+func TestWatchListens(t *testing.T) {
+	const track = `{"is_playing": true, "progress_ms": %d, "item": {"uri": "spotify:track:a", "name": "A", "duration_ms": 200000}}`
+
+	tests := []struct {
+		name string
+		// responses are the status and body of each poll, 30s apart
+		responses []string
+		want      listenRecord
+	}{
+		{
+			// Spotify responds without content when no device is active
+			name:      "no device",
+			responses: []string{fmt.Sprintf(track, 0), fmt.Sprintf(track, 30000), "204", "204"},
+			want:      listenRecord{URI: "spotify:track:a", Listened: 60000, Completion: 0.3},
+		},
+		{
+			// failed polls are a gap, so the track is counted up to the end
+			name:      "failed polls",
+			responses: []string{fmt.Sprintf(track, 0), fmt.Sprintf(track, 30000), "500", "500"},
+			want:      listenRecord{URI: "spotify:track:a", Listened: 90000, Completion: 0.45},
+		},
+	}
+
+	for _, tt := range tests {
+		func() {
+			_, cleanup := useTempDataDir(t)
+			defer cleanup()
+
+			polls := 0
+			defer useTestAPI(func(w http.ResponseWriter, r *http.Request) {
+				resp := tt.responses[minInt(polls, len(tt.responses)-1)]
+				polls++
+				switch resp {
+				case "204":
+					w.WriteHeader(http.StatusNoContent)
+				case "500":
+					w.WriteHeader(http.StatusInternalServerError)
+				default:
+					w.Write([]byte(resp))
+				}
+			})()
+
+			cancel := make(chan struct{})
+			c := &fakeClock{now: listenStart, stopAt: listenStart.Add(100 * time.Second), cancel: cancel}
+			if err := watchListens(c, playerState, 30*time.Second, nil, cancel); err != nil {
+				t.Fatal(err)
+			}
+
+			if polls != 4 {
+				t.Errorf("%s: polled %d times, want 4", tt.name, polls)
+			}
+
+			records, err := readListens()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("%s: logged %d plays %+v, want 1", tt.name, len(records), records)
+			}
+			r, w := records[0], tt.want
+			if r.URI != w.URI || r.Listened != w.Listened || r.Completion != w.Completion || r.Skipped != w.Skipped {
+				t.Errorf("%s: logged %s listened %d (%g) skipped %t, want %s listened %d (%g) skipped %t",
+					tt.name, r.URI, r.Listened, r.Completion, r.Skipped, w.URI, w.Listened, w.Completion, w.Skipped)
+			}
+		}()
+	}
+}
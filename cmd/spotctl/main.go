@@ -8,6 +8,8 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/zmb3/spotify"
@@ -24,12 +26,21 @@ var (
 )
 
 var (
-	auth      spotify.Authenticator
-	token     *oauth2.Token
-	client    spotify.Client
-	tokenPath string
+	auth        spotify.Authenticator
+	token       *oauth2.Token
+	tokenScopes []string
+	client      spotify.Client
+	tokenPath   string
+	dataDir     string
 )
 
+// savedToken is the content of the token file. Scopes was added later, so
+// it's empty for tokens saved by earlier versions.
+type savedToken struct {
+	*oauth2.Token
+	Scopes []string `json:"scopes,omitempty"`
+}
+
 var rootCmd = &cobra.Command{
 	Use:               "spotctl",
 	Short:             "A command-line interface to Spotify.",
@@ -60,9 +71,36 @@ func main() {
 	rootCmd.AddCommand(repeatCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(playerCmd)
+	rootCmd.AddCommand(sleepCmd)
+	rootCmd.AddCommand(alarmCmd)
+	rootCmd.AddCommand(uriCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(likeCmd)
+	rootCmd.AddCommand(unlikeCmd)
+	rootCmd.AddCommand(likedCmd)
+	rootCmd.AddCommand(libraryCmd)
+	rootCmd.AddCommand(playlistCmd)
+	rootCmd.AddCommand(smartCmd)
+	rootCmd.AddCommand(radioCmd)
+	rootCmd.AddCommand(artistCmd)
+	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(logCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(scrobbleCmd)
+	rootCmd.AddCommand(topCmd)
 	rootCmd.AddCommand(versionCmd)
 
-	playCmd.PersistentFlags().StringVarP(&playCmdFlagType, "type", "t", "track", "the type of [name] to play: track, album, artist or playlist.")
+	playCmd.PersistentFlags().StringVarP(&playCmdFlagType, "type", "t", "auto", "the type of [name] to play: track, album, artist, playlist or auto for the best match.")
+	playCmd.PersistentFlags().BoolVar(&playCmdFlagExplain, "explain", false, "explain why the best match was chosen.")
+	playCmd.PersistentFlags().BoolVarP(&playCmdFlagInteractive, "interactive", "i", false, "pick what to play from a list of matches.")
+	playCmd.PersistentFlags().IntVar(&playCmdFlagLimit, "limit", 20, "the number of matches of each type to pick from with --interactive.")
+	playCmd.PersistentFlags().StringVarP(&playCmdFlagFile, "file", "f", "", "play the URIs, URLs or \"artist - title\" lines of this file.")
+	playCmd.PersistentFlags().IntVar(&playCmdFlagConcurrency, "concurrency", 8, "the number of lines of a list resolved at a time.")
+	playCmd.PersistentFlags().StringVar(&playCmdFlagMood, "mood", "", "play tracks for a mood: focus, chill, workout, party, sleep or one from the config file.")
+	playCmd.PersistentFlags().SetAnnotation("mood", scopesAnnotation, []string{spotify.ScopeUserTopRead})
+	playCmd.PersistentFlags().BoolVar(&playCmdFlagTopTracks, "top-tracks", false, "play the top tracks of an artist instead of the artist.")
+	playCmd.PersistentFlags().SetAnnotation("top-tracks", scopesAnnotation, []string{spotify.ScopeUserReadPrivate})
 	playCmd.PersistentFlags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
 	pauseCmd.PersistentFlags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
 	nextCmd.PersistentFlags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
@@ -72,6 +110,165 @@ func main() {
 	repeatCmd.PersistentFlags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
 	playerCmd.PersistentFlags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
 
+	sleepCmd.AddCommand(sleepStatusCmd)
+	sleepCmd.AddCommand(sleepCancelCmd)
+	sleepCmd.Flags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
+	sleepCmd.Flags().BoolVar(&sleepCmdFlagEndOfTrack, "end-of-track", false, "pause at the end of the current track")
+	sleepCmd.Flags().BoolVar(&sleepCmdFlagEndOfAlbum, "end-of-album", false, "pause at the end of the current album")
+	sleepCmd.Flags().DurationVar(&sleepCmdFlagFade, "fade", 30*time.Second, "fade out the volume over this duration before pausing")
+	sleepCmd.Flags().BoolVarP(&sleepCmdFlagDetach, "detach", "D", false, "run the timer in a background process")
+	sleepCmd.Flags().StringVar(&sleepCmdFlagDeadline, "deadline", "", "pause at this RFC 3339 time")
+	sleepCmd.Flags().MarkHidden("deadline")
+
+	alarmCmd.AddCommand(alarmAddCmd)
+	alarmCmd.AddCommand(alarmListCmd)
+	alarmCmd.AddCommand(alarmRemoveCmd)
+	alarmCmd.AddCommand(alarmRunCmd)
+	alarmAddCmd.Flags().StringVar(&alarmCmdFlagPlay, "play", "", "the Spotify URI or URL of the track, album, artist or playlist to play")
+	alarmAddCmd.Flags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
+	alarmAddCmd.Flags().StringVar(&alarmCmdFlagVolumeRamp, "volume-ramp", "", "the volume to play at, or a range such as 0-40 to ramp it up")
+	alarmAddCmd.Flags().DurationVar(&alarmCmdFlagOver, "over", time.Minute, "the duration of the volume ramp")
+	alarmRunCmd.Flags().DurationVar(&alarmCmdFlagGrace, "grace", 15*time.Minute, "fire alarms missed by no more than this duration")
+	alarmRunCmd.Flags().BoolVarP(&alarmCmdFlagDetach, "detach", "D", false, "run in a background process")
+
+	uriCmd.Flags().StringVar(&uriCmdFlagTo, "to", "uri", "the form to convert to: uri, url or id.")
+	uriCmd.Flags().StringVarP(&uriCmdFlagType, "type", "t", "", "the type of bare IDs: track, album, artist, playlist, show or episode.")
+
+	searchCmd.Flags().StringVarP(&searchCmdFlagType, "type", "t", "track", "the comma-separated types to search for: track, album, artist or playlist.")
+	searchCmd.Flags().IntVarP(&searchCmdFlagLimit, "limit", "l", 20, "the maximum number of results of each type.")
+	searchCmd.Flags().IntVar(&searchCmdFlagOffset, "offset", 0, "the index of the first result of each type.")
+	searchCmd.Flags().StringVar(&searchCmdFlagMarket, "market", "", "only return results playable in this country code, or from_token for your own country.")
+	searchCmd.Flags().StringVar(&searchCmdFlagArtist, "artist", "", "only return results by this artist.")
+	searchCmd.Flags().StringVar(&searchCmdFlagAlbum, "album", "", "only return results from this album.")
+	searchCmd.Flags().StringVar(&searchCmdFlagYear, "year", "", "only return results released in this year or range of years, such as 1990-1999.")
+	searchCmd.Flags().StringVar(&searchCmdFlagGenre, "genre", "", "only return results in this genre.")
+	searchCmd.Flags().BoolVar(&searchCmdFlagNew, "new", false, "only return albums released in the past two weeks.")
+	searchCmd.Flags().StringVarP(&searchCmdFlagOutput, "output", "o", outputTable, "the output format: table, json or uri.")
+
+	libraryCmd.AddCommand(libraryTracksCmd)
+	libraryCmd.AddCommand(libraryAlbumsCmd)
+	libraryCmd.AddCommand(libraryArtistsCmd)
+	libraryCmd.PersistentFlags().StringVar(&libraryCmdFlagAddedAfter, "added-after", "", "only list items added on or after this date, such as 2018-01-31.")
+	libraryCmd.PersistentFlags().StringVar(&libraryCmdFlagAddedBefore, "added-before", "", "only list items added before this date.")
+	libraryCmd.PersistentFlags().StringVar(&libraryCmdFlagArtist, "artist", "", "only list items by artists whose name contains this.")
+	libraryCmd.PersistentFlags().StringVar(&libraryCmdFlagYear, "year", "", "only list items released in this year or range of years, such as 1990-1999.")
+	libraryCmd.PersistentFlags().StringVarP(&libraryCmdFlagSort, "sort", "s", "", "sort by added, name, artist, album, year, duration or popularity.")
+	libraryCmd.PersistentFlags().BoolVarP(&libraryCmdFlagReverse, "reverse", "r", false, "reverse the order.")
+	libraryCmd.PersistentFlags().IntVarP(&libraryCmdFlagLimit, "limit", "l", 0, "the maximum number of items to list, or 0 for all.")
+	libraryCmd.PersistentFlags().StringVarP(&libraryCmdFlagOutput, "output", "o", outputTable, "the output format: table, json or uri.")
+	libraryCmd.PersistentFlags().IntVar(&libraryCmdFlagPlay, "play", 0, "play the Nth listed item instead of listing them.")
+	libraryCmd.PersistentFlags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
+
+	playlistCmd.AddCommand(playlistLsCmd)
+	playlistCmd.AddCommand(playlistShowCmd)
+	playlistCmd.AddCommand(playlistCreateCmd)
+	playlistCmd.AddCommand(playlistRenameCmd)
+	playlistCmd.AddCommand(playlistPublicCmd)
+	playlistCmd.AddCommand(playlistPrivateCmd)
+	playlistCmd.AddCommand(playlistAddCmd)
+	playlistCmd.AddCommand(playlistRmCmd)
+	playlistCmd.AddCommand(playlistMvCmd)
+	playlistCmd.AddCommand(playlistClearCmd)
+	playlistCmd.AddCommand(playlistDeleteCmd)
+	playlistCmd.AddCommand(playlistExportCmd)
+	playlistCmd.AddCommand(playlistImportCmd)
+	playlistCmd.AddCommand(playlistSnapshotCmd)
+	playlistCmd.AddCommand(playlistHistoryCmd)
+	playlistCmd.AddCommand(playlistDiffCmd)
+	playlistCmd.AddCommand(playlistRestoreCmd)
+	playlistCmd.AddCommand(playlistCombineCmd)
+	playlistCmd.AddCommand(playlistDedupeCmd)
+	playlistCmd.AddCommand(playlistSortCmd)
+	playlistCmd.AddCommand(playlistMixCmd)
+	playlistLsCmd.Flags().StringVarP(&playlistCmdFlagOutput, "output", "o", outputTable, "the output format: table, json or uri.")
+	playlistShowCmd.Flags().StringVarP(&playlistCmdFlagOutput, "output", "o", outputTable, "the output format: table, json or uri.")
+	playlistCreateCmd.Flags().BoolVar(&playlistCmdFlagPublic, "public", false, "make the playlist public.")
+	playlistMvCmd.Flags().IntVarP(&playlistCmdFlagCount, "count", "n", 1, "the number of tracks to move.")
+	playlistExportCmd.Flags().StringVar(&playlistExportCmdFlagFormat, "format", "", "the format: json, csv, m3u8 or xspf.")
+	playlistExportCmd.Flags().StringVarP(&playlistExportCmdFlagOutput, "output", "o", "", "the file to write to instead of stdout.")
+	playlistImportCmd.Flags().StringVar(&playlistImportCmdFlagFormat, "format", "", "the format of the file: json, csv, m3u8 or xspf.")
+	playlistImportCmd.Flags().StringVar(&playlistImportCmdFlagName, "name", "", "the name of the playlist, by default the name in the file.")
+	playlistImportCmd.Flags().StringVar(&playlistImportCmdFlagReport, "report", "", "the file to write the match report to, by default the file name with a .report.csv extension.")
+	playlistImportCmd.Flags().Float64Var(&playlistImportCmdFlagMinConfidence, "min-confidence", 0.7, "the minimum confidence between 0 and 1 of a search match to add it.")
+	playlistImportCmd.Flags().IntVar(&playlistImportCmdFlagConcurrency, "concurrency", 8, "the number of tracks matched at a time.")
+	playlistImportCmd.Flags().BoolVar(&playlistImportCmdFlagDryRun, "dry-run", false, "only write the match report.")
+	playlistCombineCmd.Flags().BoolVar(&playlistCombineCmdFlagUnion, "union", false, "take the tracks of all the playlists.")
+	playlistCombineCmd.Flags().BoolVar(&playlistCombineCmdFlagIntersect, "intersect", false, "take the tracks that are in every playlist.")
+	playlistCombineCmd.Flags().BoolVar(&playlistCombineCmdFlagSubtract, "subtract", false, "take the tracks of the first playlist that aren't in the others.")
+	playlistCombineCmd.Flags().StringVar(&playlistCombineCmdFlagInto, "into", "", "the playlist to write the tracks to.")
+	playlistCombineCmd.Flags().BoolVar(&playlistCombineCmdFlagDryRun, "dry-run", false, "only show how many tracks would be written.")
+	playlistDedupeCmd.Flags().BoolVar(&playlistDedupeCmdFlagLoose, "loose", false, "treat remasters, live recordings and other versions as duplicates.")
+	playlistDedupeCmd.Flags().BoolVar(&playlistDedupeCmdFlagDryRun, "dry-run", false, "only list the duplicates.")
+	playlistSortCmd.Flags().StringVar(&playlistSortCmdFlagBy, "by", "", "the comma-separated keys to sort by: tempo, energy, key, added_at, release_date, artist, popularity or duration, each optionally followed by :asc or :desc.")
+	playlistSortCmd.Flags().BoolVar(&playlistSortCmdFlagDesc, "desc", false, "sort keys in descending order by default.")
+	playlistSortCmd.Flags().BoolVar(&playlistSortCmdFlagDryRun, "dry-run", false, "only show the new order.")
+	playlistMixCmd.Flags().Float64Var(&playlistMixCmdFlagTolerance, "bpm-tolerance", 6, "the maximum tempo difference in percent between tracks.")
+	playlistMixCmd.Flags().IntVar(&playlistMixCmdFlagBeam, "beam", 8, "the number of partial orders the search keeps, 1 for a greedy search.")
+	playlistMixCmd.Flags().IntVar(&playlistMixCmdFlagStart, "start", 0, "start with the track at this position instead of the best one.")
+	playlistMixCmd.Flags().StringVar(&playlistMixCmdFlagInto, "into", "", "write the tracks to this playlist instead of reordering the playlist.")
+	playlistMixCmd.Flags().BoolVar(&playlistMixCmdFlagDryRun, "dry-run", false, "only show the new order.")
+
+	smartCmd.AddCommand(smartLsCmd)
+	smartCmd.AddCommand(smartSyncCmd)
+	smartSyncCmd.Flags().BoolVar(&smartSyncCmdFlagAll, "all", false, "sync all the smart playlists.")
+	smartSyncCmd.Flags().BoolVar(&smartSyncCmdFlagDryRun, "dry-run", false, "only show the matching tracks.")
+
+	artistCmd.AddCommand(artistAlbumsCmd)
+	artistCmd.AddCommand(artistRelatedCmd)
+	artistRelatedCmd.Flags().IntVar(&artistRelatedCmdFlagDepth, "depth", 1, "how many levels of related artists to show, up to 3.")
+	artistRelatedCmd.Flags().IntVarP(&artistRelatedCmdFlagLimit, "limit", "l", 10, "the number of related artists to show for each artist.")
+
+	infoCmd.Flags().BoolVar(&infoCmdFlagAlbum, "album", false, "show the album of the track.")
+	infoCmd.Flags().IntVar(&infoCmdFlagPlay, "play", 0, "play the album from this track number.")
+	infoCmd.Flags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
+
+	historyCmd.Flags().StringVar(&historyCmdFlagFrom, "from", "", "only show plays on or after this date, such as 2018-01-31.")
+	historyCmd.Flags().StringVar(&historyCmdFlagTo, "to", "", "only show plays on or before this date.")
+	historyCmd.Flags().StringVar(&historyCmdFlagArtist, "artist", "", "only show plays by artists whose name contains this.")
+	historyCmd.Flags().StringVar(&historyCmdFlagContext, "context", "", "only show plays from this context type or URI.")
+	historyCmd.Flags().IntVarP(&historyCmdFlagLimit, "limit", "l", 50, "the number of latest plays to show, 0 for all.")
+	historyCmd.Flags().StringVarP(&historyCmdFlagOutput, "output", "o", outputTable, "the output format: table, json or uri.")
+	historyCmd.Flags().BoolVar(&historyCmdFlagNoSync, "no-sync", false, "only show the local log without syncing it.")
+
+	logCmd.Flags().DurationVar(&logCmdFlagInterval, "interval", 5*time.Second, "how often to poll the player.")
+	logCmd.Flags().BoolVarP(&logCmdFlagDetach, "detach", "D", false, "run in a background process.")
+	logCmd.Flags().BoolVar(&logCmdFlagScrobble, "scrobble", false, "scrobble the plays to the services set up in the config file.")
+
+	statsCmd.AddCommand(statsYearCmd)
+	statsCmd.Flags().StringVar(&statsCmdFlagSince, "since", "30d", "only count plays since this date or time ago, such as 30d, or all.")
+	statsCmd.Flags().IntVarP(&statsCmdFlagLimit, "limit", "l", 10, "the number of top artists, tracks, albums and genres to show.")
+	statsCmd.Flags().StringVar(&statsCmdFlagBy, "by", "plays", "rank the top items by plays or time listened.")
+	statsCmd.Flags().StringVarP(&statsCmdFlagOutput, "output", "o", outputChart, "the output format: chart, table or json.")
+	statsYearCmd.Flags().StringVarP(&statsYearCmdFlagFile, "file", "f", "", "the HTML file to write, spotctl-<year>.html by default.")
+
+	scrobbleCmd.AddCommand(scrobbleLoginCmd)
+	scrobbleCmd.AddCommand(scrobbleFlushCmd)
+
+	topCmd.AddCommand(topTracksCmd)
+	topCmd.AddCommand(topArtistsCmd)
+	topCmd.PersistentFlags().StringVar(&topCmdFlagRange, "range", "medium", "the time range: short, medium or long.")
+	topCmd.PersistentFlags().IntVarP(&topCmdFlagLimit, "limit", "l", 50, "the number of items to show, up to 50.")
+	topCmd.PersistentFlags().BoolVar(&topCmdFlagCompare, "compare", false, "compare the ranks of every range.")
+	topCmd.PersistentFlags().StringVarP(&topCmdFlagOutput, "output", "o", outputTable, "the output format: table, json or uri.")
+	topTracksCmd.Flags().StringVar(&topCmdFlagSavePlaylist, "save-playlist", "", "save the tracks to the playlist with this name instead of showing them.")
+	topTracksCmd.Flags().SetAnnotation("save-playlist", scopesAnnotation, strings.Fields(playlistModifyScopes))
+
+	radioCmd.AddCommand(radioGenresCmd)
+	radioCmd.Flags().StringArrayVar(&radioCmdFlagSeedArtists, "seed-artist", nil, "seed by this artist, can be given more than once.")
+	radioCmd.Flags().StringArrayVar(&radioCmdFlagSeedGenres, "seed-genre", nil, "seed by this genre, can be given more than once.")
+	radioCmd.Flags().StringArrayVar(&radioCmdFlagSeedTracks, "seed-track", nil, "seed by this track, can be given more than once.")
+	radioCmd.Flags().StringVar(&radioCmdFlagEnergy, "energy", "", "the energy of the tracks between 0 and 1, such as 0.6..0.9.")
+	radioCmd.Flags().StringVar(&radioCmdFlagTempo, "tempo", "", "the tempo of the tracks in beats per minute, such as 120.")
+	radioCmd.Flags().StringVar(&radioCmdFlagPopularity, "popularity", "", "the popularity of the tracks between 0 and 100, such as <50.")
+	radioCmd.Flags().StringVar(&radioCmdFlagDanceability, "danceability", "", "the danceability of the tracks between 0 and 1.")
+	radioCmd.Flags().StringVar(&radioCmdFlagValence, "valence", "", "the valence, or positiveness, of the tracks between 0 and 1.")
+	radioCmd.Flags().StringVar(&radioCmdFlagAcousticness, "acousticness", "", "the acousticness of the tracks between 0 and 1.")
+	radioCmd.Flags().StringVar(&radioCmdFlagInstrumentalness, "instrumentalness", "", "the instrumentalness of the tracks between 0 and 1.")
+	radioCmd.Flags().IntVarP(&radioCmdFlagLimit, "limit", "l", 50, "the number of tracks between 1 and 100.")
+	radioCmd.Flags().StringVar(&radioCmdFlagSave, "save", "", "save the tracks as a playlist with this name instead of playing them.")
+	radioCmd.Flags().SetAnnotation("save", scopesAnnotation, strings.Fields(playlistModifyScopes))
+	radioCmd.Flags().StringVarP(&deviceNameFlag, "device", "d", "", "the name of device")
+
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
 	}
@@ -84,32 +281,36 @@ func preRootCmd(cmd *cobra.Command, args []string) {
 	}
 
 	tokenPath = filepath.Join(usr.HomeDir, ".spotctl")
-	auth = spotify.NewAuthenticator(
-		redirectURI,
-		spotify.ScopeUserReadCurrentlyPlaying,
-		spotify.ScopeUserReadPlaybackState,
-		spotify.ScopeUserModifyPlaybackState,
-	)
-	auth.SetAuthInfo(spotifyClientID, spotifyClientSecret)
-
-	// skip reading token if this is a login/logout command
-	if cmd.Use == "login" || cmd.Use == "logout" {
+	dataDir = filepath.Join(usr.HomeDir, ".spotctl.d")
+	tokenScopes = defaultScopes
+	auth = newAuthenticator(tokenScopes)
+
+	// skip reading token if this is a command that doesn't talk to Spotify
+	if !requiresToken(cmd) {
 		return
 	}
 
-	token, err = readToken()
-	if err != nil {
-		if os.IsNotExist(err) {
-			if err := login(cmd, args); err != nil {
-				log.Fatal(err)
-			}
-
-			// read token one more time
-			token, err = readToken()
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
+	token, tokenScopes, err = readToken()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+
+	missing := missingScopes(tokenScopes, requiredScopes(cmd))
+	if err != nil || len(missing) > 0 {
+		if err == nil {
+			fmt.Printf("This command needs additional permissions: %s.\n", strings.Join(missing, ", "))
+		}
+
+		// keep the scopes granted so far
+		tokenScopes = append(append([]string{}, tokenScopes...), missing...)
+		auth = newAuthenticator(tokenScopes)
+		if err := login(cmd, args); err != nil {
+			log.Fatal(err)
+		}
+
+		// read token one more time
+		token, tokenScopes, err = readToken()
+		if err != nil {
 			log.Fatal(err)
 		}
 	}
@@ -118,24 +319,45 @@ func preRootCmd(cmd *cobra.Command, args []string) {
 }
 
 func postRootCmd(cmd *cobra.Command, args []string) {
-	// skip reading token if this is a login/logout command
-	if cmd.Use == "login" || cmd.Use == "logout" {
+	// skip reading token if this is a command that doesn't talk to Spotify
+	if !requiresToken(cmd) {
 		return
 	}
 
+	// sync first so that a token refreshed by the sync is saved as well
+	if cmd != historyCmd {
+		autoSyncHistory()
+	}
+
 	tokenInUse, err := client.Token()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	if tokenInUse != token {
-		if err := saveToken(tokenInUse); err != nil {
+		if err := saveToken(tokenInUse, tokenScopes); err != nil {
 			log.Fatal(err)
 		}
 	}
 }
 
-func saveToken(tok *oauth2.Token) error {
+func requiresToken(cmd *cobra.Command) bool {
+	switch cmd {
+	case loginCmd, logoutCmd, uriCmd, scrobbleCmd, scrobbleLoginCmd, scrobbleFlushCmd:
+		return false
+	}
+
+	return true
+}
+
+func newAuthenticator(scopes []string) spotify.Authenticator {
+	a := spotify.NewAuthenticator(redirectURI, scopes...)
+	a.SetAuthInfo(spotifyClientID, spotifyClientSecret)
+
+	return a
+}
+
+func saveToken(tok *oauth2.Token, scopes []string) error {
 	f, err := os.OpenFile(tokenPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
@@ -143,19 +365,23 @@ func saveToken(tok *oauth2.Token) error {
 	defer f.Close()
 
 	enc := json.NewEncoder(f)
-	return enc.Encode(tok)
+	return enc.Encode(savedToken{Token: tok, Scopes: scopes})
 }
 
-func readToken() (*oauth2.Token, error) {
+func readToken() (*oauth2.Token, []string, error) {
 	content, err := ioutil.ReadFile(tokenPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	var tok oauth2.Token
+	tok := savedToken{Token: &oauth2.Token{}}
 	if err := json.Unmarshal(content, &tok); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if len(tok.Scopes) == 0 {
+		tok.Scopes = defaultScopes
 	}
 
-	return &tok, nil
+	return tok.Token, tok.Scopes, nil
 }
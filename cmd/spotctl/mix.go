@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+var (
+	playlistMixCmdFlagTolerance float64
+	playlistMixCmdFlagBeam      int
+	playlistMixCmdFlagStart     int
+	playlistMixCmdFlagInto      string
+	playlistMixCmdFlagDryRun    bool
+)
+
+var playlistMixCmd = &cobra.Command{
+	Use:   "mix <playlist>",
+	Short: "Order a playlist for harmonic mixing",
+	Long: `Order a playlist so that each track mixes into the next: their keys are the same, next to each other on the Camelot wheel or relative major and minor, and their tempos differ by no more than --bpm-tolerance percent, counting double and half time. The order is found with a beam search, --beam 1 is a greedy search. Tracks without a detected key or tempo go last.
+
+The playlist is reordered in place, after saving the current order as a snapshot, or the tracks are written to the --into playlist. A report lists the key and tempo of every transition.`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistMix,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+// mixTrack is a playlist track with the key and tempo it's mixed by.
+type mixTrack struct {
+	item     libraryItem
+	position int
+	key      camelotKey
+	tempo    float64
+}
+
+// mixCost is the cost of mixing a into b. Compatible keys within the tempo
+// tolerance cost less than 2, anything else costs more.
+func mixCost(a, b mixTrack, tolerance float64) float64 {
+	var cost float64
+
+	switch relation, _ := a.key.relation(b.key); relation {
+	case "same key":
+	case "+1", "-1":
+		cost += 0.5
+	case "relative key":
+		cost += 0.75
+	default:
+		cost += 2 + float64(a.key.distance(b.key))
+	}
+
+	if diff := tempoDifference(a.tempo, b.tempo); diff <= tolerance {
+		cost += diff / tolerance
+	} else {
+		cost += 2 + (diff-tolerance)/tolerance
+	}
+
+	return cost
+}
+
+// mixOrder finds a low-cost order of tracks with a beam search keeping the
+// width cheapest partial orders at each step. If start isn't negative, the
+// order starts with tracks[start]. It returns the indices of tracks in order.
+func mixOrder(tracks []mixTrack, tolerance float64, width, start int) []int {
+	type state struct {
+		order []int
+		used  []bool
+		cost  float64
+	}
+
+	if len(tracks) == 0 {
+		return nil
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	var beam []state
+	for i := range tracks {
+		if start >= 0 && i != start {
+			continue
+		}
+
+		used := make([]bool, len(tracks))
+		used[i] = true
+		beam = append(beam, state{order: []int{i}, used: used})
+	}
+
+	for len(beam[0].order) < len(tracks) {
+		type candidate struct {
+			state int
+			next  int
+			cost  float64
+		}
+
+		var candidates []candidate
+		for s, st := range beam {
+			last := tracks[st.order[len(st.order)-1]]
+			for i, t := range tracks {
+				if !st.used[i] {
+					candidates = append(candidates, candidate{s, i, st.cost + mixCost(last, t, tolerance)})
+				}
+			}
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].cost < candidates[j].cost
+		})
+		if len(candidates) > width {
+			candidates = candidates[:width]
+		}
+
+		next := make([]state, len(candidates))
+		for i, c := range candidates {
+			prev := beam[c.state]
+
+			next[i] = state{
+				order: append(append([]int{}, prev.order...), c.next),
+				used:  append([]bool{}, prev.used...),
+				cost:  c.cost,
+			}
+			next[i].used[c.next] = true
+		}
+		beam = next
+	}
+
+	best := beam[0]
+	for _, st := range beam[1:] {
+		if st.cost < best.cost {
+			best = st
+		}
+	}
+
+	return best.order
+}
+
+func playlistMix(cmd *cobra.Command, args []string) error {
+	if playlistMixCmdFlagTolerance <= 0 {
+		return errors.New("--bpm-tolerance must be positive")
+	}
+
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	items, err := playlistItems(p)
+	if err != nil {
+		return err
+	}
+	if playlistMixCmdFlagStart < 0 || playlistMixCmdFlagStart > len(items) {
+		return fmt.Errorf("--start must be between 1 and %d, the number of tracks in %s", len(items), p.Name)
+	}
+
+	var ids []spotify.ID
+	for _, item := range items {
+		if id := trackID(item.URI); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	features, err := audioFeatures(ids)
+	if err != nil {
+		return err
+	}
+
+	var (
+		mixable []mixTrack
+		rest    []int
+		start   = -1
+	)
+	for i, item := range items {
+		f := features[trackID(item.URI)]
+		if f != nil && f.Tempo > 0 {
+			if key, ok := newCamelotKey(f.Key, f.Mode); ok {
+				if i == playlistMixCmdFlagStart-1 {
+					start = len(mixable)
+				}
+				mixable = append(mixable, mixTrack{item, i, key, float64(f.Tempo)})
+				continue
+			}
+		}
+		rest = append(rest, i)
+	}
+
+	if playlistMixCmdFlagStart > 0 && start < 0 {
+		return fmt.Errorf("track %d can't be mixed, it has no key or tempo", playlistMixCmdFlagStart)
+	}
+
+	var (
+		mixed = make([]mixTrack, 0, len(mixable))
+		order = make([]int, len(items))
+	)
+	for i, t := range mixOrder(mixable, playlistMixCmdFlagTolerance, playlistMixCmdFlagBeam, start) {
+		mixed = append(mixed, mixable[t])
+		order[mixable[t].position] = i
+	}
+	for i, position := range rest {
+		order[position] = len(mixed) + i
+	}
+
+	printMixReport(mixed, playlistMixCmdFlagTolerance)
+	if len(rest) > 0 {
+		fmt.Printf("%d tracks without a key or tempo go last.\n", len(rest))
+	}
+
+	if playlistMixCmdFlagInto != "" {
+		var ids []spotify.ID
+		for _, t := range mixed {
+			ids = append(ids, trackID(t.item.URI))
+		}
+		for _, position := range rest {
+			if id := trackID(items[position].URI); id != "" {
+				ids = append(ids, id)
+			}
+		}
+
+		return writePlaylistInto(playlistMixCmdFlagInto, ids, playlistMixCmdFlagDryRun)
+	}
+
+	if playlistMixCmdFlagDryRun {
+		return nil
+	}
+
+	snap, saved, err := takeSnapshot(p)
+	if err != nil {
+		return err
+	}
+	if saved {
+		fmt.Printf("Saved the current order of %q as snapshot %s.\n", p.Name, snap.ID)
+	}
+
+	moves, err := reorderPlaylist(p, p.SnapshotID, order)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reordered %q with %d moves.\n", p.Name, moves)
+
+	return nil
+}
+
+// printMixReport prints the key and tempo of each track and how well it
+// mixes with the previous one.
+func printMixReport(tracks []mixTrack, tolerance float64) {
+	var (
+		rows [][]string
+		good int
+	)
+	for i, t := range tracks {
+		transition := ""
+		if i > 0 {
+			prev := tracks[i-1]
+			relation, compatible := prev.key.relation(t.key)
+			diff := tempoDifference(prev.tempo, t.tempo)
+
+			mark := "ok"
+			if compatible && diff <= tolerance {
+				good++
+			} else {
+				mark = "rough"
+			}
+			transition = fmt.Sprintf("%s %s → %s, %.1f%% bpm", mark, prev.key, t.key, diff)
+			if relation != "clash" {
+				transition += " (" + relation + ")"
+			}
+		}
+
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1),
+			strconv.Itoa(t.position + 1),
+			trackLabel(t.item),
+			t.key.String(),
+			strconv.FormatFloat(t.tempo, 'f', 1, 64),
+			transition,
+		})
+	}
+
+	printTable([]string{"#", "WAS", "TRACK", "KEY", "BPM", "TRANSITION"}, rows)
+
+	if len(tracks) > 1 {
+		fmt.Printf("%d of %d transitions are harmonic and within %.1f%% bpm.\n", good, len(tracks)-1, tolerance)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// mixTracks returns tracks from space-separated Camelot keys and tempos
+// like 8A:120, named after their index.
+func mixTracks(t *testing.T, s string) []mixTrack {
+	var tracks []mixTrack
+	for i, f := range strings.Fields(s) {
+		parts := strings.Split(f, ":")
+		if len(parts) != 2 {
+			t.Fatalf("invalid mix track %q", f)
+		}
+		n := len(parts[0]) - 1
+		number, err := strconv.Atoi(parts[0][:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tempo, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tracks = append(tracks, mixTrack{
+			item:     libraryItem{searchItem: searchItem{Type: "track", Name: strconv.Itoa(i)}},
+			position: i,
+			key:      camelotKey{number: number, major: parts[0][n] == 'B'},
+			tempo:    tempo,
+		})
+	}
+
+	return tracks
+}
+
+// mixOrderCost is the cost of mixing tracks in order.
+func mixOrderCost(tracks []mixTrack, order []int, tolerance float64) float64 {
+	var cost float64
+	for i := 1; i < len(order); i++ {
+		cost += mixCost(tracks[order[i-1]], tracks[order[i]], tolerance)
+	}
+
+	return cost
+}
+
+func TestMixCost(t *testing.T) {
+	tests := []struct {
+		name   string
+		tracks string
+		want   float64
+	}{
+		{"same key", "8A:120 8A:120", 0},
+		{"+1", "8A:120 9A:120", 0.5},
+		{"-1", "8A:120 7A:120", 0.5},
+		{"+1 around the wheel", "12B:120 1B:120", 0.5},
+		{"relative key", "8A:120 8B:120", 0.75},
+		{"clash", "8A:120 10A:120", 2 + 2},
+		{"clash in another mode", "8A:120 9B:120", 2 + 2},
+		{"tempo within tolerance", "8A:120 8A:123", 2.5 / 6},
+		{"tempo at the tolerance", "8A:100 8A:106", 1},
+		{"tempo beyond tolerance", "8A:120 8A:132", 2 + 4.0/6},
+		{"double time", "8A:120 8A:240", 0},
+		{"half time", "8A:120 8A:60", 0},
+		{"double time within tolerance", "8A:120 8A:246", 2.5 / 6},
+		{"half time within tolerance", "8A:120 8A:59", (2.0 / 120 * 100) / 6},
+		{"+1 within tolerance", "8A:120 9A:123", 0.5 + 2.5/6},
+	}
+
+	for _, tt := range tests {
+		tracks := mixTracks(t, tt.tracks)
+		if got := mixCost(tracks[0], tracks[1], 6); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: mixCost(%s) = %g, want %g", tt.name, tt.tracks, got, tt.want)
+		}
+	}
+}
+
+func TestMixOrder(t *testing.T) {
+	tests := []struct {
+		tracks string
+		width  int
+		start  int
+		want   []int
+	}{
+		{"", 8, -1, nil},
+		{"8A:120", 8, -1, []int{0}},
+		{"8A:120 10A:120 9A:120", 1, -1, []int{0, 2, 1}},
+		{"8A:120 10A:120 9A:120", 8, 1, []int{1, 2, 0}},
+		// the tracks that mix best are kept next to each other
+		{"8A:120 3B:100 8A:121 3B:101", 8, -1, []int{2, 0, 3, 1}},
+		{"8A:120 3B:100 8A:121 3B:101", 8, 1, []int{1, 3, 0, 2}},
+	}
+
+	for _, tt := range tests {
+		got := mixOrder(mixTracks(t, tt.tracks), 6, tt.width, tt.start)
+		if !equalInts(got, tt.want) {
+			t.Errorf("mixOrder(%q, width %d, start %d) = %v, want %v", tt.tracks, tt.width, tt.start, got, tt.want)
+		}
+	}
+}
+
+func TestMixOrderFindsBestOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		var fields []string
+		for j := 0; j < 5; j++ {
+			fields = append(fields, fmt.Sprintf("%d%c:%d", 1+r.Intn(12), "AB"[r.Intn(2)], 80+r.Intn(80)))
+		}
+		s := strings.Join(fields, " ")
+		tracks := mixTracks(t, s)
+
+		// there are at most 5*4*3*2 partial orders, so the beam keeps them all
+		best := math.Inf(1)
+		order := []int{0, 1, 2, 3, 4}
+		var permute func(k int)
+		permute = func(k int) {
+			if k == len(order) {
+				best = math.Min(best, mixOrderCost(tracks, order, 6))
+				return
+			}
+			for i := k; i < len(order); i++ {
+				order[k], order[i] = order[i], order[k]
+				permute(k + 1)
+				order[k], order[i] = order[i], order[k]
+			}
+		}
+		permute(0)
+
+		got := mixOrder(tracks, 6, 120, -1)
+		if cost := mixOrderCost(tracks, got, 6); math.Abs(cost-best) > 1e-9 {
+			t.Errorf("mixOrder(%q) = %v costing %g, want cost %g", s, got, cost, best)
+		}
+
+		// a greedy search finds an order, if not the best one
+		greedy := mixOrder(tracks, 6, 1, -1)
+		seen := make([]bool, len(tracks))
+		for _, i := range greedy {
+			seen[i] = true
+		}
+		for i, ok := range seen {
+			if !ok || len(greedy) != len(tracks) {
+				t.Errorf("mixOrder(%q, width 1) = %v, which misses track %d", s, greedy, i)
+				break
+			}
+		}
+	}
+}
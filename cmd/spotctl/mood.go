@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+// moodTopArtists is the number of top artists the seeds of a mood are drawn
+// from.
+const moodTopArtists = 20
+
+// moodPreset maps the names of track attributes to a target value or range,
+// as taken by the radio attribute flags.
+type moodPreset map[string]string
+
+// moodPresets are the built-in moods. The config file can override them or
+// add more under "moods", for example:
+//
+//	"moods": {"focus": {"energy": "0.3..0.6", "instrumentalness": "0.8.."}}
+var moodPresets = map[string]moodPreset{
+	"focus": {
+		"energy":           "0.2..0.6",
+		"valence":          "0.2..0.6",
+		"tempo":            "80..125",
+		"instrumentalness": "0.5..",
+	},
+	"chill": {
+		"energy":       "..0.45",
+		"valence":      "0.3..0.8",
+		"tempo":        "60..110",
+		"acousticness": "0.3..",
+	},
+	"workout": {
+		"energy":  "0.75..",
+		"valence": "0.4..",
+		"tempo":   "120..160",
+	},
+	"party": {
+		"energy":       "0.7..",
+		"valence":      "0.6..",
+		"danceability": "0.7..",
+		"tempo":        "110..135",
+	},
+	"sleep": {
+		"energy":           "..0.25",
+		"tempo":            "..90",
+		"acousticness":     "0.6..",
+		"instrumentalness": "0.6..",
+	},
+}
+
+// findMood returns the preset of a mood, preferring the one in the config
+// file.
+func findMood(name string) (moodPreset, error) {
+	c, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.ToLower(name)
+	for n, p := range c.Moods {
+		if strings.ToLower(n) == name {
+			return p, nil
+		}
+	}
+	if p, ok := moodPresets[name]; ok {
+		return p, nil
+	}
+
+	var names []string
+	for n := range moodPresets {
+		names = append(names, n)
+	}
+	for n := range c.Moods {
+		if _, ok := moodPresets[strings.ToLower(n)]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	return nil, fmt.Errorf("unknown mood %s, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// moodToPlay gets recommendations matching a mood, seeded by a random pick
+// of the user's top artists.
+func moodToPlay(name string) (*spotify.PlayOptions, error) {
+	preset, err := findMood(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ta, err := newTrackAttributes(preset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mood %s: %s", name, err)
+	}
+
+	limit := moodTopArtists
+	top, err := client.CurrentUsersTopArtistsOpt(&spotify.Options{Limit: &limit})
+	if err != nil {
+		return nil, err
+	}
+	if len(top.Artists) == 0 {
+		return nil, fmt.Errorf("there are no top artists to seed %s with yet, try spotctl radio instead", name)
+	}
+
+	var (
+		seeds spotify.Seeds
+		names []string
+	)
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for _, i := range r.Perm(len(top.Artists)) {
+		if len(seeds.Artists) == spotify.MaxNumberOfSeeds {
+			break
+		}
+		seeds.Artists = append(seeds.Artists, top.Artists[i].ID)
+		names = append(names, top.Artists[i].Name)
+	}
+
+	limit = 50
+	recs, err := client.GetRecommendations(seeds, ta, &spotify.Options{Limit: &limit})
+	if err != nil {
+		return nil, err
+	}
+	if len(recs.Tracks) == 0 {
+		return nil, fmt.Errorf("no %s tracks found for %s", name, strings.Join(names, ", "))
+	}
+
+	opt := &spotify.PlayOptions{}
+	for _, t := range recs.Tracks {
+		opt.URIs = append(opt.URIs, t.URI)
+	}
+
+	fmt.Printf("Playing %d %s tracks like %s.\n", len(opt.URIs), name, strings.Join(names, ", "))
+
+	return opt, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import "github.com/zmb3/spotify"
+
+// pageSize is the maximum number of items most paged endpoints return at once.
+const pageSize = 50
+
+// allPages calls fetch with the options of successive pages of pageSize items
+// for as long as it reports that there are more pages. Cursor-based
+// endpoints can ignore the offset and keep track of their cursor instead.
+func allPages(fetch func(opt *spotify.Options) (more bool, err error)) error {
+	for offset := 0; ; offset += pageSize {
+		limit, offset := pageSize, offset
+		more, err := fetch(&spotify.Options{Limit: &limit, Offset: &offset})
+		if err != nil || !more {
+			return err
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	ui "github.com/gizak/termui"
+	runewidth "github.com/mattn/go-runewidth"
+)
+
+const pickerMaxColumnWidth = 40
+
+var errPickCanceled = errors.New("canceled")
+
+// pick shows an interactive list of rows that can be narrowed down by typing
+// a fuzzy filter and returns the index of the chosen row.
+func pick(title string, header []string, rows [][]string) (int, error) {
+	if len(rows) == 0 {
+		return 0, errors.New("nothing to pick from")
+	}
+
+	lines := alignColumns(append([][]string{header}, rows...))
+	headerLine, rowLines := lines[0], lines[1:]
+
+	if err := ui.Init(); err != nil {
+		return 0, err
+	}
+	defer ui.Close()
+
+	input := ui.NewPar("")
+	input.BorderLabel = title
+	input.Height = 3
+
+	list := ui.NewList()
+	list.Border = false
+	list.Y = input.Height
+
+	help := ui.NewPar("Type to filter, up/down to move, enter to choose, esc to cancel.")
+	help.Border = false
+	help.Height = 1
+
+	var (
+		query    string
+		matches  = fuzzyFilter(query, rowLines)
+		selected int
+		offset   int
+		chosen   = -1
+	)
+
+	draw := func() {
+		width, height := ui.TermWidth(), ui.TermHeight()
+		input.Width = width
+		input.Text = "> " + query
+		list.Width = width
+		list.Height = height - input.Height - help.Height
+		help.Y = height - help.Height
+		help.Width = width
+
+		visible := list.Height - 1
+		if selected < offset {
+			offset = selected
+		} else if visible > 0 && selected >= offset+visible {
+			offset = selected - visible + 1
+		}
+
+		list.Items = []string{headerLine}
+		for i := offset; i < len(matches) && i < offset+visible; i++ {
+			line := escapeMarkdown(rowLines[matches[i]])
+			if i == selected {
+				line = "[" + line + "](fg-black,bg-green)"
+			}
+			list.Items = append(list.Items, line)
+		}
+
+		ui.Clear()
+		ui.Render(input, list, help)
+	}
+
+	ui.Handle("/sys/kbd", func(e ui.Event) {
+		edited := true
+
+		switch key := e.Data.(ui.EvtKbd).KeyStr; key {
+		case "<enter>":
+			if len(matches) > 0 {
+				chosen = matches[selected]
+			}
+			ui.StopLoop()
+			return
+		case "<escape>", "C-c":
+			ui.StopLoop()
+			return
+		case "<up>", "C-p":
+			if selected > 0 {
+				selected--
+			}
+			edited = false
+		case "<down>", "C-n":
+			if selected < len(matches)-1 {
+				selected++
+			}
+			edited = false
+		case "<backspace>", "C-8":
+			if len(query) > 0 {
+				_, size := utf8.DecodeLastRuneInString(query)
+				query = query[:len(query)-size]
+			}
+		case "C-u":
+			query = ""
+		case "<space>":
+			query += " "
+		default:
+			if utf8.RuneCountInString(key) != 1 {
+				return
+			}
+			query += key
+		}
+
+		if edited {
+			matches = fuzzyFilter(query, rowLines)
+			selected, offset = 0, 0
+		}
+
+		draw()
+	})
+
+	ui.Handle("/sys/wnd/resize", func(ui.Event) {
+		draw()
+	})
+
+	draw()
+	ui.Loop()
+
+	if chosen < 0 {
+		return 0, errPickCanceled
+	}
+
+	return chosen, nil
+}
+
+// alignColumns pads the cells of rows into aligned lines.
+func alignColumns(rows [][]string) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := runewidth.StringWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	lines := make([]string, len(rows))
+	for r, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			w := widths[i]
+			if w > pickerMaxColumnWidth {
+				w = pickerMaxColumnWidth
+			}
+			cells[i] = runewidth.FillRight(runewidth.Truncate(cell, w, "…"), w)
+		}
+		lines[r] = strings.TrimRight(strings.Join(cells, "  "), " ")
+	}
+
+	return lines
+}
+
+// escapeMarkdown prevents text from being interpreted as termui's
+// [text](fg-color) markup.
+func escapeMarkdown(s string) string {
+	return strings.Replace(s, "](", "] (", -1)
+}
+
+// fuzzyFilter returns the indices of the lines that match query, best
+// matches first. Each whitespace-separated term of query must match.
+func fuzzyFilter(query string, lines []string) []int {
+	type match struct {
+		index int
+		score int
+	}
+
+	terms := strings.Fields(query)
+
+	var matches []match
+	for i, line := range lines {
+		total, ok := 0, true
+		for _, term := range terms {
+			score, matched := fuzzyScore(term, line)
+			if !matched {
+				ok = false
+				break
+			}
+			total += score
+		}
+		if ok {
+			matches = append(matches, match{i, total})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	indices := make([]int, len(matches))
+	for i, m := range matches {
+		indices[i] = m.index
+	}
+
+	return indices
+}
+
+// fuzzyScore reports whether the runes of pattern appear in order in text,
+// ignoring case. Consecutive runes and runes at the start of words score
+// higher.
+func fuzzyScore(pattern, text string) (int, bool) {
+	p := []rune(strings.ToLower(pattern))
+	if len(p) == 0 {
+		return 0, true
+	}
+
+	var (
+		score    int
+		j        int
+		prev     = ' '
+		lastHit  = -2
+		position int
+	)
+	for _, r := range strings.ToLower(text) {
+		if j < len(p) && r == p[j] {
+			score++
+			if lastHit == position-1 {
+				score += 2
+			}
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 3
+			}
+			lastHit = position
+			j++
+		}
+		prev = r
+		position++
+	}
+
+	return score, j == len(p)
+}
@@ -8,12 +8,14 @@ import (
 
 	ui "github.com/gizak/termui"
 	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
 )
 
 var playerCmd = &cobra.Command{
-	Use:   "player",
-	Short: "Show the live player panel",
-	RunE:  player,
+	Use:         "player",
+	Short:       "Show the live player panel",
+	RunE:        player,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserLibraryRead + " " + spotify.ScopeUserLibraryModify},
 }
 
 func player(cmd *cobra.Command, args []string) error {
@@ -69,7 +71,7 @@ func player(cmd *cobra.Command, args []string) error {
 	volGauge.BarColor = ui.ColorBlue
 	volGauge.PaddingBottom = 1
 
-	helpLabel := ui.NewPar("Press q - quit, p - play/pause, l/h - next/previous track, j/k - vol up/down, s - shuffle, r - repeat.")
+	helpLabel := ui.NewPar("Press q - quit, p - play/pause, l/h - next/previous track, j/k - vol up/down, s - shuffle, r - repeat, f - like/unlike.")
 	helpLabel.X = 0
 	helpLabel.Y = 10
 	helpLabel.Width = 40
@@ -77,6 +79,13 @@ func player(cmd *cobra.Command, args []string) error {
 	helpLabel.Border = false
 	helpLabel.WrapLength = 40
 
+	// the liked mark of the track playing is only looked up when the track
+	// changes, not on every redraw
+	var (
+		likedID   spotify.ID
+		likedText string
+	)
+
 	draw := func() {
 		ui.Render(
 			songList,
@@ -145,6 +154,33 @@ func player(cmd *cobra.Command, args []string) error {
 		}
 	})
 
+	ui.Handle("/sys/kbd/f", func(ui.Event) {
+		state, err := client.PlayerState()
+		if err != nil {
+			quitAndFatal(err)
+		}
+		if state.Item == nil {
+			return
+		}
+
+		saved, err := client.UserHasTracks(state.Item.ID)
+		if err != nil {
+			quitAndFatal(err)
+		}
+
+		if len(saved) > 0 && saved[0] {
+			err = client.RemoveTracksFromLibrary(state.Item.ID)
+			likedText = ""
+		} else {
+			err = client.AddTracksToLibrary(state.Item.ID)
+			likedText = " ♥"
+		}
+		if err != nil {
+			quitAndFatal(err)
+		}
+		likedID = state.Item.ID
+	})
+
 	ui.Handle("/timer/1s", func(e ui.Event) {
 		state, err := client.PlayerState()
 		if err != nil {
@@ -177,8 +213,13 @@ func player(cmd *cobra.Command, args []string) error {
 			for _, a := range state.Item.Artists {
 				artists = append(artists, a.Name)
 			}
+			if state.Item.ID != likedID {
+				likedID = state.Item.ID
+				likedText = likedMark(likedID)
+			}
+
 			songList.Items = []string{
-				state.Item.Name,
+				state.Item.Name + likedText,
 				fmt.Sprintf("%s - %s", strings.Join(artists, ", "), state.Item.Album.Name),
 			}
 
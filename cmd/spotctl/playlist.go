@@ -0,0 +1,567 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+// playlistBatchSize is the maximum number of tracks per playlist edit.
+const playlistBatchSize = 100
+
+var (
+	playlistReadScopes   = spotify.ScopePlaylistReadPrivate + " " + spotify.ScopePlaylistReadCollaborative
+	playlistModifyScopes = playlistReadScopes + " " + spotify.ScopePlaylistModifyPublic + " " + spotify.ScopePlaylistModifyPrivate
+)
+
+var (
+	playlistCmdFlagOutput string
+	playlistCmdFlagPublic bool
+	playlistCmdFlagCount  int
+)
+
+var playlistCmd = &cobra.Command{
+	Use:   "playlist",
+	Short: "Manage your playlists",
+	Long:  `List, show, create and edit your playlists. Playlists can be given by name, URI, URL or ID. A name must match exactly one of your playlists, ignoring case.`,
+}
+
+var playlistLsCmd = &cobra.Command{
+	Use:         "ls",
+	Short:       "List your playlists",
+	Args:        cobra.NoArgs,
+	RunE:        playlistLs,
+	Annotations: map[string]string{scopesAnnotation: playlistReadScopes},
+}
+
+var playlistShowCmd = &cobra.Command{
+	Use:         "show <playlist>",
+	Short:       "List the tracks of a playlist",
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistShow,
+	Annotations: map[string]string{scopesAnnotation: playlistReadScopes},
+}
+
+var playlistCreateCmd = &cobra.Command{
+	Use:         "create <name>",
+	Short:       "Create a playlist",
+	Args:        cobra.MinimumNArgs(1),
+	RunE:        playlistCreate,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+var playlistRenameCmd = &cobra.Command{
+	Use:         "rename <playlist> <name>",
+	Short:       "Rename a playlist",
+	Args:        cobra.MinimumNArgs(2),
+	RunE:        playlistRename,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+var playlistPublicCmd = &cobra.Command{
+	Use:         "public <playlist>",
+	Short:       "Make a playlist public",
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistPublic,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+var playlistPrivateCmd = &cobra.Command{
+	Use:         "private <playlist>",
+	Short:       "Make a playlist private",
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistPrivate,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+var playlistAddCmd = &cobra.Command{
+	Use:         "add <playlist> [track]...",
+	Short:       "Add the current track or the given tracks to a playlist",
+	Args:        cobra.MinimumNArgs(1),
+	RunE:        playlistAdd,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+var playlistRmCmd = &cobra.Command{
+	Use:         "rm <playlist> [track|position]...",
+	Short:       "Remove tracks from a playlist",
+	Long:        `Remove tracks from a playlist. Tracks given by URI, URL or ID are removed wherever they occur, tracks given by position, counting from 1, are removed only there. Without tracks, the current track is removed.`,
+	Args:        cobra.MinimumNArgs(1),
+	RunE:        playlistRm,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+var playlistMvCmd = &cobra.Command{
+	Use:         "mv <playlist> <from> <to>",
+	Short:       "Move tracks within a playlist",
+	Long:        `Move the track at position from, or --count tracks starting there, so that it ends up at position to. Positions count from 1.`,
+	Args:        cobra.ExactArgs(3),
+	RunE:        playlistMv,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+var playlistClearCmd = &cobra.Command{
+	Use:         "clear <playlist>",
+	Short:       "Remove all tracks from a playlist",
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistClear,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+var playlistDeleteCmd = &cobra.Command{
+	Use:         "delete <playlist>",
+	Aliases:     []string{"unfollow"},
+	Short:       "Delete or unfollow a playlist",
+	Long:        `Remove a playlist from your library. Spotify doesn't delete playlists, your own playlists are unfollowed too and can be restored by following them again.`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistDelete,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+// playlistSummary is a playlist as printed by playlist ls.
+type playlistSummary struct {
+	Name          string      `json:"name"`
+	Owner         string      `json:"owner"`
+	Tracks        uint        `json:"tracks"`
+	Public        bool        `json:"public"`
+	Collaborative bool        `json:"collaborative"`
+	URI           spotify.URI `json:"uri"`
+}
+
+func playlistLs(cmd *cobra.Command, args []string) error {
+	playlists, err := currentUserPlaylists()
+	if err != nil {
+		return err
+	}
+
+	summaries := make([]playlistSummary, len(playlists))
+	for i, p := range playlists {
+		summaries[i] = playlistSummary{
+			Name:          p.Name,
+			Owner:         ownerName(p.Owner),
+			Tracks:        p.Tracks.Total,
+			Public:        p.IsPublic,
+			Collaborative: p.Collaborative,
+			URI:           p.URI,
+		}
+	}
+
+	switch playlistCmdFlagOutput {
+	case outputTable:
+		rows := make([][]string, len(summaries))
+		for i, s := range summaries {
+			access := "private"
+			if s.Public {
+				access = "public"
+			} else if s.Collaborative {
+				access = "collaborative"
+			}
+			rows[i] = []string{s.Name, s.Owner, strconv.Itoa(int(s.Tracks)), access, string(s.URI)}
+		}
+		return printTable([]string{"NAME", "OWNER", "TRACKS", "ACCESS", "URI"}, rows)
+	case outputJSON:
+		return printJSON(summaries)
+	case outputURI:
+		for _, s := range summaries {
+			fmt.Println(s.URI)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %s", playlistCmdFlagOutput)
+	}
+}
+
+func playlistShow(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	items, err := playlistItems(p)
+	if err != nil {
+		return err
+	}
+
+	if err := fillLibraryYears(items); err != nil {
+		return err
+	}
+
+	return printLibraryItems(items, playlistCmdFlagOutput)
+}
+
+func playlistCreate(cmd *cobra.Command, args []string) error {
+	userID, err := currentUserID()
+	if err != nil {
+		return err
+	}
+
+	p, err := client.CreatePlaylistForUser(userID, strings.Join(args, " "), playlistCmdFlagPublic)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(p.URI)
+
+	return nil
+}
+
+func playlistRename(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	return client.ChangePlaylistName(p.Owner.ID, p.ID, strings.Join(args[1:], " "))
+}
+
+func playlistPublic(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	return client.ChangePlaylistAccess(p.Owner.ID, p.ID, true)
+}
+
+func playlistPrivate(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	return client.ChangePlaylistAccess(p.Owner.ID, p.ID, false)
+}
+
+func playlistAdd(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	ids, err := trackIDsOrCurrent(args[1:])
+	if err != nil {
+		return err
+	}
+
+	return addPlaylistTracks(p, ids)
+}
+
+func playlistRm(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	var (
+		positions []int
+		trackArgs []string
+	)
+	for _, arg := range args[1:] {
+		if n, err := strconv.Atoi(arg); err == nil {
+			positions = append(positions, n-1)
+		} else {
+			trackArgs = append(trackArgs, arg)
+		}
+	}
+
+	if len(positions) > 0 {
+		items, err := playlistItems(p)
+		if err != nil {
+			return err
+		}
+
+		if err := removePlaylistPositions(p, items, positions); err != nil {
+			return err
+		}
+	}
+
+	if len(trackArgs) == 0 && len(positions) > 0 {
+		return nil
+	}
+
+	ids, err := trackIDsOrCurrent(trackArgs)
+	if err != nil {
+		return err
+	}
+
+	return inBatches(len(ids), playlistBatchSize, func(start, end int) error {
+		_, err := client.RemoveTracksFromPlaylist(p.Owner.ID, p.ID, ids[start:end]...)
+		return err
+	})
+}
+
+func playlistMv(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	from, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid position %q", args[1])
+	}
+	to, err := strconv.Atoi(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid position %q", args[2])
+	}
+
+	opt, err := playlistMoveOptions(from-1, to-1, playlistCmdFlagCount, int(p.Tracks.Total))
+	if err != nil {
+		return err
+	}
+	opt.SnapshotID = p.SnapshotID
+
+	_, err = client.ReorderPlaylistTracks(p.Owner.ID, p.ID, opt)
+	return err
+}
+
+func playlistClear(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	return client.ReplacePlaylistTracks(p.Owner.ID, p.ID)
+}
+
+func playlistDelete(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	return client.UnfollowPlaylist(spotify.ID(p.Owner.ID), p.ID)
+}
+
+// playlistMoveOptions returns the options to move count tracks starting at
+// the 0-based position from so that they end up at position to. Spotify
+// expects the position to insert before in the playlist as it is before the
+// move.
+func playlistMoveOptions(from, to, count, total int) (spotify.PlaylistReorderOptions, error) {
+	var opt spotify.PlaylistReorderOptions
+
+	if count < 1 {
+		return opt, fmt.Errorf("invalid count %d", count)
+	}
+	if from < 0 || from+count > total {
+		return opt, fmt.Errorf("can't move tracks %d to %d, the playlist has %d tracks", from+1, from+count, total)
+	}
+	if to < 0 || to+count > total {
+		return opt, fmt.Errorf("can't move tracks to position %d, the playlist has %d tracks", to+1, total)
+	}
+
+	opt.RangeStart = from
+	opt.RangeLength = count
+	opt.InsertBefore = to
+	if to > from {
+		opt.InsertBefore = to + count
+	}
+
+	return opt, nil
+}
+
+// addPlaylistTracks appends tracks to a playlist in batches.
+func addPlaylistTracks(p *spotify.SimplePlaylist, ids []spotify.ID) error {
+	return inBatches(len(ids), playlistBatchSize, func(start, end int) error {
+		_, err := client.AddTracksToPlaylist(p.Owner.ID, p.ID, ids[start:end]...)
+		return err
+	})
+}
+
+// replacePlaylistTracks replaces the tracks of a playlist. Only the first
+// batch can replace the tracks, the others are appended.
+func replacePlaylistTracks(p *spotify.SimplePlaylist, ids []spotify.ID) error {
+	first := ids
+	if len(first) > playlistBatchSize {
+		first = first[:playlistBatchSize]
+	}
+
+	if err := client.ReplacePlaylistTracks(p.Owner.ID, p.ID, first...); err != nil {
+		return err
+	}
+
+	return addPlaylistTracks(p, ids[len(first):])
+}
+
+// removePlaylistPositions removes the tracks at the 0-based positions of
+// items, the current tracks of the playlist. The batches are removed from the
+// end of the playlist on, so that the positions of the remaining batches stay
+// valid.
+func removePlaylistPositions(p *spotify.SimplePlaylist, items []libraryItem, positions []int) error {
+	sort.Sort(sort.Reverse(sort.IntSlice(positions)))
+
+	var tracks []spotify.TrackToRemove
+	for i, pos := range positions {
+		if i > 0 && pos == positions[i-1] {
+			continue
+		}
+		if pos < 0 || pos >= len(items) {
+			return fmt.Errorf("can't remove track %d, the playlist has %d tracks", pos+1, len(items))
+		}
+
+		ref, err := spotifyuri.ParseAs(string(items[pos].URI), spotifyuri.Track)
+		if err != nil {
+			return fmt.Errorf("can't remove track %d: %s", pos+1, err)
+		}
+		tracks = append(tracks, spotify.NewTrackToRemove(ref.ID, []int{pos}))
+	}
+
+	snapshot := p.SnapshotID
+	return inBatches(len(tracks), playlistBatchSize, func(start, end int) error {
+		var err error
+		snapshot, err = client.RemoveTracksFromPlaylistOpt(p.Owner.ID, p.ID, tracks[start:end], snapshot)
+		return err
+	})
+}
+
+// findPlaylist finds a playlist by URI, URL or ID, or else by name among the
+// current user's playlists.
+func findPlaylist(arg string) (*spotify.SimplePlaylist, error) {
+	if spotifyuri.LooksLikeURI(arg) || spotifyuri.IsID(arg) {
+		ref, err := spotifyuri.ParseAs(arg, spotifyuri.Playlist)
+		if err != nil {
+			return nil, err
+		}
+
+		owner := ref.User
+		if owner == "" {
+			if owner, err = currentUserID(); err != nil {
+				return nil, err
+			}
+		}
+
+		p, err := client.GetPlaylistOpt(owner, spotify.ID(ref.ID), "id,name,owner,public,collaborative,snapshot_id,uri,tracks.total")
+		if err != nil {
+			return nil, err
+		}
+
+		simple := p.SimplePlaylist
+		simple.Tracks.Total = uint(p.Tracks.Total)
+		return &simple, nil
+	}
+
+	playlists, err := currentUserPlaylists()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []spotify.SimplePlaylist
+	for _, p := range playlists {
+		if strings.EqualFold(p.Name, arg) {
+			matches = append(matches, p)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, playlistNotFoundError(arg)
+	case 1:
+		return &matches[0], nil
+	default:
+		var uris []string
+		for _, p := range matches {
+			uris = append(uris, fmt.Sprintf("%s (by %s)", p.URI, ownerName(p.Owner)))
+		}
+		return nil, fmt.Errorf("%d playlists are named %q, use the URI of one of them:\n  %s", len(matches), arg, strings.Join(uris, "\n  "))
+	}
+}
+
+// playlistNotFoundError is returned if none of the current user's playlists
+// has the name.
+type playlistNotFoundError string
+
+func (name playlistNotFoundError) Error() string {
+	return fmt.Sprintf("no playlist named %q", string(name))
+}
+
+// currentUserPlaylists gets all the playlists the current user owns or
+// follows.
+func currentUserPlaylists() ([]spotify.SimplePlaylist, error) {
+	var playlists []spotify.SimplePlaylist
+
+	err := allPages(func(opt *spotify.Options) (bool, error) {
+		page, err := client.CurrentUsersPlaylistsOpt(opt)
+		if err != nil {
+			return false, err
+		}
+
+		playlists = append(playlists, page.Playlists...)
+		return page.Next != "", nil
+	})
+
+	return playlists, err
+}
+
+// playlistItems gets all the tracks of a playlist in order.
+func playlistItems(p *spotify.SimplePlaylist) ([]libraryItem, error) {
+	var items []libraryItem
+
+	err := allPages(func(opt *spotify.Options) (bool, error) {
+		page, err := client.GetPlaylistTracksOpt(p.Owner.ID, p.ID, opt, "")
+		if err != nil {
+			return false, err
+		}
+
+		for _, t := range page.Tracks {
+			item := trackItem(t.Track, t.AddedAt)
+			item.AddedBy = t.AddedBy.ID
+			items = append(items, item)
+		}
+		return page.Next != "", nil
+	})
+
+	return items, err
+}
+
+// trackItem converts a track added at addedAt into a libraryItem.
+func trackItem(t spotify.FullTrack, addedAt string) libraryItem {
+	return libraryItem{
+		searchItem: searchItem{
+			Type:       "track",
+			Name:       t.Name,
+			Artists:    artistNames(t.Artists),
+			Album:      t.Album.Name,
+			Duration:   t.Duration,
+			Popularity: t.Popularity,
+			URI:        t.URI,
+			albumID:    t.Album.ID,
+		},
+		ISRC:    t.ExternalIDs["isrc"],
+		AddedAt: addedAt,
+	}
+}
+
+var currentUserIDCache string
+
+// currentUserID returns the ID of the current user, which most playlist
+// endpoints need.
+func currentUserID() (string, error) {
+	if currentUserIDCache != "" {
+		return currentUserIDCache, nil
+	}
+
+	u, err := client.CurrentUser()
+	if err != nil {
+		return "", err
+	}
+	if u.ID == "" {
+		return "", errors.New("can't get the current user")
+	}
+
+	currentUserIDCache = u.ID
+	return u.ID, nil
+}
+
+func ownerName(u spotify.User) string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+
+	return u.ID
+}
@@ -0,0 +1,779 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+// The playlist file formats.
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatM3U8 = "m3u8"
+	formatXSPF = "xspf"
+)
+
+var (
+	playlistExportCmdFlagFormat string
+	playlistExportCmdFlagOutput string
+
+	playlistImportCmdFlagFormat        string
+	playlistImportCmdFlagName          string
+	playlistImportCmdFlagReport        string
+	playlistImportCmdFlagMinConfidence float64
+	playlistImportCmdFlagConcurrency   int
+	playlistImportCmdFlagDryRun        bool
+)
+
+var playlistExportCmd = &cobra.Command{
+	Use:         "export <playlist>",
+	Short:       "Export a playlist as JSON, CSV, M3U or XSPF",
+	Long:        `Export the tracks of a playlist with their ISRC, duration, artists, album and when and by whom they were added. The format is taken from --format, or else from the extension of the --output file, and defaults to JSON.`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistExport,
+	Annotations: map[string]string{scopesAnnotation: playlistReadScopes},
+}
+
+var playlistImportCmd = &cobra.Command{
+	Use:         "import <file>",
+	Short:       "Create a playlist from a JSON, CSV, M3U or XSPF file",
+	Long:        `Create a playlist from a file and match its tracks to Spotify tracks, by ISRC first, then by Spotify URI and finally by searching for the artist and title and comparing the durations. Tracks matched with less than --min-confidence are left out. How each track was matched is written to a CSV report.`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistImport,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+// exportedPlaylist is a playlist as written by playlist export.
+type exportedPlaylist struct {
+	Name   string          `json:"name"`
+	Owner  string          `json:"owner,omitempty"`
+	URI    spotify.URI     `json:"uri,omitempty"`
+	Tracks []exportedTrack `json:"tracks"`
+}
+
+// exportedTrack is a track of an exported playlist.
+type exportedTrack struct {
+	Title    string      `json:"title"`
+	Artists  []string    `json:"artists"`
+	Album    string      `json:"album,omitempty"`
+	Duration int         `json:"duration_ms,omitempty"`
+	ISRC     string      `json:"isrc,omitempty"`
+	URI      spotify.URI `json:"uri,omitempty"`
+	AddedAt  string      `json:"added_at,omitempty"`
+	AddedBy  string      `json:"added_by,omitempty"`
+}
+
+func (t exportedTrack) String() string {
+	if len(t.Artists) == 0 {
+		return t.Title
+	}
+
+	return strings.Join(t.Artists, ", ") + " - " + t.Title
+}
+
+var csvHeader = []string{"title", "artists", "album", "duration_ms", "isrc", "uri", "added_at", "added_by"}
+
+// artistSeparator separates the artists of a track in playlist files. It
+// isn't a comma, which is part of names such as "Tyler, The Creator".
+const artistSeparator = "; "
+
+// splitArtists splits the artists of a track in a playlist file.
+func splitArtists(s string) []string {
+	var artists []string
+	for _, a := range strings.Split(s, strings.TrimSpace(artistSeparator)) {
+		if a = strings.TrimSpace(a); a != "" {
+			artists = append(artists, a)
+		}
+	}
+
+	return artists
+}
+
+func playlistExport(cmd *cobra.Command, args []string) error {
+	format, err := playlistFileFormat(playlistExportCmdFlagFormat, playlistExportCmdFlagOutput)
+	if err != nil {
+		return err
+	}
+
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	exported, err := exportPlaylist(p)
+	if err != nil {
+		return err
+	}
+
+	if playlistExportCmdFlagOutput == "" || playlistExportCmdFlagOutput == "-" {
+		return writePlaylist(os.Stdout, format, exported)
+	}
+
+	f, err := os.Create(playlistExportCmdFlagOutput)
+	if err != nil {
+		return err
+	}
+
+	if err := writePlaylist(f, format, exported); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// writePlaylist writes a playlist file in a format.
+func writePlaylist(w io.Writer, format string, p exportedPlaylist) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case formatCSV:
+		return writePlaylistCSV(w, p)
+	case formatM3U8:
+		return writePlaylistM3U8(w, p)
+	default:
+		return writePlaylistXSPF(w, p)
+	}
+}
+
+// readPlaylist reads a playlist file in a format.
+func readPlaylist(r io.Reader, format string) (exportedPlaylist, error) {
+	switch format {
+	case formatJSON:
+		var p exportedPlaylist
+		err := json.NewDecoder(r).Decode(&p)
+		return p, err
+	case formatCSV:
+		return readPlaylistCSV(r)
+	case formatM3U8:
+		return readPlaylistM3U8(r)
+	default:
+		return readPlaylistXSPF(r)
+	}
+}
+
+// exportPlaylist gets the tracks of a playlist for exporting.
+func exportPlaylist(p *spotify.SimplePlaylist) (exportedPlaylist, error) {
+	exported := exportedPlaylist{
+		Name:  p.Name,
+		Owner: ownerName(p.Owner),
+		URI:   p.URI,
+	}
+
+	items, err := playlistItems(p)
+	if err != nil {
+		return exported, err
+	}
+
+	for _, item := range items {
+		exported.Tracks = append(exported.Tracks, exportedTrack{
+			Title:    item.Name,
+			Artists:  item.Artists,
+			Album:    item.Album,
+			Duration: item.Duration,
+			ISRC:     item.ISRC,
+			URI:      item.URI,
+			AddedAt:  item.AddedAt,
+			AddedBy:  item.AddedBy,
+		})
+	}
+
+	return exported, nil
+}
+
+// playlistFileFormat returns format if it's set, or else the format of the
+// file extension of name, or else JSON.
+func playlistFileFormat(format, name string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".csv":
+			format = formatCSV
+		case ".m3u", ".m3u8":
+			format = formatM3U8
+		case ".xspf":
+			format = formatXSPF
+		default:
+			format = formatJSON
+		}
+	}
+
+	switch format {
+	case formatJSON, formatCSV, formatM3U8, formatXSPF:
+		return format, nil
+	case "m3u":
+		return formatM3U8, nil
+	default:
+		return "", fmt.Errorf("unsupported format %s", format)
+	}
+}
+
+func writePlaylistCSV(w io.Writer, p exportedPlaylist) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, t := range p.Tracks {
+		err := cw.Write([]string{
+			t.Title,
+			strings.Join(t.Artists, artistSeparator),
+			t.Album,
+			strconv.Itoa(t.Duration),
+			t.ISRC,
+			string(t.URI),
+			t.AddedAt,
+			t.AddedBy,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writePlaylistM3U8 writes an extended M3U playlist whose locations are
+// Spotify URIs.
+func writePlaylistM3U8(w io.Writer, p exportedPlaylist) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "#EXTM3U")
+	fmt.Fprintf(bw, "#PLAYLIST:%s\n", p.Name)
+	for _, t := range p.Tracks {
+		info := t.Title
+		if len(t.Artists) > 0 {
+			info = strings.Join(t.Artists, artistSeparator) + " - " + t.Title
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", t.Duration/1000, info)
+		if t.Album != "" {
+			fmt.Fprintf(bw, "#EXTALB:%s\n", t.Album)
+		}
+		fmt.Fprintln(bw, t.URI)
+	}
+
+	return bw.Flush()
+}
+
+// xspfPlaylist is the XML Shareable Playlist Format, see http://xspf.org.
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Creator string      `xml:"creator,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string     `xml:"location,omitempty"`
+	Identifier string     `xml:"identifier,omitempty"`
+	Title      string     `xml:"title,omitempty"`
+	Creator    string     `xml:"creator,omitempty"`
+	Album      string     `xml:"album,omitempty"`
+	Duration   int        `xml:"duration,omitempty"`
+	Meta       []xspfMeta `xml:"meta,omitempty"`
+}
+
+type xspfMeta struct {
+	Rel   string `xml:"rel,attr"`
+	Value string `xml:",chardata"`
+}
+
+// The rel attributes of the XSPF meta elements holding track details that
+// XSPF has no element for.
+const (
+	xspfRelISRC    = "isrc"
+	xspfRelAddedAt = "added_at"
+	xspfRelAddedBy = "added_by"
+)
+
+func writePlaylistXSPF(w io.Writer, p exportedPlaylist) error {
+	x := xspfPlaylist{Version: "1", Title: p.Name, Creator: p.Owner}
+	for _, t := range p.Tracks {
+		xt := xspfTrack{
+			Identifier: string(t.URI),
+			Title:      t.Title,
+			Creator:    strings.Join(t.Artists, artistSeparator),
+			Album:      t.Album,
+			Duration:   t.Duration,
+		}
+		if ref, err := spotifyuri.Parse(string(t.URI)); err == nil {
+			xt.Location = ref.URL()
+		}
+		for _, m := range []xspfMeta{{xspfRelISRC, t.ISRC}, {xspfRelAddedAt, t.AddedAt}, {xspfRelAddedBy, t.AddedBy}} {
+			if m.Value != "" {
+				xt.Meta = append(xt.Meta, m)
+			}
+		}
+		x.Tracks = append(x.Tracks, xt)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(x); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func playlistImport(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	format, err := playlistFileFormat(playlistImportCmdFlagFormat, name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p, err := readPlaylist(f, format)
+	if err != nil {
+		return fmt.Errorf("can't read %s: %s", name, err)
+	}
+	if len(p.Tracks) == 0 {
+		return fmt.Errorf("%s has no tracks", name)
+	}
+
+	matches := matchImportedTracks(p.Tracks, playlistImportCmdFlagConcurrency)
+
+	report := playlistImportCmdFlagReport
+	if report == "" {
+		report = strings.TrimSuffix(name, filepath.Ext(name)) + ".report.csv"
+	}
+	if err := writeImportReport(report, matches, playlistImportCmdFlagMinConfidence); err != nil {
+		return err
+	}
+
+	var ids []spotify.ID
+	for _, m := range matches {
+		if m.err == nil && m.confidence >= playlistImportCmdFlagMinConfidence {
+			ids = append(ids, m.id)
+		}
+	}
+
+	title := playlistImportCmdFlagName
+	if title == "" {
+		title = p.Name
+	}
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	}
+
+	fmt.Printf("Matched %d of %d tracks, see %s.\n", len(ids), len(matches), report)
+	if playlistImportCmdFlagDryRun || len(ids) == 0 {
+		return nil
+	}
+
+	userID, err := currentUserID()
+	if err != nil {
+		return err
+	}
+
+	created, err := client.CreatePlaylistForUser(userID, title, false)
+	if err != nil {
+		return err
+	}
+
+	if err := addPlaylistTracks(&created.SimplePlaylist, ids); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created playlist %q: %s\n", title, created.URI)
+
+	return nil
+}
+
+// readPlaylistCSV reads a CSV file with a header row. Only the title column
+// is required.
+func readPlaylistCSV(r io.Reader) (exportedPlaylist, error) {
+	var p exportedPlaylist
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return p, err
+	}
+
+	columns := make(map[string]int)
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	column := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+		}
+		return ""
+	}
+
+	if column(header, "title", "name", "track") == "" {
+		return p, errors.New("missing title column")
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return p, err
+		}
+
+		t := exportedTrack{
+			Title:   column(record, "title", "name", "track"),
+			Album:   column(record, "album"),
+			ISRC:    column(record, "isrc"),
+			URI:     spotify.URI(column(record, "uri")),
+			AddedAt: column(record, "added_at"),
+			AddedBy: column(record, "added_by"),
+		}
+		t.Artists = splitArtists(column(record, "artists", "artist"))
+		t.Duration, _ = strconv.Atoi(column(record, "duration_ms"))
+
+		p.Tracks = append(p.Tracks, t)
+	}
+
+	return p, nil
+}
+
+// readPlaylistM3U8 reads an M3U playlist. Tracks are described by their
+// #EXTINF "artist - title" and by locations that are Spotify URIs or URLs.
+func readPlaylistM3U8(r io.Reader) (exportedPlaylist, error) {
+	var (
+		p exportedPlaylist
+		t exportedTrack
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+
+		switch {
+		case line == "" || line == "#EXTM3U":
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			p.Name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#EXTALB:"):
+			t.Album = strings.TrimSpace(strings.TrimPrefix(line, "#EXTALB:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info := strings.SplitN(strings.TrimPrefix(line, "#EXTINF:"), ",", 2)
+			if secs, err := strconv.Atoi(strings.TrimSpace(info[0])); err == nil && secs > 0 {
+				t.Duration = secs * 1000
+			}
+			if len(info) == 2 {
+				t.Title = strings.TrimSpace(info[1])
+				if parts := strings.SplitN(t.Title, " - ", 2); len(parts) == 2 {
+					t.Artists = splitArtists(parts[0])
+					t.Title = strings.TrimSpace(parts[1])
+				}
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			if spotifyuri.LooksLikeURI(line) {
+				if ref, err := spotifyuri.Parse(line); err == nil {
+					t.URI = spotify.URI(ref.URI())
+				}
+			}
+			if t.Title == "" {
+				t.Title = strings.TrimSuffix(filepath.Base(line), filepath.Ext(line))
+			}
+			p.Tracks = append(p.Tracks, t)
+			t = exportedTrack{}
+		}
+	}
+
+	return p, scanner.Err()
+}
+
+func readPlaylistXSPF(r io.Reader) (exportedPlaylist, error) {
+	var x xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&x); err != nil {
+		return exportedPlaylist{}, err
+	}
+
+	p := exportedPlaylist{Name: x.Title, Owner: x.Creator}
+	for _, xt := range x.Tracks {
+		t := exportedTrack{
+			Title:    xt.Title,
+			Album:    xt.Album,
+			Duration: xt.Duration,
+		}
+		t.Artists = splitArtists(xt.Creator)
+		for _, loc := range []string{xt.Identifier, xt.Location} {
+			if ref, err := spotifyuri.Parse(loc); err == nil {
+				t.URI = spotify.URI(ref.URI())
+				break
+			}
+		}
+		for _, m := range xt.Meta {
+			switch m.Rel {
+			case xspfRelISRC:
+				t.ISRC = m.Value
+			case xspfRelAddedAt:
+				t.AddedAt = m.Value
+			case xspfRelAddedBy:
+				t.AddedBy = m.Value
+			}
+		}
+
+		p.Tracks = append(p.Tracks, t)
+	}
+
+	return p, nil
+}
+
+// importMatch is the Spotify track an imported track was matched to.
+type importMatch struct {
+	track      exportedTrack
+	id         spotify.ID
+	match      exportedTrack
+	method     string
+	confidence float64
+	err        error
+}
+
+// matchImportedTracks matches tracks to Spotify tracks using up to
+// concurrency requests at a time.
+func matchImportedTracks(tracks []exportedTrack, concurrency int) []importMatch {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, concurrency)
+		matches = make([]importMatch, len(tracks))
+	)
+	for i, t := range tracks {
+		wg.Add(1)
+		go func(m *importMatch, t exportedTrack) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			*m = matchImportedTrack(t)
+		}(&matches[i], t)
+	}
+	wg.Wait()
+
+	return matches
+}
+
+// matchImportedTrack matches t by ISRC, then by URI and finally by searching
+// for its artist and title.
+func matchImportedTrack(t exportedTrack) importMatch {
+	m := importMatch{track: t}
+
+	limit := 10
+	if t.ISRC != "" {
+		// a failed search is like no hit, the other ways may still work
+		result, err := client.SearchOpt("isrc:"+t.ISRC, spotify.SearchTypeTrack, &spotify.Options{Limit: &limit})
+		if err == nil && result.Tracks != nil && len(result.Tracks.Tracks) > 0 {
+			m.setMatch(result.Tracks.Tracks[0], "isrc", 1)
+			return m
+		}
+	}
+
+	if ref, err := spotifyuri.ParseAs(string(t.URI), spotifyuri.Track); err == nil {
+		full, err := client.GetTrack(spotify.ID(ref.ID))
+		if err == nil {
+			m.setMatch(*full, "uri", 1)
+			return m
+		}
+	}
+
+	if t.Title == "" {
+		m.err = errors.New("no title to search for")
+		return m
+	}
+
+	var artist string
+	if len(t.Artists) > 0 {
+		artist = t.Artists[0]
+	}
+	queries := []string{
+		buildSearchQuery(`track:"`+strings.Replace(t.Title, `"`, "", -1)+`"`, searchFilters{artist: artist}),
+		artist + " " + versionSuffixRe.ReplaceAllString(t.Title, ""),
+	}
+
+	for _, q := range queries {
+		result, err := client.SearchOpt(strings.TrimSpace(q), spotify.SearchTypeTrack, &spotify.Options{Limit: &limit})
+		if err != nil {
+			m.err = err
+			return m
+		}
+		if result.Tracks == nil {
+			continue
+		}
+
+		for _, candidate := range result.Tracks.Tracks {
+			if c := trackMatchConfidence(t, candidate); c > m.confidence {
+				m.setMatch(candidate, "search", c)
+			}
+		}
+		if m.confidence >= 0.9 {
+			break
+		}
+	}
+
+	if m.id == "" {
+		m.err = errors.New("no track found")
+	}
+
+	return m
+}
+
+func (m *importMatch) setMatch(t spotify.FullTrack, method string, confidence float64) {
+	m.id = t.ID
+	m.match = exportedTrack{
+		Title:    t.Name,
+		Artists:  artistNames(t.Artists),
+		Album:    t.Album.Name,
+		Duration: t.Duration,
+		URI:      t.URI,
+	}
+	m.method = method
+	m.confidence = confidence
+}
+
+// trackMatchConfidence rates from 0 to 1 how likely candidate is the track t
+// by comparing their titles, artists and durations.
+func trackMatchConfidence(t exportedTrack, candidate spotify.FullTrack) float64 {
+	title := titleSimilarity(t.Title, candidate.Name)
+
+	artist := 0.5
+	if len(t.Artists) > 0 {
+		names := normalizeTitle(strings.Join(artistNames(candidate.Artists), " "))
+		found := 0
+		for _, a := range t.Artists {
+			if a := normalizeTitle(a); a != "" && containsWords(names, a) {
+				found++
+			}
+		}
+		artist = float64(found) / float64(len(t.Artists))
+	}
+
+	if t.Duration <= 0 {
+		return 0.6*title + 0.4*artist
+	}
+
+	diff := t.Duration - candidate.Duration
+	if diff < 0 {
+		diff = -diff
+	}
+	// durations within 2s match, 30s or more apart don't
+	duration := 1 - float64(diff-2000)/28000
+	if duration > 1 {
+		duration = 1
+	} else if duration < 0 {
+		duration = 0
+	}
+
+	return 0.5*title + 0.3*artist + 0.2*duration
+}
+
+// titleSimilarity rates from 0 to 1 how similar two titles are, ignoring
+// case, punctuation and version suffixes such as "(Remastered)".
+func titleSimilarity(a, b string) float64 {
+	na, nb := normalizeTitle(a), normalizeTitle(b)
+	if na == nb {
+		return 1
+	}
+
+	ba := normalizeTitle(versionSuffixRe.ReplaceAllString(a, ""))
+	bb := normalizeTitle(versionSuffixRe.ReplaceAllString(b, ""))
+	if ba != "" && ba == bb {
+		return 0.9
+	}
+
+	// the share of the words the titles have in common
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(na) {
+		words[w] = true
+	}
+	common, total := 0, len(words)
+	for _, w := range strings.Fields(nb) {
+		if words[w] {
+			common++
+			delete(words, w)
+		} else {
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	return 0.8 * float64(common) / float64(total)
+}
+
+// writeImportReport writes how each track was matched as CSV.
+func writeImportReport(name string, matches []importMatch, minConfidence float64) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(f)
+	cw.Write([]string{"row", "track", "match", "uri", "method", "confidence", "status"})
+	for i, m := range matches {
+		status := "added"
+		switch {
+		case m.err != nil:
+			status = m.err.Error()
+		case m.confidence < minConfidence:
+			status = "skipped, low confidence"
+		}
+
+		var match string
+		if m.match.Title != "" {
+			match = m.match.String()
+		}
+
+		cw.Write([]string{
+			strconv.Itoa(i + 1),
+			m.track.String(),
+			match,
+			string(m.match.URI),
+			m.method,
+			strconv.FormatFloat(m.confidence, 'f', 2, 64),
+			status,
+		})
+	}
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+// testExportedPlaylist has tracks with several artists, an artist with a
+// comma in the name and a track without artists.
+func testExportedPlaylist() exportedPlaylist {
+	return exportedPlaylist{
+		Name:  "Road Trip",
+		Owner: "jingweno",
+		URI:   "spotify:user:jingweno:playlist:37i9dQZF1DXcBWIGoYBM5M",
+		Tracks: []exportedTrack{
+			{
+				Title:    "Get Lucky",
+				Artists:  []string{"Daft Punk", "Pharrell Williams", "Nile Rodgers"},
+				Album:    "Random Access Memories",
+				Duration: 369000,
+				ISRC:     "USQX91300108",
+				URI:      "spotify:track:69kOkLUCkxIZYexIgSG8rq",
+				AddedAt:  "2024-06-01T20:00:00Z",
+				AddedBy:  "jingweno",
+			},
+			{
+				Title:    "See You Again",
+				Artists:  []string{"Tyler, The Creator", "Kali Uchis"},
+				Album:    "Flower Boy",
+				Duration: 180000,
+				ISRC:     "USQX91701278",
+				URI:      "spotify:track:7KA4W4McWYRpgf0fWsJZWB",
+				AddedAt:  "2024-06-02T08:30:00Z",
+				AddedBy:  "friend",
+			},
+			{
+				Title:    "Sigur Rós & Friends \"Live\" <Demo>",
+				Duration: 95000,
+				URI:      "spotify:track:6rqhFgbbKwnb9MLmUQDhG6",
+			},
+		},
+	}
+}
+
+func TestPlaylistRoundTrip(t *testing.T) {
+	tests := []struct {
+		format string
+		// kept returns what of p the format keeps
+		kept func(p exportedPlaylist) exportedPlaylist
+	}{
+		{formatJSON, func(p exportedPlaylist) exportedPlaylist {
+			return p
+		}},
+		{formatCSV, func(p exportedPlaylist) exportedPlaylist {
+			return exportedPlaylist{Tracks: p.Tracks}
+		}},
+		{formatM3U8, func(p exportedPlaylist) exportedPlaylist {
+			kept := exportedPlaylist{Name: p.Name}
+			for _, t := range p.Tracks {
+				kept.Tracks = append(kept.Tracks, exportedTrack{
+					Title:    t.Title,
+					Artists:  t.Artists,
+					Album:    t.Album,
+					Duration: t.Duration,
+					URI:      t.URI,
+				})
+			}
+			return kept
+		}},
+		{formatXSPF, func(p exportedPlaylist) exportedPlaylist {
+			p.URI = ""
+			return p
+		}},
+	}
+
+	for _, tt := range tests {
+		p := testExportedPlaylist()
+
+		var b bytes.Buffer
+		if err := writePlaylist(&b, tt.format, p); err != nil {
+			t.Errorf("%s: %s", tt.format, err)
+			continue
+		}
+
+		got, err := readPlaylist(&b, tt.format)
+		if err != nil {
+			t.Errorf("%s: %s", tt.format, err)
+			continue
+		}
+		if want := tt.kept(p); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: read %+v, want %+v", tt.format, got, want)
+		}
+	}
+}
+
+func TestReadPlaylistM3U8(t *testing.T) {
+	const m3u = "\ufeff#EXTM3U\n" +
+		"#EXTINF:123,Daft Punk - One More Time\n" +
+		"/music/Daft Punk/Discovery/01 One More Time.mp3\n" +
+		"\n" +
+		"# a comment\n" +
+		"#EXTINF:-1,So What\n" +
+		"https://open.spotify.com/track/6rqhFgbbKwnb9MLmUQDhG6?si=abc\n" +
+		"/music/Unknown/Demo Take 3.flac\n"
+
+	p, err := readPlaylistM3U8(strings.NewReader(m3u))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []exportedTrack{
+		{Title: "One More Time", Artists: []string{"Daft Punk"}, Duration: 123000},
+		{Title: "So What", URI: "spotify:track:6rqhFgbbKwnb9MLmUQDhG6"},
+		{Title: "Demo Take 3"},
+	}
+	if !reflect.DeepEqual(p.Tracks, want) {
+		t.Errorf("read %+v, want %+v", p.Tracks, want)
+	}
+}
+
+func TestReadPlaylistCSV(t *testing.T) {
+	const csv = "Track,Artist,Album\n" +
+		"One More Time,Daft Punk,Discovery\n" +
+		"\"See You Again\",\"Tyler, The Creator; Kali Uchis\",Flower Boy\n" +
+		"So What\n"
+
+	p, err := readPlaylistCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []exportedTrack{
+		{Title: "One More Time", Artists: []string{"Daft Punk"}, Album: "Discovery"},
+		{Title: "See You Again", Artists: []string{"Tyler, The Creator", "Kali Uchis"}, Album: "Flower Boy"},
+		{Title: "So What"},
+	}
+	if !reflect.DeepEqual(p.Tracks, want) {
+		t.Errorf("read %+v, want %+v", p.Tracks, want)
+	}
+
+	if _, err := readPlaylistCSV(strings.NewReader("artist,album\nDaft Punk,Discovery\n")); err == nil {
+		t.Errorf("read a CSV file without title column")
+	}
+}
+
+func TestTrackMatchConfidence(t *testing.T) {
+	candidate := func(name string, duration int, artists ...string) spotify.FullTrack {
+		var c spotify.FullTrack
+		c.Name = name
+		c.Duration = duration
+		for _, a := range artists {
+			c.Artists = append(c.Artists, spotify.SimpleArtist{Name: a})
+		}
+		return c
+	}
+	getLucky := exportedTrack{Title: "Get Lucky", Artists: []string{"Daft Punk"}, Duration: 369000}
+
+	tests := []struct {
+		name      string
+		track     exportedTrack
+		candidate spotify.FullTrack
+		want      float64
+	}{
+		{"same track", getLucky, candidate("Get Lucky", 369626, "Daft Punk", "Pharrell Williams"), 1},
+		{"other version", getLucky, candidate("Get Lucky (Radio Edit)", 248000, "Daft Punk"), 0.75},
+		{"15s longer", getLucky, candidate("Get Lucky", 384000, "Daft Punk"), 0.5 + 0.3 + 0.2*(1-13.0/28)},
+		{"cover", getLucky, candidate("Get Lucky", 369000, "Some Cover Band"), 0.7},
+		{"other track", getLucky, candidate("Lose Yourself", 326000, "Eminem"), 0},
+		{
+			"no duration",
+			exportedTrack{Title: "Get Lucky", Artists: []string{"Daft Punk"}},
+			candidate("Get Lucky", 369626, "Daft Punk"),
+			1,
+		},
+		{
+			"no artists",
+			exportedTrack{Title: "Get Lucky", Duration: 369000},
+			candidate("Get Lucky", 369626, "Daft Punk"),
+			0.85,
+		},
+		{
+			"one of two artists",
+			exportedTrack{Title: "Get Lucky", Artists: []string{"Daft Punk", "Pharrell Williams"}, Duration: 369000},
+			candidate("Get Lucky", 369000, "Daft Punk"),
+			0.85,
+		},
+		{
+			"artist with a comma",
+			exportedTrack{Title: "See You Again", Artists: []string{"Tyler, The Creator"}, Duration: 180000},
+			candidate("See You Again (feat. Kali Uchis)", 180000, "Tyler, The Creator", "Kali Uchis"),
+			0.95,
+		},
+		{
+			"some words of the title",
+			exportedTrack{Title: "One More Time", Artists: []string{"Daft Punk"}},
+			candidate("One More Time Short Edit", 0, "Daft Punk"),
+			0.6*0.8*3/5 + 0.4,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := trackMatchConfidence(tt.track, tt.candidate); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: trackMatchConfidence(%s, %q) = %g, want %g", tt.name, tt.track, tt.candidate.Name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+var (
+	playlistCombineCmdFlagUnion     bool
+	playlistCombineCmdFlagIntersect bool
+	playlistCombineCmdFlagSubtract  bool
+	playlistCombineCmdFlagInto      string
+	playlistCombineCmdFlagDryRun    bool
+
+	playlistDedupeCmdFlagLoose  bool
+	playlistDedupeCmdFlagDryRun bool
+)
+
+var playlistCombineCmd = &cobra.Command{
+	Use:   "combine <playlist> <playlist>... --union|--intersect|--subtract --into <playlist>",
+	Short: "Combine the tracks of playlists into another playlist",
+	Long: `Combine the tracks of playlists into another playlist. --union takes the tracks of all the playlists, --intersect the tracks that are in every playlist and --subtract the tracks of the first playlist that aren't in any of the others. The tracks keep the order of the playlists they're taken from and each track is taken once.
+
+The tracks of the --into playlist are replaced, after saving them as a snapshot. If there's no playlist by that name, a private playlist is created.`,
+	Args:        cobra.MinimumNArgs(2),
+	RunE:        playlistCombine,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+var playlistDedupeCmd = &cobra.Command{
+	Use:         "dedupe <playlist>",
+	Short:       "Remove duplicate tracks from a playlist",
+	Long:        `Remove duplicate tracks from a playlist, keeping the first of each. Tracks are duplicates if they're the same Spotify track, have the same ISRC, or have the same artist and title, ignoring case and punctuation. With --loose, versions such as remasters and live recordings count as duplicates too.`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistDedupe,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+func playlistCombine(cmd *cobra.Command, args []string) error {
+	var op func(sets [][]libraryItem) []libraryItem
+	ops := 0
+	for _, o := range []struct {
+		set bool
+		op  func([][]libraryItem) []libraryItem
+	}{
+		{playlistCombineCmdFlagUnion, unionTracks},
+		{playlistCombineCmdFlagIntersect, intersectTracks},
+		{playlistCombineCmdFlagSubtract, subtractTracks},
+	} {
+		if o.set {
+			op = o.op
+			ops++
+		}
+	}
+	if ops != 1 {
+		return errors.New("specify one of --union, --intersect or --subtract")
+	}
+	if playlistCombineCmdFlagInto == "" {
+		return errors.New("specify the playlist to write to with --into")
+	}
+
+	var sets [][]libraryItem
+	for _, arg := range args {
+		p, err := findPlaylist(arg)
+		if err != nil {
+			return err
+		}
+
+		items, err := playlistItems(p)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, items)
+	}
+
+	var ids []spotify.ID
+	for _, item := range op(sets) {
+		ref, err := spotifyuri.ParseAs(string(item.URI), spotifyuri.Track)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, spotify.ID(ref.ID))
+	}
+
+	return writePlaylistInto(playlistCombineCmdFlagInto, ids, playlistCombineCmdFlagDryRun)
+}
+
+// writePlaylistInto replaces the tracks of the named playlist, after saving
+// them as a snapshot, or creates a private playlist if there's none by that
+// name.
+func writePlaylistInto(name string, ids []spotify.ID, dryRun bool) error {
+	into, err := findPlaylist(name)
+	if _, notFound := err.(playlistNotFoundError); err != nil && !notFound {
+		return err
+	}
+
+	if dryRun {
+		if into == nil {
+			fmt.Printf("Would create %q with %d tracks.\n", name, len(ids))
+		} else {
+			fmt.Printf("Would replace the %d tracks of %q with %d tracks.\n", into.Tracks.Total, into.Name, len(ids))
+		}
+		return nil
+	}
+
+	if into == nil {
+		userID, err := currentUserID()
+		if err != nil {
+			return err
+		}
+
+		created, err := client.CreatePlaylistForUser(userID, name, false)
+		if err != nil {
+			return err
+		}
+
+		if err := addPlaylistTracks(&created.SimplePlaylist, ids); err != nil {
+			return err
+		}
+
+		fmt.Printf("Created %q with %d tracks: %s\n", created.Name, len(ids), created.URI)
+		return nil
+	}
+
+	snap, saved, err := takeSnapshot(into)
+	if err != nil {
+		return err
+	}
+	if saved {
+		fmt.Printf("Saved the tracks of %q as snapshot %s.\n", into.Name, snap.ID)
+	}
+
+	if err := replacePlaylistTracks(into, ids); err != nil {
+		return err
+	}
+
+	fmt.Printf("Replaced the tracks of %q with %d tracks.\n", into.Name, len(ids))
+
+	return nil
+}
+
+// refreshPlaylist writes the tracks into the named playlist like
+// writePlaylistInto unless it already has those tracks in that order.
+func refreshPlaylist(name string, ids []spotify.ID, dryRun bool) error {
+	p, err := findPlaylist(name)
+	if _, notFound := err.(playlistNotFoundError); err != nil && !notFound {
+		return err
+	}
+
+	if p != nil {
+		items, err := playlistItems(p)
+		if err != nil {
+			return err
+		}
+
+		current := make([]spotify.ID, len(items))
+		for i, item := range items {
+			current[i] = trackID(item.URI)
+		}
+
+		if sameIDs(current, ids) {
+			fmt.Printf("%q is up to date with %d tracks.\n", p.Name, len(ids))
+			return nil
+		}
+	}
+
+	return writePlaylistInto(name, ids, dryRun)
+}
+
+func sameIDs(a, b []spotify.ID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// unionTracks returns the tracks of all sets.
+func unionTracks(sets [][]libraryItem) []libraryItem {
+	var union []libraryItem
+
+	seen := make(map[spotify.URI]bool)
+	for _, set := range sets {
+		for _, item := range set {
+			if !seen[item.URI] {
+				seen[item.URI] = true
+				union = append(union, item)
+			}
+		}
+	}
+
+	return union
+}
+
+// intersectTracks returns the tracks of the first set that are in all the
+// other sets.
+func intersectTracks(sets [][]libraryItem) []libraryItem {
+	counts := make(map[spotify.URI]int)
+	for _, set := range sets[1:] {
+		for uri := range trackURISet(set) {
+			counts[uri]++
+		}
+	}
+
+	var intersection []libraryItem
+	for _, item := range unionTracks(sets[:1]) {
+		if counts[item.URI] == len(sets)-1 {
+			intersection = append(intersection, item)
+		}
+	}
+
+	return intersection
+}
+
+// subtractTracks returns the tracks of the first set that aren't in any of
+// the other sets.
+func subtractTracks(sets [][]libraryItem) []libraryItem {
+	others := trackURISet(unionTracks(sets[1:]))
+
+	var difference []libraryItem
+	for _, item := range unionTracks(sets[:1]) {
+		if !others[item.URI] {
+			difference = append(difference, item)
+		}
+	}
+
+	return difference
+}
+
+func trackURISet(items []libraryItem) map[spotify.URI]bool {
+	set := make(map[spotify.URI]bool)
+	for _, item := range items {
+		set[item.URI] = true
+	}
+
+	return set
+}
+
+// duplicateTrack is a track that duplicates an earlier track of a playlist.
+type duplicateTrack struct {
+	position int
+	original int
+	reason   string
+}
+
+func playlistDedupe(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	items, err := playlistItems(p)
+	if err != nil {
+		return err
+	}
+
+	dups := findDuplicateTracks(items, playlistDedupeCmdFlagLoose)
+	if len(dups) == 0 {
+		fmt.Printf("%q has no duplicate tracks.\n", p.Name)
+		return nil
+	}
+
+	positions := make([]int, len(dups))
+	for i, d := range dups {
+		positions[i] = d.position
+		fmt.Printf("- %4d  %s (%s as %d)\n", d.position+1, trackLabel(items[d.position]), d.reason, d.original+1)
+	}
+
+	if playlistDedupeCmdFlagDryRun {
+		fmt.Printf("Would remove %d duplicates of the %d tracks of %q.\n", len(dups), len(items), p.Name)
+		return nil
+	}
+
+	if err := removePlaylistPositions(p, items, positions); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d duplicates of the %d tracks of %q.\n", len(dups), len(items), p.Name)
+
+	return nil
+}
+
+// findDuplicateTracks finds the tracks that have the same ID, ISRC or artist
+// and title as an earlier track. If loose is set, version suffixes of titles
+// such as "(Live)" or "- Remastered 2011" are ignored.
+func findDuplicateTracks(items []libraryItem, loose bool) []duplicateTrack {
+	var (
+		dups    []duplicateTrack
+		byURI   = make(map[spotify.URI]int)
+		byISRC  = make(map[string]int)
+		byTitle = make(map[string]int)
+	)
+	for i, item := range items {
+		// local files can't be removed by position
+		if !strings.HasPrefix(string(item.URI), "spotify:track:") {
+			continue
+		}
+
+		title := item.Name
+		if loose {
+			title = versionSuffixRe.ReplaceAllString(title, "")
+		}
+		var artist string
+		if len(item.Artists) > 0 {
+			artist = item.Artists[0]
+		}
+		titleKey := normalizeTitle(artist) + "\x00" + normalizeTitle(title)
+		isrc := strings.ToUpper(item.ISRC)
+
+		original, reason := -1, ""
+		if j, ok := byURI[item.URI]; ok {
+			original, reason = j, "same track"
+		} else if j, ok := byISRC[isrc]; ok && isrc != "" {
+			original, reason = j, "same ISRC"
+		} else if j, ok := byTitle[titleKey]; ok {
+			original, reason = j, "same artist and title"
+		}
+
+		if original < 0 {
+			original = i
+		} else {
+			dups = append(dups, duplicateTrack{i, original, reason})
+		}
+
+		if _, ok := byURI[item.URI]; !ok {
+			byURI[item.URI] = original
+		}
+		if _, ok := byISRC[isrc]; !ok && isrc != "" {
+			byISRC[isrc] = original
+		}
+		if _, ok := byTitle[titleKey]; !ok {
+			byTitle[titleKey] = original
+		}
+	}
+
+	return dups
+}
+
+// trackLabel formats a track as "artist - title".
+func trackLabel(item libraryItem) string {
+	if len(item.Artists) == 0 {
+		return item.Name
+	}
+
+	return strings.Join(item.Artists, ", ") + " - " + item.Name
+}
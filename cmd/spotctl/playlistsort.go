@@ -0,0 +1,334 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+var (
+	playlistSortCmdFlagBy     string
+	playlistSortCmdFlagDesc   bool
+	playlistSortCmdFlagDryRun bool
+)
+
+var playlistSortCmd = &cobra.Command{
+	Use:   "sort <playlist> --by <key>[:asc|:desc],...",
+	Short: "Sort a playlist by track metadata or audio features",
+	Long: `Sort a playlist by tempo, energy, key, added_at, release_date, artist, popularity or duration. Ties are broken by the next key and then by the current order. Keys are sorted in ascending order unless they end with :desc, or --desc is set. Keys are sorted by the Camelot wheel, 1A, 1B, 2A and so on. Tracks without a value, such as local files without audio features, go last.
+
+The tracks are moved into place with as few moves as possible, which keeps when and by whom they were added. The current order is saved as a snapshot first.`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistSort,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+// sortTrack is a playlist track with the details it can be sorted by.
+type sortTrack struct {
+	item        libraryItem
+	position    int
+	features    *spotify.AudioFeatures
+	releaseDate string
+}
+
+// sortValue is the value of a sort key of a track. Either num or str is set
+// depending on the key, ok is false if the track has no value. label is how
+// num is shown, if not as a number.
+type sortValue struct {
+	num   float64
+	str   string
+	label string
+	ok    bool
+}
+
+func (v sortValue) String() string {
+	switch {
+	case !v.ok:
+		return "-"
+	case v.label != "":
+		return v.label
+	case v.str != "":
+		return v.str
+	}
+
+	return strconv.FormatFloat(v.num, 'f', -1, 64)
+}
+
+// trackSortKey is a key playlists can be sorted by.
+type trackSortKey struct {
+	// features is set if the key needs audio features
+	features bool
+	// albums is set if the key needs album details
+	albums bool
+	value  func(t sortTrack) sortValue
+}
+
+var trackSortKeys = map[string]trackSortKey{
+	"tempo": {features: true, value: func(t sortTrack) sortValue {
+		if t.features == nil {
+			return sortValue{}
+		}
+		return sortValue{num: float64(t.features.Tempo), ok: true}
+	}},
+	"energy": {features: true, value: func(t sortTrack) sortValue {
+		if t.features == nil {
+			return sortValue{}
+		}
+		return sortValue{num: float64(t.features.Energy), ok: true}
+	}},
+	"key": {features: true, value: func(t sortTrack) sortValue {
+		if t.features == nil {
+			return sortValue{}
+		}
+		k, ok := newCamelotKey(t.features.Key, t.features.Mode)
+		return sortValue{num: float64(k.index()), label: k.String(), ok: ok}
+	}},
+	"added_at": {value: func(t sortTrack) sortValue {
+		return sortValue{str: t.item.AddedAt, ok: t.item.AddedAt != ""}
+	}},
+	"release_date": {albums: true, value: func(t sortTrack) sortValue {
+		return sortValue{str: t.releaseDate, ok: t.releaseDate != ""}
+	}},
+	"artist": {value: func(t sortTrack) sortValue {
+		if len(t.item.Artists) == 0 {
+			return sortValue{}
+		}
+		return sortValue{str: strings.Join(t.item.Artists, ", "), ok: true}
+	}},
+	"popularity": {value: func(t sortTrack) sortValue {
+		return sortValue{num: float64(t.item.Popularity), ok: true}
+	}},
+	"duration": {value: func(t sortTrack) sortValue {
+		return sortValue{num: float64(t.item.Duration), label: durationToStr(t.item.Duration), ok: t.item.Duration > 0}
+	}},
+}
+
+// sortOrder is a sort key and its direction.
+type sortOrder struct {
+	name string
+	key  trackSortKey
+	desc bool
+}
+
+// parseSortOrders parses a comma-separated list of sort keys such as
+// "key,tempo:desc". desc is the direction of keys without one.
+func parseSortOrders(s string, desc bool) ([]sortOrder, error) {
+	var orders []sortOrder
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		o := sortOrder{desc: desc}
+		if i := strings.LastIndex(field, ":"); i >= 0 {
+			switch field[i+1:] {
+			case "asc":
+				o.desc = false
+			case "desc":
+				o.desc = true
+			default:
+				return nil, fmt.Errorf("invalid sort direction %q, expected asc or desc", field[i+1:])
+			}
+			field = field[:i]
+		}
+
+		key, ok := trackSortKeys[field]
+		if !ok {
+			return nil, fmt.Errorf("unsupported sort key %s", field)
+		}
+		o.name, o.key = field, key
+
+		orders = append(orders, o)
+	}
+
+	if len(orders) == 0 {
+		return nil, errors.New("specify the keys to sort by with --by")
+	}
+
+	return orders, nil
+}
+
+// compare compares a and b in the direction of o. Missing values are greater
+// than any other regardless of the direction.
+func (o sortOrder) compare(a, b sortValue) int {
+	switch {
+	case !a.ok && !b.ok:
+		return 0
+	case !a.ok:
+		return 1
+	case !b.ok:
+		return -1
+	}
+
+	c := 0
+	if a.str != "" || b.str != "" {
+		c = strings.Compare(strings.ToLower(a.str), strings.ToLower(b.str))
+	} else if a.num < b.num {
+		c = -1
+	} else if a.num > b.num {
+		c = 1
+	}
+
+	if o.desc {
+		return -c
+	}
+
+	return c
+}
+
+// sortTracks sorts tracks stably by the orders.
+func sortTracks(tracks []sortTrack, orders []sortOrder) {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		for _, o := range orders {
+			if c := o.compare(o.key.value(tracks[i]), o.key.value(tracks[j])); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+func playlistSort(cmd *cobra.Command, args []string) error {
+	orders, err := parseSortOrders(playlistSortCmdFlagBy, playlistSortCmdFlagDesc)
+	if err != nil {
+		return err
+	}
+
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	items, err := playlistItems(p)
+	if err != nil {
+		return err
+	}
+
+	tracks, err := newSortTracks(items, orders)
+	if err != nil {
+		return err
+	}
+
+	sortTracks(tracks, orders)
+
+	order := make([]int, len(tracks))
+	for i, t := range tracks {
+		order[t.position] = i
+	}
+
+	if playlistSortCmdFlagDryRun {
+		header := []string{"#", "WAS", "TRACK"}
+		for _, o := range orders {
+			header = append(header, strings.ToUpper(o.name))
+		}
+
+		rows := make([][]string, len(tracks))
+		for i, t := range tracks {
+			rows[i] = []string{strconv.Itoa(i + 1), strconv.Itoa(t.position + 1), trackLabel(t.item)}
+			for _, o := range orders {
+				rows[i] = append(rows[i], o.key.value(t).String())
+			}
+		}
+
+		fmt.Printf("Sorting %q would take %d moves:\n", p.Name, len(reorderMoves(order)))
+		return printTable(header, rows)
+	}
+
+	snap, saved, err := takeSnapshot(p)
+	if err != nil {
+		return err
+	}
+	if saved {
+		fmt.Printf("Saved the current order of %q as snapshot %s.\n", p.Name, snap.ID)
+	}
+
+	moves, err := reorderPlaylist(p, p.SnapshotID, order)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Sorted %q with %d moves.\n", p.Name, moves)
+
+	return nil
+}
+
+// newSortTracks looks up the audio features and album details the orders
+// need.
+func newSortTracks(items []libraryItem, orders []sortOrder) ([]sortTrack, error) {
+	var needFeatures, needAlbums bool
+	for _, o := range orders {
+		needFeatures = needFeatures || o.key.features
+		needAlbums = needAlbums || o.key.albums
+	}
+
+	var (
+		ids      []spotify.ID
+		albumIDs []spotify.ID
+	)
+	for _, item := range items {
+		if id := trackID(item.URI); id != "" {
+			ids = append(ids, id)
+		}
+		if item.albumID != "" {
+			albumIDs = append(albumIDs, item.albumID)
+		}
+	}
+
+	var (
+		features map[spotify.ID]*spotify.AudioFeatures
+		albums   map[spotify.ID]*spotify.FullAlbum
+		err      error
+	)
+	if needFeatures {
+		if features, err = audioFeatures(ids); err != nil {
+			return nil, err
+		}
+	}
+	if needAlbums {
+		if albums, err = fullAlbums(uniqueIDs(albumIDs)); err != nil {
+			return nil, err
+		}
+	}
+
+	tracks := make([]sortTrack, len(items))
+	for i, item := range items {
+		tracks[i] = sortTrack{item: item, position: i, features: features[trackID(item.URI)]}
+		if a := albums[item.albumID]; a != nil {
+			tracks[i].releaseDate = a.ReleaseDate
+		}
+	}
+
+	return tracks, nil
+}
+
+// trackID returns the ID of a track URI, or an empty ID if uri isn't a
+// Spotify track, such as a local file.
+func trackID(uri spotify.URI) spotify.ID {
+	const prefix = "spotify:track:"
+	if !strings.HasPrefix(string(uri), prefix) {
+		return ""
+	}
+
+	return spotify.ID(strings.TrimPrefix(string(uri), prefix))
+}
+
+func uniqueIDs(ids []spotify.ID) []spotify.ID {
+	var unique []spotify.ID
+
+	seen := make(map[spotify.ID]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestParseSortOrders(t *testing.T) {
+	tests := []struct {
+		s    string
+		desc bool
+		// want is each key and its direction, comma separated
+		want string
+		err  bool
+	}{
+		{s: "tempo", want: "tempo asc"},
+		{s: "tempo", desc: true, want: "tempo desc"},
+		{s: "key, tempo:desc", want: "key asc, tempo desc"},
+		{s: "energy:asc,popularity", desc: true, want: "energy asc, popularity desc"},
+		{s: "tempo,,added_at:desc,", want: "tempo asc, added_at desc"},
+		{s: "", err: true},
+		{s: " , ", err: true},
+		{s: "bpm", err: true},
+		{s: "tempo:up", err: true},
+		{s: "tempo:", err: true},
+	}
+
+	for _, tt := range tests {
+		orders, err := parseSortOrders(tt.s, tt.desc)
+		if (err != nil) != tt.err {
+			t.Errorf("parseSortOrders(%q, %t) error = %v, want error %t", tt.s, tt.desc, err, tt.err)
+			continue
+		}
+
+		var got []string
+		for _, o := range orders {
+			dir := "asc"
+			if o.desc {
+				dir = "desc"
+			}
+			got = append(got, o.name+" "+dir)
+		}
+		if strings.Join(got, ", ") != tt.want {
+			t.Errorf("parseSortOrders(%q, %t) = %s, want %s", tt.s, tt.desc, strings.Join(got, ", "), tt.want)
+		}
+	}
+}
+
+// sortTestTracks are tracks named a to e in playlist order. c is a local
+// file without features, e has no key detected.
+func sortTestTracks() []sortTrack {
+	track := func(name string, artists []string, popularity, duration int, features *spotify.AudioFeatures) sortTrack {
+		return sortTrack{
+			item:     libraryItem{searchItem: searchItem{Type: "track", Name: name, Artists: artists, Popularity: popularity, Duration: duration}},
+			features: features,
+		}
+	}
+
+	tracks := []sortTrack{
+		track("a", []string{"B"}, 50, 200000, &spotify.AudioFeatures{Tempo: 120, Key: 0, Mode: 1}),
+		track("b", []string{"a"}, 50, 300000, &spotify.AudioFeatures{Tempo: 100, Key: 9, Mode: 0}),
+		track("c", nil, 70, 0, nil),
+		track("d", []string{"C"}, 80, 100000, &spotify.AudioFeatures{Tempo: 120, Key: 2, Mode: 1}),
+		track("e", nil, 20, 200000, &spotify.AudioFeatures{Tempo: 100, Key: -1}),
+	}
+	for i := range tracks {
+		tracks[i].position = i
+	}
+
+	return tracks
+}
+
+func TestSortTracks(t *testing.T) {
+	tests := []struct {
+		by   string
+		want string
+	}{
+		// ties keep the playlist order, missing values go last
+		{"tempo", "b e a d c"},
+		{"tempo:desc", "a d b e c"},
+		{"tempo:desc,popularity:desc", "d a b e c"},
+		{"tempo,popularity", "e b a d c"},
+		{"popularity", "e a b c d"},
+		{"popularity:desc", "d c a b e"},
+		// artists ignore case
+		{"artist", "b a d c e"},
+		{"artist:desc", "d a b c e"},
+		// 8A, 8B, 10B
+		{"key", "b a d c e"},
+		{"key:desc", "d a b c e"},
+		{"duration", "d a e b c"},
+		{"duration:desc", "b a e d c"},
+	}
+
+	for _, tt := range tests {
+		orders, err := parseSortOrders(tt.by, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tracks := sortTestTracks()
+		sortTracks(tracks, orders)
+
+		var got []string
+		for _, tr := range tracks {
+			got = append(got, tr.item.Name)
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("sorted by %s: %s, want %s", tt.by, strings.Join(got, " "), tt.want)
+		}
+	}
+}
+
+func TestSortOrderCompare(t *testing.T) {
+	missing := sortValue{}
+	tests := []struct {
+		a, b sortValue
+		desc bool
+		want int
+	}{
+		{sortValue{num: 1, ok: true}, sortValue{num: 2, ok: true}, false, -1},
+		{sortValue{num: 1, ok: true}, sortValue{num: 2, ok: true}, true, 1},
+		{sortValue{num: 2, ok: true}, sortValue{num: 2, ok: true}, true, 0},
+		{sortValue{str: "abba", ok: true}, sortValue{str: "ABBA", ok: true}, false, 0},
+		{sortValue{str: "2013-05-17", ok: true}, sortValue{str: "2001", ok: true}, false, 1},
+		{missing, sortValue{num: 0, ok: true}, false, 1},
+		{missing, sortValue{num: 0, ok: true}, true, 1},
+		{sortValue{num: 0, ok: true}, missing, true, -1},
+		{missing, missing, false, 0},
+	}
+
+	for _, tt := range tests {
+		if got := (sortOrder{desc: tt.desc}).compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("compare(%s, %s) desc %t = %d, want %d", tt.a, tt.b, tt.desc, got, tt.want)
+		}
+	}
+}
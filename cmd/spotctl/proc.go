@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// startDetached runs spotctl with args in a background process that outlives
+// the current one and returns its pid.
+func startDetached(args ...string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	c := exec.Command(exe, args...)
+	c.SysProcAttr = detachedProcAttr()
+	if err := c.Start(); err != nil {
+		return 0, err
+	}
+
+	pid := c.Process.Pid
+
+	return pid, c.Process.Release()
+}
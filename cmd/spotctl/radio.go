@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+var (
+	radioCmdFlagSeedArtists      []string
+	radioCmdFlagSeedGenres       []string
+	radioCmdFlagSeedTracks       []string
+	radioCmdFlagEnergy           string
+	radioCmdFlagTempo            string
+	radioCmdFlagPopularity       string
+	radioCmdFlagDanceability     string
+	radioCmdFlagValence          string
+	radioCmdFlagAcousticness     string
+	radioCmdFlagInstrumentalness string
+	radioCmdFlagLimit            int
+	radioCmdFlagSave             string
+)
+
+var radioCmd = &cobra.Command{
+	Use:   "radio",
+	Short: "Play tracks recommended from the current track or given seeds",
+	Long: `Play tracks recommended by Spotify. The recommendations are seeded by the current track and its artists, or by up to five artists, genres and tracks given with --seed-artist, --seed-genre and --seed-track. Artists and tracks can be given by URI, URL, ID or name, and "spotctl radio genres" lists the genres.
+
+The recommendations can be tuned with attributes such as --energy, --tempo and --popularity. Each takes a target value such as 120, a range such as 0.6..0.9, 0.6.. or ..0.9, or a bound such as <50 or >0.5. Energy, danceability, valence, acousticness and instrumentalness are between 0 and 1, popularity between 0 and 100 and tempo is in beats per minute.
+
+With --save, the tracks are saved as a playlist instead of played.`,
+	Args: cobra.NoArgs,
+	RunE: radio,
+}
+
+var radioGenresCmd = &cobra.Command{
+	Use:   "genres",
+	Short: "List the genres radio can be seeded by",
+	Args:  cobra.NoArgs,
+	RunE:  radioGenres,
+}
+
+// attributeRange is a target value or a range of a track attribute.
+type attributeRange struct {
+	min, max, target          float64
+	hasMin, hasMax, hasTarget bool
+}
+
+// parseAttributeRange parses a target value such as 120, a range such as
+// 0.6..0.9, 0.6.. or ..0.9, or a bound such as <50, <=50, >0.5 or >=0.5.
+func parseAttributeRange(s string) (attributeRange, error) {
+	var (
+		r   attributeRange
+		err error
+	)
+
+	parse := func(s string) (float64, error) {
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q, expected a number such as 120, a range such as 0.6..0.9 or a bound such as <50", s)
+		}
+		return n, nil
+	}
+
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.Contains(s, ".."):
+		parts := strings.SplitN(s, "..", 2)
+		if parts[0] != "" {
+			if r.min, err = parse(parts[0]); err != nil {
+				return r, err
+			}
+			r.hasMin = true
+		}
+		if parts[1] != "" {
+			if r.max, err = parse(parts[1]); err != nil {
+				return r, err
+			}
+			r.hasMax = true
+		}
+		if !r.hasMin && !r.hasMax {
+			return r, fmt.Errorf("invalid range %q, expected a range such as 0.6..0.9", s)
+		}
+		if r.hasMin && r.hasMax && r.min > r.max {
+			return r, fmt.Errorf("invalid range %q, %s is greater than %s", s, parts[0], parts[1])
+		}
+	case strings.HasPrefix(s, "<"):
+		r.max, err = parse(strings.TrimPrefix(strings.TrimPrefix(s, "<"), "="))
+		r.hasMax = true
+	case strings.HasPrefix(s, ">"):
+		r.min, err = parse(strings.TrimPrefix(strings.TrimPrefix(s, ">"), "="))
+		r.hasMin = true
+	default:
+		r.target, err = parse(s)
+		r.hasTarget = true
+	}
+
+	return r, err
+}
+
+// radioAttribute is a track attribute recommendations can be tuned by.
+type radioAttribute struct {
+	name                string
+	lowest, highest     float64
+	setMin, setMax, set func(float64) *spotify.TrackAttributes
+}
+
+// newTrackAttributes converts values, which map the names of attributes to
+// a target value or range, into track attributes.
+func newTrackAttributes(values map[string]string) (*spotify.TrackAttributes, error) {
+	ta := spotify.NewTrackAttributes()
+
+	popularity := func(set func(int) *spotify.TrackAttributes) func(float64) *spotify.TrackAttributes {
+		return func(v float64) *spotify.TrackAttributes { return set(int(v)) }
+	}
+
+	attrs := []radioAttribute{
+		{"energy", 0, 1, ta.MinEnergy, ta.MaxEnergy, ta.TargetEnergy},
+		{"tempo", 0, 1000, ta.MinTempo, ta.MaxTempo, ta.TargetTempo},
+		{"popularity", 0, 100, popularity(ta.MinPopularity), popularity(ta.MaxPopularity), popularity(ta.TargetPopularity)},
+		{"danceability", 0, 1, ta.MinDanceability, ta.MaxDanceability, ta.TargetDanceability},
+		{"valence", 0, 1, ta.MinValence, ta.MaxValence, ta.TargetValence},
+		{"acousticness", 0, 1, ta.MinAcousticness, ta.MaxAcousticness, ta.TargetAcousticness},
+		{"instrumentalness", 0, 1, ta.MinInstrumentalness, ta.MaxInstrumentalness, ta.TargetInstrumentalness},
+	}
+
+	known := make(map[string]bool)
+	for _, a := range attrs {
+		known[a.name] = true
+	}
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown attribute %s", name)
+		}
+	}
+
+	for _, a := range attrs {
+		value := values[a.name]
+		if value == "" {
+			continue
+		}
+
+		r, err := parseAttributeRange(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", a.name, err)
+		}
+
+		for _, v := range []struct {
+			set   bool
+			value float64
+			apply func(float64) *spotify.TrackAttributes
+		}{
+			{r.hasMin, r.min, a.setMin},
+			{r.hasMax, r.max, a.setMax},
+			{r.hasTarget, r.target, a.set},
+		} {
+			if !v.set {
+				continue
+			}
+			if v.value < a.lowest || v.value > a.highest {
+				return nil, fmt.Errorf("%s: %s is out of range, expected a value between %s and %s", a.name,
+					strconv.FormatFloat(v.value, 'f', -1, 64), strconv.FormatFloat(a.lowest, 'f', -1, 64), strconv.FormatFloat(a.highest, 'f', -1, 64))
+			}
+			v.apply(v.value)
+		}
+	}
+
+	return ta, nil
+}
+
+func radio(cmd *cobra.Command, args []string) error {
+	if radioCmdFlagLimit < 1 || radioCmdFlagLimit > 100 {
+		return errors.New("--limit must be between 1 and 100")
+	}
+
+	ta, err := newTrackAttributes(map[string]string{
+		"energy":           radioCmdFlagEnergy,
+		"tempo":            radioCmdFlagTempo,
+		"popularity":       radioCmdFlagPopularity,
+		"danceability":     radioCmdFlagDanceability,
+		"valence":          radioCmdFlagValence,
+		"acousticness":     radioCmdFlagAcousticness,
+		"instrumentalness": radioCmdFlagInstrumentalness,
+	})
+	if err != nil {
+		return err
+	}
+
+	seeds, names, err := radioSeeds()
+	if err != nil {
+		return err
+	}
+
+	limit := radioCmdFlagLimit
+	recs, err := client.GetRecommendations(seeds, ta, &spotify.Options{Limit: &limit})
+	if err != nil {
+		return err
+	}
+	if len(recs.Tracks) == 0 {
+		return fmt.Errorf("no recommendations for %s, try fewer attributes or wider ranges", strings.Join(names, ", "))
+	}
+
+	var (
+		uris []spotify.URI
+		ids  []spotify.ID
+	)
+	for _, t := range recs.Tracks {
+		uris = append(uris, t.URI)
+		ids = append(ids, t.ID)
+	}
+
+	if radioCmdFlagSave != "" {
+		return writePlaylistInto(radioCmdFlagSave, ids, false)
+	}
+
+	fmt.Printf("Playing %d tracks seeded by %s.\n", len(uris), strings.Join(names, ", "))
+
+	return client.PlayOpt(&spotify.PlayOptions{
+		URIs:     uris,
+		DeviceID: findDeviceByName(deviceNameFlag),
+	})
+}
+
+// radioSeeds resolves the seed flags, or seeds by the current track and its
+// artists if none are set. It also returns the names of the seeds.
+func radioSeeds() (spotify.Seeds, []string, error) {
+	var (
+		seeds spotify.Seeds
+		names []string
+	)
+
+	if len(radioCmdFlagSeedArtists)+len(radioCmdFlagSeedGenres)+len(radioCmdFlagSeedTracks) == 0 {
+		playing, err := currentlyPlaying()
+		if err != nil {
+			return seeds, nil, err
+		}
+		if playing.Item == nil {
+			return seeds, nil, errors.New("nothing is playing, give the seeds with --seed-artist, --seed-genre or --seed-track")
+		}
+
+		seeds.Tracks = []spotify.ID{playing.Item.ID}
+		names = append(names, fmt.Sprintf("%q", playing.Item.Name))
+		for _, a := range playing.Item.Artists {
+			if len(seeds.Artists) == spotify.MaxNumberOfSeeds-1 {
+				break
+			}
+			seeds.Artists = append(seeds.Artists, a.ID)
+			names = append(names, a.Name)
+		}
+
+		return seeds, names, nil
+	}
+
+	if n := len(radioCmdFlagSeedArtists) + len(radioCmdFlagSeedGenres) + len(radioCmdFlagSeedTracks); n > spotify.MaxNumberOfSeeds {
+		return seeds, nil, fmt.Errorf("radio takes up to %d seeds, got %d", spotify.MaxNumberOfSeeds, n)
+	}
+
+	for _, arg := range radioCmdFlagSeedArtists {
+		id, name, err := findSeed(arg, spotifyuri.Artist)
+		if err != nil {
+			return seeds, nil, err
+		}
+		seeds.Artists = append(seeds.Artists, id)
+		names = append(names, name)
+	}
+
+	for _, arg := range radioCmdFlagSeedTracks {
+		id, name, err := findSeed(arg, spotifyuri.Track)
+		if err != nil {
+			return seeds, nil, err
+		}
+		seeds.Tracks = append(seeds.Tracks, id)
+		names = append(names, fmt.Sprintf("%q", name))
+	}
+
+	if len(radioCmdFlagSeedGenres) > 0 {
+		genres, err := client.GetAvailableGenreSeeds()
+		if err != nil {
+			return seeds, nil, err
+		}
+
+		for _, g := range radioCmdFlagSeedGenres {
+			g = strings.ToLower(strings.TrimSpace(g))
+			if !containsString(genres, g) {
+				return seeds, nil, unknownGenreError(g, genres)
+			}
+			seeds.Genres = append(seeds.Genres, g)
+			names = append(names, g)
+		}
+	}
+
+	return seeds, names, nil
+}
+
+// findSeed resolves a URI, URL or ID of type t, or searches for the best
+// match of type t by name. It returns the ID and name of what it found.
+func findSeed(arg string, t spotifyuri.Type) (spotify.ID, string, error) {
+	if spotifyuri.LooksLikeURI(arg) || spotifyuri.IsID(arg) {
+		ref, err := spotifyuri.ParseAs(arg, t)
+		if err != nil {
+			return "", "", err
+		}
+		return spotify.ID(ref.ID), arg, nil
+	}
+
+	st, err := parseSearchTypes(string(t))
+	if err != nil {
+		return "", "", err
+	}
+
+	items, err := searchItems(arg, st, 10, 0, "")
+	if err != nil {
+		return "", "", err
+	}
+	if len(items) == 0 {
+		return "", "", fmt.Errorf("no %s found for %q", t, arg)
+	}
+
+	best := rankSearchItems(arg, items)[0].item
+	ref, err := spotifyuri.ParseAs(string(best.URI), t)
+	if err != nil {
+		return "", "", err
+	}
+
+	return spotify.ID(ref.ID), best.Name, nil
+}
+
+func unknownGenreError(genre string, genres []string) error {
+	var similar []string
+	for _, g := range genres {
+		if strings.Contains(g, genre) || strings.Contains(genre, g) {
+			similar = append(similar, g)
+		}
+	}
+
+	if len(similar) == 0 {
+		return fmt.Errorf("unknown genre %q, see spotctl radio genres", genre)
+	}
+
+	return fmt.Errorf("unknown genre %q, did you mean %s?", genre, strings.Join(similar, ", "))
+}
+
+func radioGenres(cmd *cobra.Command, args []string) error {
+	genres, err := client.GetAvailableGenreSeeds()
+	if err != nil {
+		return err
+	}
+
+	for _, g := range genres {
+		fmt.Println(g)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// rankedItem is a search result scored against a query.
+type rankedItem struct {
+	item    searchItem
+	score   float64
+	reasons []string
+}
+
+func (r *rankedItem) add(score float64, reason string) {
+	r.score += score
+	r.reasons = append(r.reasons, fmt.Sprintf("%+.0f %s", score, reason))
+}
+
+var (
+	quotedPhraseRe = regexp.MustCompile(`"([^"]+)"`)
+	// version suffixes such as "(Remastered 2009)" or "- Live at Wembley"
+	versionSuffixRe = regexp.MustCompile(`\s*(\([^)]*\)|\[[^\]]*\]|\s-\s.*)$`)
+)
+
+// typeBias slightly prefers collections over single tracks and official
+// collections over user playlists, whose names often match loosely.
+var typeBias = map[string]float64{
+	"album":    3,
+	"artist":   2,
+	"track":    0,
+	"playlist": -2,
+}
+
+// rankSearchItems scores items against query and returns them best match
+// first. It rewards exact and normalized name matches, query words that
+// match the name or artists, quoted phrases and popularity.
+func rankSearchItems(query string, items []searchItem) []rankedItem {
+	var phrases []string
+	for _, m := range quotedPhraseRe.FindAllStringSubmatch(query, -1) {
+		if p := normalizeTitle(m[1]); p != "" {
+			phrases = append(phrases, p)
+		}
+	}
+
+	rawQuery := strings.TrimSpace(strings.Replace(query, `"`, "", -1))
+	normQuery := normalizeTitle(rawQuery)
+	queryWords := strings.Fields(normQuery)
+
+	ranked := make([]rankedItem, len(items))
+	for i, item := range items {
+		r := rankedItem{item: item}
+
+		name := normalizeTitle(item.Name)
+		baseName := normalizeTitle(versionSuffixRe.ReplaceAllString(item.Name, ""))
+
+		var artists []string
+		if item.Type == "track" || item.Type == "album" {
+			for _, a := range item.Artists {
+				artists = append(artists, normalizeTitle(a))
+			}
+		}
+
+		switch {
+		case strings.EqualFold(strings.TrimSpace(item.Name), rawQuery):
+			r.add(100, "exact name match")
+		case name != "" && (name == normQuery || baseName == normQuery):
+			r.add(80, "normalized name match")
+		case name != "" && containsWords(normQuery, name):
+			r.add(50, "name in query")
+		case normQuery != "" && containsWords(name, normQuery):
+			r.add(30, "query in name")
+		}
+
+		for _, a := range artists {
+			if a != "" && containsWords(normQuery, a) {
+				r.add(25, "artist "+a+" in query")
+				if rest := strings.TrimSpace(removeWords(normQuery, a)); rest != "" && (rest == name || rest == baseName) {
+					r.add(40, "name and artist match query")
+				}
+				break
+			}
+		}
+
+		if len(queryWords) > 0 {
+			words := strings.Fields(name + " " + strings.Join(artists, " "))
+			matched := 0
+			for _, w := range queryWords {
+				for _, v := range words {
+					if w == v {
+						matched++
+						break
+					}
+				}
+			}
+			if matched > 0 {
+				r.add(20*float64(matched)/float64(len(queryWords)), fmt.Sprintf("%d/%d query words match", matched, len(queryWords)))
+			}
+		}
+
+		for _, p := range phrases {
+			if containsWords(name, p) {
+				r.add(30, fmt.Sprintf("quoted phrase %q in name", p))
+			} else if containsWords(strings.Join(artists, " "), p) {
+				r.add(15, fmt.Sprintf("quoted phrase %q in artist", p))
+			}
+		}
+
+		if item.Popularity > 0 {
+			r.add(float64(item.Popularity)/10, fmt.Sprintf("popularity %d", item.Popularity))
+		}
+
+		if bias := typeBias[item.Type]; bias != 0 {
+			r.add(bias, item.Type)
+		}
+
+		ranked[i] = r
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	return ranked
+}
+
+// normalizeTitle lowercases s, replaces punctuation with spaces, collapses
+// whitespace and drops a leading "the".
+func normalizeTitle(s string) string {
+	s = strings.Replace(strings.ToLower(s), "&", " and ", -1)
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		if r == '\'' || r == '’' {
+			return -1
+		}
+		return ' '
+	}, s)
+
+	words := strings.Fields(s)
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// containsWords reports whether the normalized string s contains sub as a
+// sequence of whole words.
+func containsWords(s, sub string) bool {
+	return strings.Contains(" "+s+" ", " "+sub+" ")
+}
+
+// removeWords removes the first occurrence of the words of sub from s.
+func removeWords(s, sub string) string {
+	return strings.Replace(" "+s+" ", " "+sub+" ", " ", 1)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/zmb3/spotify"
+)
+
+func TestRankSearchItems(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		items []searchItem
+		// want is the URI of the best match
+		want spotify.URI
+	}{
+		{
+			name:  "exact title beats a more popular partial match",
+			query: "Yesterday",
+			items: []searchItem{
+				{Type: "track", Name: "Yesterday Once More", Artists: []string{"Carpenters"}, Popularity: 90, URI: "partial"},
+				{Type: "track", Name: "Yesterday", Artists: []string{"The Beatles"}, Popularity: 60, URI: "exact"},
+			},
+			want: "exact",
+		},
+		{
+			name:  "exact title ignores case and surrounding space",
+			query: "  let it be ",
+			items: []searchItem{
+				{Type: "track", Name: "Let It Be Me", Popularity: 50, URI: "partial"},
+				{Type: "track", Name: "Let It Be", Popularity: 50, URI: "exact"},
+			},
+			want: "exact",
+		},
+		{
+			name:  "remaster suffix matches the plain title",
+			query: "bohemian rhapsody",
+			items: []searchItem{
+				{Type: "track", Name: "Bohemian Rhapsody Tribute Medley", Popularity: 40, URI: "medley"},
+				{Type: "track", Name: "Bohemian Rhapsody (Remastered 2011)", Artists: []string{"Queen"}, Popularity: 40, URI: "remaster"},
+			},
+			want: "remaster",
+		},
+		{
+			name:  "feat suffix matches the plain title",
+			query: "stay",
+			items: []searchItem{
+				{Type: "track", Name: "Stay With Me", Popularity: 70, URI: "partial"},
+				{Type: "track", Name: "Stay (feat. Justin Bieber)", Artists: []string{"The Kid LAROI"}, Popularity: 70, URI: "feat"},
+			},
+			want: "feat",
+		},
+		{
+			name:  "dash suffix matches the plain title",
+			query: "heroes",
+			items: []searchItem{
+				{Type: "track", Name: "Heroes of Our Time", Popularity: 50, URI: "partial"},
+				{Type: "track", Name: "Heroes - 2017 Remaster", Artists: []string{"David Bowie"}, Popularity: 50, URI: "remaster"},
+			},
+			want: "remaster",
+		},
+		{
+			name:  "artist words in the query pick the original over a cover",
+			query: "queen bohemian rhapsody",
+			items: []searchItem{
+				{Type: "track", Name: "Bohemian Rhapsody", Artists: []string{"Pentatonix"}, Popularity: 60, URI: "cover"},
+				{Type: "track", Name: "Bohemian Rhapsody", Artists: []string{"Queen"}, Popularity: 60, URI: "original"},
+			},
+			want: "original",
+		},
+		{
+			name:  "artist words match after normalization",
+			query: "simon and garfunkel the boxer",
+			items: []searchItem{
+				{Type: "track", Name: "The Boxer", Artists: []string{"Mumford & Sons"}, Popularity: 65, URI: "cover"},
+				{Type: "track", Name: "The Boxer", Artists: []string{"Simon & Garfunkel"}, Popularity: 60, URI: "original"},
+			},
+			want: "original",
+		},
+		{
+			name:  "popularity breaks ties",
+			query: "intro",
+			items: []searchItem{
+				{Type: "track", Name: "Intro", Artists: []string{"Someone"}, Popularity: 20, URI: "obscure"},
+				{Type: "track", Name: "Intro", Artists: []string{"The xx"}, Popularity: 75, URI: "popular"},
+			},
+			want: "popular",
+		},
+		{
+			name:  "albums are preferred over tracks of the same name",
+			query: "abbey road",
+			items: []searchItem{
+				{Type: "track", Name: "Abbey Road", Popularity: 50, URI: "track"},
+				{Type: "playlist", Name: "Abbey Road", Popularity: 50, URI: "playlist"},
+				{Type: "album", Name: "Abbey Road", Popularity: 50, URI: "album"},
+			},
+			want: "album",
+		},
+		{
+			name:  "artists are preferred over playlists of the same name",
+			query: "radiohead",
+			items: []searchItem{
+				{Type: "playlist", Name: "Radiohead", URI: "playlist"},
+				{Type: "artist", Name: "Radiohead", URI: "artist"},
+			},
+			want: "artist",
+		},
+		{
+			name:  "a better match outweighs the type preference",
+			query: "blackbird",
+			items: []searchItem{
+				{Type: "album", Name: "Blackbird Sessions", Popularity: 50, URI: "album"},
+				{Type: "track", Name: "Blackbird", Popularity: 50, URI: "track"},
+			},
+			want: "track",
+		},
+		{
+			name:  "quoted phrases must match",
+			query: `"dark side" pink floyd`,
+			items: []searchItem{
+				{Type: "album", Name: "The Wall", Artists: []string{"Pink Floyd"}, Popularity: 80, URI: "wall"},
+				{Type: "album", Name: "The Dark Side of the Moon", Artists: []string{"Pink Floyd"}, Popularity: 80, URI: "dark side"},
+			},
+			want: "dark side",
+		},
+	}
+
+	for _, tt := range tests {
+		ranked := rankSearchItems(tt.query, tt.items)
+		if len(ranked) != len(tt.items) {
+			t.Errorf("%s: got %d items, want %d", tt.name, len(ranked), len(tt.items))
+			continue
+		}
+		if got := ranked[0].item.URI; got != tt.want {
+			t.Errorf("%s: best match is %s (%.1f: %v), want %s", tt.name, got, ranked[0].score, ranked[0].reasons, tt.want)
+		}
+		for i := 1; i < len(ranked); i++ {
+			if ranked[i].score > ranked[i-1].score {
+				t.Errorf("%s: items aren't sorted by score", tt.name)
+				break
+			}
+		}
+	}
+}
+
+func TestRankSearchItemsKeepsOrderOfEqualScores(t *testing.T) {
+	items := []searchItem{
+		{Type: "track", Name: "Song", URI: "first"},
+		{Type: "track", Name: "Song", URI: "second"},
+	}
+
+	ranked := rankSearchItems("song", items)
+	if ranked[0].item.URI != "first" || ranked[1].item.URI != "second" {
+		t.Errorf("got %s, %s, want first, second", ranked[0].item.URI, ranked[1].item.URI)
+	}
+}
+
+func TestRankSearchItemsNoItems(t *testing.T) {
+	if ranked := rankSearchItems("anything", nil); len(ranked) != 0 {
+		t.Errorf("got %d items, want none", len(ranked))
+	}
+}
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Bohemian Rhapsody", "bohemian rhapsody"},
+		{"  Don't   Stop  Me Now ", "dont stop me now"},
+		{"Don’t Stop", "dont stop"},
+		{"Simon & Garfunkel", "simon and garfunkel"},
+		{"AC/DC", "ac dc"},
+		{"Stay (feat. Justin Bieber)", "stay feat justin bieber"},
+		{"Heroes - 2017 Remaster", "heroes 2017 remaster"},
+		{"The Beatles", "beatles"},
+		{"The", "the"},
+		{"Sigur Rós", "sigur rós"},
+		{"99 Luftballons", "99 luftballons"},
+		{"", ""},
+		{"!!!", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeTitle(tt.in); got != tt.want {
+			t.Errorf("normalizeTitle(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestContainsWords(t *testing.T) {
+	tests := []struct {
+		s, sub string
+		want   bool
+	}{
+		{"queen bohemian rhapsody", "queen", true},
+		{"queen bohemian rhapsody", "bohemian rhapsody", true},
+		{"queen bohemian rhapsody", "queen bohemian rhapsody", true},
+		{"queen bohemian rhapsody", "rhapsody queen", false},
+		{"queensryche silent lucidity", "queen", false},
+		{"let it be", "it", true},
+		{"let it be", "t i", false},
+		{"let it be", "", false},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		if got := containsWords(tt.s, tt.sub); got != tt.want {
+			t.Errorf("containsWords(%q, %q) = %t, want %t", tt.s, tt.sub, got, tt.want)
+		}
+	}
+}
+
+func TestParseURIArg(t *testing.T) {
+	const id = "6rqhFgbbKwnb9MLmUQDhG6"
+
+	tests := []struct {
+		arg, t string
+		want   spotifyuri.Ref
+		ok     bool
+		err    bool
+	}{
+		{arg: id, t: "auto", want: spotifyuri.Ref{Type: spotifyuri.Track, ID: id}, ok: true},
+		{arg: id, t: "", want: spotifyuri.Ref{Type: spotifyuri.Track, ID: id}, ok: true},
+		{arg: id, t: "album", want: spotifyuri.Ref{Type: spotifyuri.Album, ID: id}, ok: true},
+		{arg: "spotify:artist:" + id, t: "auto", want: spotifyuri.Ref{Type: spotifyuri.Artist, ID: id}, ok: true},
+		{arg: "https://open.spotify.com/playlist/" + id + "?si=abc", t: "track", want: spotifyuri.Ref{Type: spotifyuri.Playlist, ID: id}, ok: true},
+		{arg: "yesterday", t: "auto"},
+		{arg: id, t: "track,album"},
+		{arg: "spotify:track:bad", t: "auto", err: true},
+	}
+
+	for _, tt := range tests {
+		ref, ok, err := parseURIArg(tt.arg, tt.t)
+		if (err != nil) != tt.err {
+			t.Errorf("parseURIArg(%q, %q) error = %v, want error %t", tt.arg, tt.t, err, tt.err)
+			continue
+		}
+		if ok != tt.ok || ref != tt.want {
+			t.Errorf("parseURIArg(%q, %q) = %+v, %t, want %+v, %t", tt.arg, tt.t, ref, ok, tt.want, tt.ok)
+		}
+	}
+}
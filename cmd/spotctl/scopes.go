@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/zmb3/spotify"
+)
+
+// scopesAnnotation is the cobra.Command annotation listing the
+// space-separated scopes a command requires in addition to defaultScopes.
+// Flags annotated with it require their scopes only when they're set.
+const scopesAnnotation = "scopes"
+
+// defaultScopes are the scopes every command may use. Tokens saved without
+// a list of scopes were granted these.
+var defaultScopes = []string{
+	spotify.ScopeUserReadCurrentlyPlaying,
+	spotify.ScopeUserReadPlaybackState,
+	spotify.ScopeUserModifyPlaybackState,
+}
+
+// requiredScopes returns the scopes required by cmd and the flags it was
+// run with.
+func requiredScopes(cmd *cobra.Command) []string {
+	scopes := append(append([]string{}, defaultScopes...), strings.Fields(cmd.Annotations[scopesAnnotation])...)
+
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		scopes = append(scopes, f.Annotations[scopesAnnotation]...)
+	})
+
+	return scopes
+}
+
+// missingScopes returns the scopes of required that aren't in granted.
+func missingScopes(granted, required []string) []string {
+	var missing []string
+	for _, r := range required {
+		if !containsScope(granted, r) && !containsScope(missing, r) {
+			missing = append(missing, r)
+		}
+	}
+
+	return missing
+}
+
+// hasScope reports whether the token in use was granted scope.
+func hasScope(scope string) bool {
+	return containsScope(tokenScopes, scope)
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+const (
+	scrobbleQueueFile = "scrobbles.json"
+
+	// scrobbleMinDuration is the duration tracks must exceed to be
+	// scrobbled.
+	scrobbleMinDuration = 30 * time.Second
+	// scrobbleMaxListened is the time listened after which a track is
+	// scrobbled even if less than half of it was listened.
+	scrobbleMaxListened = 4 * time.Minute
+	// scrobbleRetryInterval is how often log --scrobble retries queued
+	// scrobbles after a failure.
+	scrobbleRetryInterval = 5 * time.Minute
+)
+
+var scrobbleHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+var scrobbleCmd = &cobra.Command{
+	Use:   "scrobble",
+	Short: "Scrobble your plays to Last.fm and ListenBrainz",
+	Long: `Plays are scrobbled while "spotctl log --scrobble" runs, to Last.fm, ListenBrainz or other services speaking their protocols, such as Libre.fm. A play is scrobbled once half of the track or 4 minutes of it were listened, whichever comes first, and tracks of 30 seconds or less aren't scrobbled. Scrobbles that can't be submitted are queued in ~/.spotctl.d/scrobbles.json and submitted again later.
+
+The services are set up in ~/.spotctl.d/config.json, for example:
+
+  {
+    "scrobble": {
+      "lastfm": {"api_key": "...", "secret": "..."},
+      "listenbrainz": {"token": "..."}
+    }
+  }
+
+Either takes a base_url to use another service, and lastfm an auth_url for its authorization page. Run "spotctl scrobble login" once to allow spotctl to scrobble to Last.fm.`,
+}
+
+var scrobbleLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Allow spotctl to scrobble to Last.fm",
+	Args:  cobra.NoArgs,
+	RunE:  scrobbleLogin,
+}
+
+var scrobbleFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Submit the queued scrobbles",
+	Args:  cobra.NoArgs,
+	RunE:  scrobbleFlush,
+}
+
+// scrobbleConfig is the scrobble section of the config file.
+type scrobbleConfig struct {
+	LastFM       *lastFMConfig       `json:"lastfm,omitempty"`
+	ListenBrainz *listenBrainzConfig `json:"listenbrainz,omitempty"`
+}
+
+// scrobble is a play as submitted to scrobbling services.
+type scrobble struct {
+	StartedAt time.Time   `json:"started_at"`
+	URI       spotify.URI `json:"uri,omitempty"`
+	Track     string      `json:"track"`
+	Artist    string      `json:"artist"`
+	Album     string      `json:"album,omitempty"`
+	Duration  int         `json:"duration_ms,omitempty"`
+}
+
+// newScrobble makes a scrobble of a play. Scrobbles name the main artist
+// only.
+func newScrobble(r listenRecord) scrobble {
+	s := scrobble{
+		StartedAt: r.StartedAt,
+		URI:       r.URI,
+		Track:     r.Name,
+		Album:     r.Album,
+		Duration:  r.Duration,
+	}
+	if len(r.Artists) > 0 {
+		s.Artist = r.Artists[0]
+	}
+
+	return s
+}
+
+// scrobbleWorthy reports whether a play is scrobbled: the track is longer
+// than scrobbleMinDuration and half of it or scrobbleMaxListened of it were
+// listened.
+func scrobbleWorthy(r listenRecord) bool {
+	if r.Duration <= int(scrobbleMinDuration/time.Millisecond) || len(r.Artists) == 0 {
+		return false
+	}
+
+	return r.Listened >= minInt(r.Duration/2, int(scrobbleMaxListened/time.Millisecond))
+}
+
+// scrobbler submits plays to a scrobbling service.
+type scrobbler interface {
+	// name names the service in messages and in the queue.
+	name() string
+	// batchSize is the most scrobbles submit takes at once.
+	batchSize() int
+	// submit submits scrobbles in the order they were played.
+	submit(ss []scrobble) error
+	// nowPlaying tells the service what's playing.
+	nowPlaying(s scrobble) error
+}
+
+// scrobbleError is an error returned by a scrobbling service. Scrobbles
+// failing with temporary errors are retried later, others are dropped.
+// Config errors, such as an invalid API key, fail every scrobble until the
+// config file is fixed, so their scrobbles are kept too.
+type scrobbleError struct {
+	service   string
+	msg       string
+	temporary bool
+	config    bool
+}
+
+func (e *scrobbleError) Error() string {
+	return e.service + ": " + e.msg
+}
+
+// permanentScrobbleError reports whether retrying the scrobbles won't help.
+// Errors other than scrobbleError, such as network errors, are temporary.
+func permanentScrobbleError(err error) bool {
+	e, ok := err.(*scrobbleError)
+	return ok && !e.temporary && !e.config
+}
+
+// configuredScrobblers returns the scrobblers set up in the config file.
+func configuredScrobblers() ([]scrobbler, error) {
+	c, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var scrobblers []scrobbler
+
+	if c.Scrobble.LastFM != nil {
+		l, err := newLastFM(*c.Scrobble.LastFM)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.loadSession(); err != nil {
+			return nil, err
+		}
+		scrobblers = append(scrobblers, l)
+	}
+
+	if c.Scrobble.ListenBrainz != nil {
+		l, err := newListenBrainz(*c.Scrobble.ListenBrainz)
+		if err != nil {
+			return nil, err
+		}
+		scrobblers = append(scrobblers, l)
+	}
+
+	if len(scrobblers) == 0 {
+		return nil, errors.New(`no scrobbling service is set up in the config file, see "spotctl scrobble --help"`)
+	}
+
+	return scrobblers, nil
+}
+
+// readScrobbleQueue reads the scrobbles queued for each service. A missing
+// queue is empty.
+func readScrobbleQueue() (map[string][]scrobble, error) {
+	path, err := dataFilePath(scrobbleQueueFile)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := make(map[string][]scrobble)
+	if err := readJSONFile(path, &queue); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// submitScrobbles submits the queued scrobbles of each scrobbler followed by
+// ss. The scrobbles that failed with temporary or config errors are queued
+// again, and the service isn't submitted to any further.
+func submitScrobbles(scrobblers []scrobbler, ss []scrobble) error {
+	queue, err := readScrobbleQueue()
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, s := range scrobblers {
+		pending := append(append([]scrobble{}, queue[s.name()]...), ss...)
+		delete(queue, s.name())
+
+		for len(pending) > 0 {
+			n := minInt(len(pending), s.batchSize())
+
+			err := s.submit(pending[:n])
+			if err != nil && !permanentScrobbleError(err) {
+				// keep the rest in order for the next time
+				queue[s.name()] = pending
+				errs = append(errs, fmt.Sprintf("%s, %d scrobbles queued", err, len(pending)))
+				break
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s, %d scrobbles dropped", err, n))
+			}
+
+			pending = pending[n:]
+		}
+	}
+
+	path, err := dataFilePath(scrobbleQueueFile)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONFile(path, queue); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// liveScrobbler scrobbles the plays of a listenTracker as they complete and
+// tells what's playing.
+type liveScrobbler struct {
+	scrobblers []scrobbler
+	announced  *listenRecord
+	// retryAt is when the queue is submitted again if no play completes
+	// before.
+	retryAt time.Time
+}
+
+func newLiveScrobbler(now time.Time) (*liveScrobbler, error) {
+	scrobblers, err := configuredScrobblers()
+	if err != nil {
+		return nil, err
+	}
+
+	// plays queued by earlier runs are submitted right away
+	return &liveScrobbler{scrobblers: scrobblers, retryAt: now}, nil
+}
+
+// update scrobbles the completed plays done and announces cur, the play in
+// progress, if it's new and playing. Failures are printed and retried
+// later.
+func (l *liveScrobbler) update(now time.Time, done []listenRecord, cur *listenRecord, playing bool) {
+	var ss []scrobble
+	for _, r := range done {
+		if scrobbleWorthy(r) {
+			ss = append(ss, newScrobble(r))
+		}
+	}
+
+	if len(ss) > 0 || (!l.retryAt.IsZero() && !now.Before(l.retryAt)) {
+		l.retryAt = time.Time{}
+		if err := submitScrobbles(l.scrobblers, ss); err != nil {
+			fmt.Printf("%s Scrobbling failed: %s\n", now.Format(time.Stamp), err)
+			l.retryAt = now.Add(scrobbleRetryInterval)
+		}
+	}
+
+	if cur != nil && cur != l.announced && playing && len(cur.Artists) > 0 {
+		l.announced = cur
+		for _, s := range l.scrobblers {
+			if err := s.nowPlaying(newScrobble(*cur)); err != nil {
+				fmt.Printf("%s Updating now playing failed: %s\n", now.Format(time.Stamp), err)
+			}
+		}
+	}
+}
+
+func scrobbleLogin(cmd *cobra.Command, args []string) error {
+	c, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if c.Scrobble.LastFM == nil {
+		return errors.New(`set up lastfm in the scrobble section of the config file first, see "spotctl scrobble --help"`)
+	}
+
+	l, err := newLastFM(*c.Scrobble.LastFM)
+	if err != nil {
+		return err
+	}
+
+	return l.login()
+}
+
+func scrobbleFlush(cmd *cobra.Command, args []string) error {
+	scrobblers, err := configuredScrobblers()
+	if err != nil {
+		return err
+	}
+
+	queue, err := readScrobbleQueue()
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, s := range scrobblers {
+		n += len(queue[s.name()])
+	}
+	if n == 0 {
+		fmt.Println("No scrobbles are queued.")
+		return nil
+	}
+
+	if err := submitScrobbles(scrobblers, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("Submitted %d queued scrobbles.\n", n)
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTempDataDir points dataDir to a new temporary directory until cleanup
+// is called.
+func useTempDataDir(t *testing.T) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "spotctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := dataDir
+	dataDir = dir
+
+	return dir, func() {
+		dataDir = old
+		os.RemoveAll(dir)
+	}
+}
+
+// fakeScrobbler records the scrobbles submitted to it and fails the calls
+// with errs in turn.
+type fakeScrobbler struct {
+	service string
+	size    int
+	errs    []error
+	batches [][]string
+}
+
+func (s *fakeScrobbler) name() string {
+	return s.service
+}
+
+func (s *fakeScrobbler) batchSize() int {
+	return s.size
+}
+
+func (s *fakeScrobbler) submit(ss []scrobble) error {
+	var tracks []string
+	for _, sc := range ss {
+		tracks = append(tracks, sc.Track)
+	}
+	s.batches = append(s.batches, tracks)
+
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+
+	return err
+}
+
+func (s *fakeScrobbler) nowPlaying(sc scrobble) error {
+	return nil
+}
+
+func testScrobbles(tracks ...string) []scrobble {
+	ss := make([]scrobble, len(tracks))
+	for i, track := range tracks {
+		ss[i] = scrobble{
+			StartedAt: time.Date(2024, time.June, 15, 12, i, 0, 0, time.UTC),
+			Track:     track,
+			Artist:    "Artist",
+		}
+	}
+
+	return ss
+}
+
+func scrobbleTracks(ss []scrobble) string {
+	var tracks []string
+	for _, s := range ss {
+		tracks = append(tracks, s.Track)
+	}
+
+	return strings.Join(tracks, " ")
+}
+
+func TestSubmitScrobbles(t *testing.T) {
+	temporary := &scrobbleError{service: "fake", msg: "down", temporary: true}
+	permanent := &scrobbleError{service: "fake", msg: "invalid"}
+	config := &scrobbleError{service: "fake", msg: "invalid API key", config: true}
+
+	tests := []struct {
+		name   string
+		queued []string
+		new    []string
+		errs   []error
+		// batches are the tracks of each submit call, space separated
+		batches []string
+		// left are the tracks queued afterwards
+		left string
+		// err is part of the error returned
+		err string
+	}{
+		{
+			name:    "queued scrobbles go first",
+			queued:  []string{"q1", "q2"},
+			new:     []string{"n1"},
+			batches: []string{"q1 q2", "n1"},
+		},
+		{
+			name:    "nothing to submit",
+			batches: nil,
+		},
+		{
+			name:    "temporary errors queue the rest",
+			new:     []string{"n1", "n2", "n3", "n4", "n5"},
+			errs:    []error{nil, temporary},
+			batches: []string{"n1 n2", "n3 n4"},
+			left:    "n3 n4 n5",
+			err:     "fake: down, 3 scrobbles queued",
+		},
+		{
+			name:    "network errors are temporary",
+			queued:  []string{"q1"},
+			new:     []string{"n1"},
+			errs:    []error{errors.New("connection refused")},
+			batches: []string{"q1 n1"},
+			left:    "q1 n1",
+			err:     "connection refused, 2 scrobbles queued",
+		},
+		{
+			name:    "config errors keep the queue",
+			queued:  []string{"q1", "q2", "q3"},
+			new:     []string{"n1"},
+			errs:    []error{config},
+			batches: []string{"q1 q2"},
+			left:    "q1 q2 q3 n1",
+			err:     "fake: invalid API key, 4 scrobbles queued",
+		},
+		{
+			name:    "permanent errors drop the batch",
+			new:     []string{"n1", "n2", "n3"},
+			errs:    []error{permanent},
+			batches: []string{"n1 n2", "n3"},
+			err:     "fake: invalid, 2 scrobbles dropped",
+		},
+	}
+
+	for _, tt := range tests {
+		func() {
+			_, cleanup := useTempDataDir(t)
+			defer cleanup()
+
+			path, err := dataFilePath(scrobbleQueueFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			queue := map[string][]scrobble{
+				"fake":  testScrobbles(tt.queued...),
+				"other": testScrobbles("o1"),
+			}
+			if err := writeJSONFile(path, queue); err != nil {
+				t.Fatal(err)
+			}
+
+			s := &fakeScrobbler{service: "fake", size: 2, errs: tt.errs}
+			err = submitScrobbles([]scrobbler{s}, testScrobbles(tt.new...))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("%s: unexpected error %s", tt.name, err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+			}
+
+			var batches []string
+			for _, b := range s.batches {
+				batches = append(batches, strings.Join(b, " "))
+			}
+			if strings.Join(batches, ", ") != strings.Join(tt.batches, ", ") {
+				t.Errorf("%s: submitted %q, want %q", tt.name, batches, tt.batches)
+			}
+
+			queue, err = readScrobbleQueue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := scrobbleTracks(queue["fake"]); got != tt.left {
+				t.Errorf("%s: queued %q, want %q", tt.name, got, tt.left)
+			}
+			// the queues of services that aren't set up are kept
+			if got := scrobbleTracks(queue["other"]); got != "o1" {
+				t.Errorf("%s: queued %q for other, want o1", tt.name, got)
+			}
+		}()
+	}
+}
+
+func TestSubmitScrobblesToEachService(t *testing.T) {
+	_, cleanup := useTempDataDir(t)
+	defer cleanup()
+
+	down := &fakeScrobbler{service: "down", size: 10, errs: []error{errors.New("timeout")}}
+	up := &fakeScrobbler{service: "up", size: 10}
+
+	if err := submitScrobbles([]scrobbler{down, up}, testScrobbles("n1")); err == nil {
+		t.Errorf("submitScrobbles succeeded although a service is down")
+	}
+	if len(up.batches) != 1 {
+		t.Errorf("submitted %d batches to the service that's up, want 1", len(up.batches))
+	}
+
+	queue, err := readScrobbleQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scrobbleTracks(queue["down"]); got != "n1" {
+		t.Errorf("queued %q for down, want n1", got)
+	}
+	if got := scrobbleTracks(queue["up"]); got != "" {
+		t.Errorf("queued %q for up, want none", got)
+	}
+}
+
+func TestScrobbleWorthy(t *testing.T) {
+	tests := []struct {
+		duration, listened int
+		artists            []string
+		want               bool
+	}{
+		{duration: 200000, listened: 100000, artists: []string{"a"}, want: true},
+		{duration: 200000, listened: 99999, artists: []string{"a"}, want: false},
+		{duration: 600000, listened: 240000, artists: []string{"a"}, want: true},
+		{duration: 600000, listened: 239999, artists: []string{"a"}, want: false},
+		{duration: 30000, listened: 30000, artists: []string{"a"}, want: false},
+		{duration: 30001, listened: 30001, artists: []string{"a"}, want: true},
+		{duration: 200000, listened: 200000, want: false},
+	}
+
+	for _, tt := range tests {
+		r := listenRecord{Duration: tt.duration, Listened: tt.listened, Artists: tt.artists}
+		if got := scrobbleWorthy(r); got != tt.want {
+			t.Errorf("scrobbleWorthy(%d of %d, %v) = %t, want %t", tt.listened, tt.duration, tt.artists, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+const searchPageLimit = 50
+
+var (
+	searchCmdFlagType   string
+	searchCmdFlagLimit  int
+	searchCmdFlagOffset int
+	searchCmdFlagMarket string
+	searchCmdFlagArtist string
+	searchCmdFlagAlbum  string
+	searchCmdFlagYear   string
+	searchCmdFlagGenre  string
+	searchCmdFlagNew    bool
+	searchCmdFlagOutput string
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Search for tracks, albums, artists or playlists",
+	Long:  `Search for tracks, albums, artists or playlists. The query can be narrowed down with Spotify field filters such as artist:, album:, year:, genre: and tag:new, or with the equivalent flags, which can also be used without a query. The results include URIs that can be passed to play.`,
+	RunE:  search,
+}
+
+// searchTypes maps the names of the search types to their spotify.SearchType,
+// in the order results are listed.
+var searchTypes = []struct {
+	name string
+	st   spotify.SearchType
+	// only returns a result holding only the page of this type
+	only func(*spotify.SearchResult) *spotify.SearchResult
+	next func(*spotify.Client, *spotify.SearchResult) error
+}{
+	{
+		"track",
+		spotify.SearchTypeTrack,
+		func(r *spotify.SearchResult) *spotify.SearchResult { return &spotify.SearchResult{Tracks: r.Tracks} },
+		(*spotify.Client).NextTrackResults,
+	},
+	{
+		"album",
+		spotify.SearchTypeAlbum,
+		func(r *spotify.SearchResult) *spotify.SearchResult { return &spotify.SearchResult{Albums: r.Albums} },
+		(*spotify.Client).NextAlbumResults,
+	},
+	{
+		"artist",
+		spotify.SearchTypeArtist,
+		func(r *spotify.SearchResult) *spotify.SearchResult { return &spotify.SearchResult{Artists: r.Artists} },
+		(*spotify.Client).NextArtistResults,
+	},
+	{
+		"playlist",
+		spotify.SearchTypePlaylist,
+		func(r *spotify.SearchResult) *spotify.SearchResult {
+			return &spotify.SearchResult{Playlists: r.Playlists}
+		},
+		(*spotify.Client).NextPlaylistResults,
+	},
+}
+
+// searchItem is a search result of any type.
+type searchItem struct {
+	Type       string      `json:"type"`
+	Name       string      `json:"name"`
+	Artists    []string    `json:"artists,omitempty"`
+	Album      string      `json:"album,omitempty"`
+	Year       string      `json:"year,omitempty"`
+	Duration   int         `json:"duration_ms,omitempty"`
+	Popularity int         `json:"popularity,omitempty"`
+	URI        spotify.URI `json:"uri"`
+
+	albumID spotify.ID
+}
+
+func (i searchItem) columns() []string {
+	duration := ""
+	if i.Duration > 0 {
+		duration = durationToStr(i.Duration)
+	}
+
+	return []string{i.Type, i.Name, strings.Join(i.Artists, ", "), i.Album, i.Year, duration}
+}
+
+var searchItemHeader = []string{"TYPE", "NAME", "ARTIST", "ALBUM", "YEAR", "DURATION"}
+
+// parseSearchTypes parses a comma-separated list of search types such as
+// "track,album".
+func parseSearchTypes(s string) (spotify.SearchType, error) {
+	var st spotify.SearchType
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+
+		found := false
+		for _, t := range searchTypes {
+			if t.name == name {
+				st |= t.st
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unsupported search type %s", name)
+		}
+	}
+
+	return st, nil
+}
+
+func search(cmd *cobra.Command, args []string) error {
+	st, err := parseSearchTypes(searchCmdFlagType)
+	if err != nil {
+		return err
+	}
+
+	query := buildSearchQuery(strings.Join(args, " "), searchFilters{
+		artist: searchCmdFlagArtist,
+		album:  searchCmdFlagAlbum,
+		year:   searchCmdFlagYear,
+		genre:  searchCmdFlagGenre,
+		isNew:  searchCmdFlagNew,
+	})
+	if query == "" {
+		return errors.New("specify a query or at least one of --artist, --album, --year, --genre or --new")
+	}
+
+	items, err := searchItems(query, st, searchCmdFlagLimit, searchCmdFlagOffset, searchCmdFlagMarket)
+	if err != nil {
+		return err
+	}
+
+	switch searchCmdFlagOutput {
+	case outputTable:
+		rows := make([][]string, len(items))
+		for i, item := range items {
+			rows[i] = append(item.columns(), string(item.URI))
+		}
+		return printTable(append(searchItemHeader, "URI"), rows)
+	case outputJSON:
+		return printJSON(items)
+	case outputURI:
+		for _, item := range items {
+			fmt.Println(item.URI)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %s", searchCmdFlagOutput)
+	}
+}
+
+// searchFilters are Spotify search field filters.
+type searchFilters struct {
+	artist string
+	album  string
+	year   string
+	genre  string
+	isNew  bool
+}
+
+// buildSearchQuery appends the field filters to query, e.g. artist:"Miles
+// Davis" year:1955-1960.
+func buildSearchQuery(query string, f searchFilters) string {
+	terms := []string{}
+	if query = strings.TrimSpace(query); query != "" {
+		terms = append(terms, query)
+	}
+
+	for _, filter := range []struct{ field, value string }{
+		{"artist", f.artist},
+		{"album", f.album},
+		{"year", f.year},
+		{"genre", f.genre},
+	} {
+		if filter.value == "" {
+			continue
+		}
+
+		value := filter.value
+		if strings.ContainsAny(value, " \t") {
+			value = `"` + strings.Replace(value, `"`, "", -1) + `"`
+		}
+		terms = append(terms, filter.field+":"+value)
+	}
+
+	if f.isNew {
+		terms = append(terms, "tag:new")
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// searchItems searches for up to limit items of each of the types starting at
+// offset, following the result pages of each type as needed. If market isn't
+// empty, only items playable in that market are returned.
+func searchItems(query string, st spotify.SearchType, limit, offset int, market string) ([]searchItem, error) {
+	pageLimit := limit
+	if pageLimit > searchPageLimit {
+		pageLimit = searchPageLimit
+	}
+
+	opt := &spotify.Options{Limit: &pageLimit, Offset: &offset}
+	if market != "" {
+		opt.Country = &market
+	}
+
+	result, err := client.SearchOpt(query, st, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []searchItem
+	for _, t := range searchTypes {
+		if st&t.st == 0 {
+			continue
+		}
+
+		page := t.only(result)
+		typeItems := searchResultItems(page)
+		for len(typeItems) < limit {
+			if err := t.next(&client, page); err != nil {
+				if err == spotify.ErrNoMorePages {
+					break
+				}
+				return nil, err
+			}
+
+			more := searchResultItems(page)
+			if len(more) == 0 {
+				break
+			}
+			typeItems = append(typeItems, more...)
+		}
+
+		if len(typeItems) > limit {
+			typeItems = typeItems[:limit]
+		}
+		items = append(items, typeItems...)
+	}
+
+	if err := fillAlbumDetails(items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// searchResultItems flattens a search result into searchItems.
+func searchResultItems(result *spotify.SearchResult) []searchItem {
+	var items []searchItem
+
+	if result.Tracks != nil {
+		for _, t := range result.Tracks.Tracks {
+			items = append(items, searchItem{
+				Type:       "track",
+				Name:       t.Name,
+				Artists:    artistNames(t.Artists),
+				Album:      t.Album.Name,
+				Duration:   t.Duration,
+				Popularity: t.Popularity,
+				URI:        t.URI,
+				albumID:    t.Album.ID,
+			})
+		}
+	}
+
+	if result.Albums != nil {
+		for _, a := range result.Albums.Albums {
+			items = append(items, searchItem{
+				Type:    "album",
+				Name:    a.Name,
+				Artists: artistNames(a.Artists),
+				URI:     a.URI,
+				albumID: a.ID,
+			})
+		}
+	}
+
+	if result.Artists != nil {
+		for _, a := range result.Artists.Artists {
+			items = append(items, searchItem{
+				Type:       "artist",
+				Name:       a.Name,
+				Popularity: a.Popularity,
+				URI:        a.URI,
+			})
+		}
+	}
+
+	if result.Playlists != nil {
+		for _, p := range result.Playlists.Playlists {
+			items = append(items, searchItem{
+				Type:    "playlist",
+				Name:    p.Name,
+				Artists: []string{ownerName(p.Owner)},
+				URI:     p.URI,
+			})
+		}
+	}
+
+	return items
+}
+
+// fillAlbumDetails fills in the release year of tracks and albums, and the
+// duration and popularity of albums, which aren't part of search results.
+func fillAlbumDetails(items []searchItem) error {
+	var ids []spotify.ID
+	seen := make(map[spotify.ID]bool)
+	for _, item := range items {
+		if item.albumID != "" && !seen[item.albumID] {
+			seen[item.albumID] = true
+			ids = append(ids, item.albumID)
+		}
+	}
+
+	albums, err := fullAlbums(ids)
+	if err != nil {
+		return err
+	}
+
+	for i, item := range items {
+		a, ok := albums[item.albumID]
+		if !ok {
+			continue
+		}
+
+		if len(a.ReleaseDate) >= 4 {
+			items[i].Year = a.ReleaseDate[:4]
+		}
+
+		if item.Type == "album" {
+			items[i].Popularity = a.Popularity
+			for _, t := range a.Tracks.Tracks {
+				items[i].Duration += t.Duration
+			}
+		}
+	}
+
+	return nil
+}
+
+// fullAlbums gets the albums with the given IDs, 20 at a time.
+func fullAlbums(ids []spotify.ID) (map[spotify.ID]*spotify.FullAlbum, error) {
+	albums := make(map[spotify.ID]*spotify.FullAlbum)
+
+	err := inBatches(len(ids), 20, func(start, end int) error {
+		batch, err := client.GetAlbums(ids[start:end]...)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range batch {
+			if a != nil {
+				albums[a.ID] = a
+			}
+		}
+		return nil
+	})
+
+	return albums, err
+}
+
+func artistNames(artists []spotify.SimpleArtist) []string {
+	names := make([]string, len(artists))
+	for i, a := range artists {
+		names[i] = a.Name
+	}
+
+	return names
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+const sleepStateFile = "sleep.json"
+
+var (
+	sleepCmdFlagEndOfTrack bool
+	sleepCmdFlagEndOfAlbum bool
+	sleepCmdFlagFade       time.Duration
+	sleepCmdFlagDetach     bool
+	sleepCmdFlagDeadline   string
+)
+
+var errSleepCanceled = errors.New("sleep timer canceled")
+
+var sleepCmd = &cobra.Command{
+	Use:   "sleep [duration]",
+	Short: "Fade out and pause playback after a duration",
+	Long:  `Fade out and pause playback after a duration such as 30m or 1h15m, or at the end of the current track or album with --end-of-track or --end-of-album. The volume is restored after pausing. Use --detach to run the timer in the background.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  sleep,
+}
+
+var sleepStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the running sleep timer",
+	RunE:  sleepStatus,
+}
+
+var sleepCancelCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel the running sleep timer",
+	RunE:  sleepCancel,
+}
+
+// sleepState is persisted while a sleep timer is running so that it can be
+// inspected and canceled from another terminal.
+type sleepState struct {
+	PID      int           `json:"pid"`
+	Deadline time.Time     `json:"deadline"`
+	Fade     time.Duration `json:"fade"`
+	Device   string        `json:"device,omitempty"`
+}
+
+// sleepTimer fades out the volume over the last fade duration before the
+// deadline, pauses playback and then restores the original volume.
+type sleepTimer struct {
+	clock    clock
+	player   playbackController
+	deviceID *spotify.ID
+	deadline time.Time
+	fade     time.Duration
+	step     time.Duration
+}
+
+func (t *sleepTimer) run(cancel <-chan struct{}) error {
+	if !sleepUntil(t.clock, t.deadline.Add(-t.fade), cancel) {
+		return errSleepCanceled
+	}
+
+	state, err := t.player.PlayerState()
+	if err != nil {
+		return err
+	}
+	if !state.Playing {
+		return nil
+	}
+
+	opt := &spotify.PlayOptions{DeviceID: t.deviceID}
+	origVolume := state.Device.Volume
+
+	for {
+		now := t.clock.Now()
+		if !now.Before(t.deadline) {
+			break
+		}
+
+		if err := t.player.VolumeOpt(fadeVolume(origVolume, t.deadline.Sub(now), t.fade), opt); err != nil {
+			return err
+		}
+
+		next := now.Add(t.step)
+		if next.After(t.deadline) {
+			next = t.deadline
+		}
+		if !sleepUntil(t.clock, next, cancel) {
+			if err := t.player.VolumeOpt(origVolume, opt); err != nil {
+				return err
+			}
+			return errSleepCanceled
+		}
+	}
+
+	if err := t.player.PauseOpt(opt); err != nil {
+		return err
+	}
+
+	return t.player.VolumeOpt(origVolume, opt)
+}
+
+// fadeVolume returns the volume to use when remaining time is left of a
+// linear fade out from volume.
+func fadeVolume(volume int, remaining, fade time.Duration) int {
+	if fade <= 0 || remaining <= 0 {
+		return 0
+	}
+	if remaining >= fade {
+		return volume
+	}
+
+	return int(float64(volume) * float64(remaining) / float64(fade))
+}
+
+func sleep(cmd *cobra.Command, args []string) error {
+	deadline, err := sleepDeadline(args)
+	if err != nil {
+		return err
+	}
+
+	path, err := dataFilePath(sleepStateFile)
+	if err != nil {
+		return err
+	}
+
+	var existing sleepState
+	if err := readJSONFile(path, &existing); err == nil && existing.PID != os.Getpid() && processAlive(existing.PID) {
+		return fmt.Errorf("a sleep timer is already running (pid %d), cancel it with `spotctl sleep cancel`", existing.PID)
+	}
+
+	if sleepCmdFlagDetach {
+		return detachSleep(deadline)
+	}
+
+	state := sleepState{
+		PID:      os.Getpid(),
+		Deadline: deadline,
+		Fade:     sleepCmdFlagFade,
+		Device:   deviceNameFlag,
+	}
+	if err := writeJSONFile(path, state); err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	cancel := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		<-sig
+		close(cancel)
+	}()
+
+	fmt.Printf("Pausing playback at %s.\n", deadline.Format("15:04:05"))
+
+	timer := &sleepTimer{
+		clock:    realClock{},
+		player:   &client,
+		deviceID: findDeviceByName(deviceNameFlag),
+		deadline: deadline,
+		fade:     sleepCmdFlagFade,
+		step:     time.Second,
+	}
+	if err := timer.run(cancel); err != nil {
+		if err == errSleepCanceled {
+			fmt.Println("Sleep timer canceled.")
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// sleepDeadline returns the time at which playback should be paused.
+func sleepDeadline(args []string) (time.Time, error) {
+	if sleepCmdFlagDeadline != "" {
+		return time.Parse(time.RFC3339, sleepCmdFlagDeadline)
+	}
+
+	modes := 0
+	for _, set := range []bool{len(args) > 0, sleepCmdFlagEndOfTrack, sleepCmdFlagEndOfAlbum} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		return time.Time{}, errors.New("specify exactly one of a duration, --end-of-track or --end-of-album")
+	}
+
+	if len(args) > 0 {
+		d, err := time.ParseDuration(args[0])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Now().Add(d), nil
+	}
+
+	state, err := client.PlayerState()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if state.Item == nil {
+		return time.Time{}, errors.New("nothing is currently playing")
+	}
+
+	remaining := state.Item.Duration - state.Progress
+	if sleepCmdFlagEndOfAlbum {
+		if state.ShuffleState {
+			fmt.Println("Shuffle is on, so the end of the album is an estimate.")
+		}
+
+		rest, err := remainingAlbumDuration(state.Item)
+		if err != nil {
+			return time.Time{}, err
+		}
+		remaining += rest
+	}
+
+	return time.Now().Add(time.Duration(remaining) * time.Millisecond), nil
+}
+
+// remainingAlbumDuration returns the total duration in milliseconds of the
+// tracks that follow track on its album.
+func remainingAlbumDuration(track *spotify.FullTrack) (int, error) {
+	var (
+		total int
+		after bool
+	)
+
+	for offset := 0; ; {
+		page, err := client.GetAlbumTracksOpt(track.Album.ID, 50, offset)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, t := range page.Tracks {
+			if after {
+				total += t.Duration
+			} else if t.ID == track.ID {
+				after = true
+			}
+		}
+
+		offset += len(page.Tracks)
+		if page.Next == "" || len(page.Tracks) == 0 {
+			break
+		}
+	}
+
+	return total, nil
+}
+
+// detachSleep restarts the sleep command in a background process.
+func detachSleep(deadline time.Time) error {
+	args := []string{
+		"sleep",
+		"--deadline", deadline.Format(time.RFC3339),
+		"--fade", sleepCmdFlagFade.String(),
+	}
+	if deviceNameFlag != "" {
+		args = append(args, "--device", deviceNameFlag)
+	}
+
+	pid, err := startDetached(args...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pausing playback at %s in the background (pid %d).\n", deadline.Format("15:04:05"), pid)
+
+	return nil
+}
+
+func sleepStatus(cmd *cobra.Command, args []string) error {
+	state, err := runningSleepState()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		fmt.Println("No sleep timer is running.")
+		return nil
+	}
+
+	remaining := time.Until(state.Deadline).Round(time.Second)
+	fmt.Printf("Sleep timer (pid %d) pauses playback at %s, in %s, fading out over %s.\n", state.PID, state.Deadline.Format("15:04:05"), remaining, state.Fade)
+
+	return nil
+}
+
+func sleepCancel(cmd *cobra.Command, args []string) error {
+	state, err := runningSleepState()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		fmt.Println("No sleep timer is running.")
+		return nil
+	}
+
+	if err := interruptProcess(state.PID); err != nil {
+		return err
+	}
+
+	fmt.Println("Sleep timer canceled.")
+
+	return nil
+}
+
+// runningSleepState returns the state of the running sleep timer or nil if
+// there is none. Stale state left by a killed process is removed.
+func runningSleepState() (*sleepState, error) {
+	path, err := dataFilePath(sleepStateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var state sleepState
+	if err := readJSONFile(path, &state); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !processAlive(state.PID) {
+		os.Remove(path)
+		return nil, nil
+	}
+
+	return &state, nil
+}
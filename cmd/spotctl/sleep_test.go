@@ -0,0 +1,170 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+// fakePlayer records the calls made to control playback.
+type fakePlayer struct {
+	clock   *fakeClock
+	state   spotify.PlayerState
+	calls   []string
+	volumes []int
+	// times are the times of the calls, relative to start
+	start time.Time
+	times []time.Duration
+}
+
+func (p *fakePlayer) record(call string) {
+	p.calls = append(p.calls, call)
+	p.times = append(p.times, p.clock.Now().Sub(p.start))
+}
+
+func (p *fakePlayer) PlayerState() (*spotify.PlayerState, error) {
+	p.record("state")
+	state := p.state
+	return &state, nil
+}
+
+func (p *fakePlayer) PlayOpt(opt *spotify.PlayOptions) error {
+	p.record("play")
+	p.state.Playing = true
+	return nil
+}
+
+func (p *fakePlayer) PauseOpt(opt *spotify.PlayOptions) error {
+	p.record("pause")
+	p.state.Playing = false
+	return nil
+}
+
+func (p *fakePlayer) VolumeOpt(percent int, opt *spotify.PlayOptions) error {
+	p.record("volume")
+	p.volumes = append(p.volumes, percent)
+	p.state.Device.Volume = percent
+	return nil
+}
+
+func newSleepTest(playing bool, volume int) (*sleepTimer, *fakeClock, *fakePlayer) {
+	start := time.Date(2024, time.March, 1, 23, 0, 0, 0, time.UTC)
+	c := &fakeClock{now: start}
+	p := &fakePlayer{clock: c, start: start}
+	p.state.Playing = playing
+	p.state.Device.Volume = volume
+
+	t := &sleepTimer{
+		clock:    c,
+		player:   p,
+		deadline: start.Add(10 * time.Minute),
+		fade:     4 * time.Second,
+		step:     time.Second,
+	}
+
+	return t, c, p
+}
+
+func TestSleepTimerFadesAndPauses(t *testing.T) {
+	timer, _, p := newSleepTest(true, 80)
+
+	if err := timer.run(make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCalls := []string{"state", "volume", "volume", "volume", "volume", "pause", "volume"}
+	if !reflect.DeepEqual(p.calls, wantCalls) {
+		t.Fatalf("calls = %v, want %v", p.calls, wantCalls)
+	}
+
+	wantVolumes := []int{80, 60, 40, 20, 80}
+	if !reflect.DeepEqual(p.volumes, wantVolumes) {
+		t.Errorf("volumes = %v, want %v", p.volumes, wantVolumes)
+	}
+
+	// the fade starts 4s before the deadline and playback is paused at it
+	if got, want := p.times[1], 9*time.Minute+56*time.Second; got != want {
+		t.Errorf("fade started at %s, want %s", got, want)
+	}
+	if got, want := p.times[5], 10*time.Minute; got != want {
+		t.Errorf("paused at %s, want %s", got, want)
+	}
+	if p.state.Playing {
+		t.Error("playback wasn't paused")
+	}
+	if p.state.Device.Volume != 80 {
+		t.Errorf("volume = %d after pausing, want it restored to 80", p.state.Device.Volume)
+	}
+}
+
+func TestSleepTimerNotPlaying(t *testing.T) {
+	timer, _, p := newSleepTest(false, 80)
+
+	if err := timer.run(make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"state"}; !reflect.DeepEqual(p.calls, want) {
+		t.Errorf("calls = %v, want %v", p.calls, want)
+	}
+}
+
+func TestSleepTimerCanceledBeforeFade(t *testing.T) {
+	timer, c, p := newSleepTest(true, 80)
+	cancel := make(chan struct{})
+	c.cancel = cancel
+	c.stopAt = c.now.Add(time.Minute)
+
+	if err := timer.run(cancel); err != errSleepCanceled {
+		t.Fatalf("err = %v, want %v", err, errSleepCanceled)
+	}
+
+	if len(p.calls) != 0 {
+		t.Errorf("calls = %v, want none", p.calls)
+	}
+}
+
+func TestSleepTimerCanceledMidFade(t *testing.T) {
+	timer, c, p := newSleepTest(true, 80)
+	cancel := make(chan struct{})
+	c.cancel = cancel
+	c.stopAt = timer.deadline.Add(-2500 * time.Millisecond)
+
+	if err := timer.run(cancel); err != errSleepCanceled {
+		t.Fatalf("err = %v, want %v", err, errSleepCanceled)
+	}
+
+	wantVolumes := []int{80, 60, 80}
+	if !reflect.DeepEqual(p.volumes, wantVolumes) {
+		t.Errorf("volumes = %v, want %v", p.volumes, wantVolumes)
+	}
+	if !p.state.Playing {
+		t.Error("playback was paused")
+	}
+}
+
+func TestFadeVolume(t *testing.T) {
+	tests := []struct {
+		volume    int
+		remaining time.Duration
+		fade      time.Duration
+		want      int
+	}{
+		{80, 10 * time.Second, 4 * time.Second, 80},
+		{80, 4 * time.Second, 4 * time.Second, 80},
+		{80, 3 * time.Second, 4 * time.Second, 60},
+		{80, time.Second, 4 * time.Second, 20},
+		{80, 0, 4 * time.Second, 0},
+		{80, -time.Second, 4 * time.Second, 0},
+		{80, time.Second, 0, 0},
+		{0, 2 * time.Second, 4 * time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		if got := fadeVolume(tt.volume, tt.remaining, tt.fade); got != tt.want {
+			t.Errorf("fadeVolume(%d, %s, %s) = %d, want %d", tt.volume, tt.remaining, tt.fade, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+var (
+	smartSyncCmdFlagAll    bool
+	smartSyncCmdFlagDryRun bool
+)
+
+var smartCmd = &cobra.Command{
+	Use:   "smart",
+	Short: "Manage smart playlists",
+	Long: `Smart playlists are playlists of the saved tracks that match a query. They're defined in ~/.spotctl.d/config.json, for example:
+
+  {
+    "smart_playlists": {
+      "fresh energy": {
+        "query": "added_at > 30d and energy > 0.7 and not artist = \"Nickelback\" order by added_at desc limit 100",
+        "playlist": "Fresh Energy"
+      }
+    }
+  }
+
+The tracks are written to the playlist given by "playlist", or named like the smart playlist if it's not set.
+
+A query is a condition, optionally followed by "order by" and a comma-separated list of fields, each optionally followed by asc or desc, and by "limit" and the maximum number of tracks. Conditions compare fields with values and are combined with and, or, not and parentheses. Values with spaces are quoted.
+
+Fields:
+  name, artist, album, genre, key      text, compared with = and != ignoring case, or ~ and !~ for containing a value
+  added_at, release_date               a date such as 2018-01-31, or a time ago such as 30d, 12w, 6m or 1y
+  year, popularity, tempo, energy,     a number
+  danceability, valence, acousticness,
+  instrumentalness, liveness,
+  speechiness, loudness
+  duration                             a duration such as 3:30 or 3m30s
+  explicit                             true or false, "explicit" alone means "explicit = true"
+
+Tracks with several artists or genres match a text condition if any of them does. Tracks without a value, such as tracks without audio features, don't match any condition of it. The keys are in Camelot notation such as 8A.`,
+}
+
+var smartLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the smart playlists",
+	Args:  cobra.NoArgs,
+	RunE:  smartLs,
+}
+
+var smartSyncCmd = &cobra.Command{
+	Use:         "sync [name]...",
+	Short:       "Update smart playlists",
+	Long:        `Update the playlists of smart playlists with the saved tracks that match their queries. Playlists are created if they don't exist yet, and left alone if they already have the matching tracks in order. Otherwise their tracks are replaced, after saving them as a snapshot.`,
+	RunE:        smartSync,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserLibraryRead + " " + playlistModifyScopes},
+}
+
+// smartPlaylistConfig is a smart playlist in the config file.
+type smartPlaylistConfig struct {
+	Query string `json:"query"`
+	// Playlist is the name of the playlist to write to, which defaults to
+	// the name of the smart playlist.
+	Playlist string `json:"playlist,omitempty"`
+}
+
+func (c smartPlaylistConfig) playlistName(name string) string {
+	if c.Playlist != "" {
+		return c.Playlist
+	}
+
+	return name
+}
+
+func smartLs(cmd *cobra.Command, args []string) error {
+	c, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for _, name := range smartPlaylistNames(c) {
+		sp := c.SmartPlaylists[name]
+		rows = append(rows, []string{name, sp.playlistName(name), sp.Query})
+	}
+
+	return printTable([]string{"NAME", "PLAYLIST", "QUERY"}, rows)
+}
+
+func smartPlaylistNames(c config) []string {
+	var names []string
+	for name := range c.SmartPlaylists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func smartSync(cmd *cobra.Command, args []string) error {
+	c, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	names := args
+	if smartSyncCmdFlagAll {
+		names = smartPlaylistNames(c)
+	} else if len(names) == 0 {
+		return errors.New("specify the smart playlists to sync, or --all")
+	}
+
+	// parse all the queries before changing any playlist
+	var (
+		queries = make([]*smartQuery, len(names))
+		needs   smartNeeds
+		now     = time.Now()
+	)
+	for i, name := range names {
+		sp, ok := c.SmartPlaylists[name]
+		if !ok {
+			return fmt.Errorf("no smart playlist named %q in %s", name, configFile)
+		}
+
+		q, err := parseSmartQuery(sp.Query, now)
+		if err != nil {
+			return fmt.Errorf("invalid query of %q: %s", name, err)
+		}
+		queries[i] = q
+		needs |= q.needs
+	}
+
+	tracks, err := savedSmartTracks(needs)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		matched := queries[i].apply(tracks)
+		if err := syncSmartPlaylist(c.SmartPlaylists[name].playlistName(name), matched); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncSmartPlaylist writes tracks to the named playlist unless it already
+// has them in order.
+func syncSmartPlaylist(name string, tracks []smartTrack) error {
+	var ids []spotify.ID
+	for _, t := range tracks {
+		if id := trackID(t.item.URI); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	if smartSyncCmdFlagDryRun {
+		rows := make([][]string, len(tracks))
+		for i, t := range tracks {
+			rows[i] = []string{strconv.Itoa(i + 1), trackLabel(t.item), t.addedAt.Local().Format("2006-01-02")}
+		}
+		if err := printTable([]string{"#", "TRACK", "ADDED"}, rows); err != nil {
+			return err
+		}
+	}
+
+	return refreshPlaylist(name, ids, smartSyncCmdFlagDryRun)
+}
+
+// savedSmartTracks gets the saved tracks and looks up the details needs
+// asks for.
+func savedSmartTracks(needs smartNeeds) ([]smartTrack, error) {
+	var tracks []smartTrack
+
+	err := allPages(func(opt *spotify.Options) (bool, error) {
+		page, err := client.CurrentUsersTracksOpt(opt)
+		if err != nil {
+			return false, err
+		}
+
+		for _, t := range page.Tracks {
+			st := smartTrack{item: trackItem(t.FullTrack, t.AddedAt), explicit: t.Explicit}
+			st.addedAt, _ = time.Parse(time.RFC3339, t.AddedAt)
+			for _, a := range t.Artists {
+				st.artistIDs = append(st.artistIDs, a.ID)
+			}
+			tracks = append(tracks, st)
+		}
+
+		return page.Next != "", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids, albumIDs, artistIDs []spotify.ID
+	for _, t := range tracks {
+		if id := trackID(t.item.URI); id != "" {
+			ids = append(ids, id)
+		}
+		if t.item.albumID != "" {
+			albumIDs = append(albumIDs, t.item.albumID)
+		}
+		artistIDs = append(artistIDs, t.artistIDs...)
+	}
+
+	if needs&smartNeedsFeatures != 0 {
+		features, err := audioFeatures(ids)
+		if err != nil {
+			return nil, err
+		}
+		for i := range tracks {
+			tracks[i].features = features[trackID(tracks[i].item.URI)]
+		}
+	}
+
+	if needs&smartNeedsAlbums != 0 {
+		albums, err := fullAlbums(uniqueIDs(albumIDs))
+		if err != nil {
+			return nil, err
+		}
+		for i := range tracks {
+			if a := albums[tracks[i].item.albumID]; a != nil {
+				tracks[i].releaseDate = a.ReleaseDate
+			}
+		}
+	}
+
+	if needs&smartNeedsGenres != 0 {
+		genres, err := artistGenres(uniqueIDs(artistIDs))
+		if err != nil {
+			return nil, err
+		}
+		for i := range tracks {
+			for _, id := range tracks[i].artistIDs {
+				tracks[i].genres = append(tracks[i].genres, genres[id]...)
+			}
+		}
+	}
+
+	return tracks, nil
+}
+
+// artistGenres gets the genres of artists.
+func artistGenres(ids []spotify.ID) (map[spotify.ID][]string, error) {
+	genres := make(map[spotify.ID][]string)
+
+	err := inBatches(len(ids), libraryBatchSize, func(start, end int) error {
+		batch, err := client.GetArtists(ids[start:end]...)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range batch {
+			if a != nil {
+				genres[a.ID] = a.Genres
+			}
+		}
+		return nil
+	})
+
+	return genres, err
+}
@@ -0,0 +1,769 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/zmb3/spotify"
+)
+
+// smartTrack is a saved track with the details smart playlist rules can
+// match.
+type smartTrack struct {
+	item        libraryItem
+	addedAt     time.Time
+	explicit    bool
+	artistIDs   []spotify.ID
+	features    *spotify.AudioFeatures
+	genres      []string
+	releaseDate string
+}
+
+// smartType is the type of a smart playlist field.
+type smartType int
+
+const (
+	smartText smartType = iota
+	smartNumber
+	smartDuration
+	smartTime
+	smartBool
+)
+
+func (t smartType) String() string {
+	switch t {
+	case smartText:
+		return "text"
+	case smartNumber:
+		return "a number"
+	case smartDuration:
+		return "a duration"
+	case smartTime:
+		return "a date"
+	default:
+		return "true or false"
+	}
+}
+
+// smartNeeds are the details of saved tracks that have to be looked up for
+// a query.
+type smartNeeds int
+
+const (
+	smartNeedsFeatures smartNeeds = 1 << iota
+	smartNeedsGenres
+	smartNeedsAlbums
+)
+
+// smartValue is the value of a field. Text fields may have several values,
+// such as the artists of a track, and match if any of them does. ok is
+// false if the track has no value.
+type smartValue struct {
+	strs []string
+	num  float64
+	t    time.Time
+	b    bool
+	ok   bool
+}
+
+// smartField is a field rules can compare and order by.
+type smartField struct {
+	typ   smartType
+	needs smartNeeds
+	value func(t *smartTrack) smartValue
+}
+
+func textValue(s ...string) smartValue {
+	return smartValue{strs: s, ok: len(s) > 0}
+}
+
+func featureField(get func(f *spotify.AudioFeatures) float32) smartField {
+	return smartField{smartNumber, smartNeedsFeatures, func(t *smartTrack) smartValue {
+		if t.features == nil {
+			return smartValue{}
+		}
+		return smartValue{num: float64(get(t.features)), ok: true}
+	}}
+}
+
+var smartFields = map[string]smartField{
+	"name": {smartText, 0, func(t *smartTrack) smartValue {
+		return textValue(t.item.Name)
+	}},
+	"artist": {smartText, 0, func(t *smartTrack) smartValue {
+		return textValue(t.item.Artists...)
+	}},
+	"album": {smartText, 0, func(t *smartTrack) smartValue {
+		return textValue(t.item.Album)
+	}},
+	"genre": {smartText, smartNeedsGenres, func(t *smartTrack) smartValue {
+		return textValue(t.genres...)
+	}},
+	"added_at": {smartTime, 0, func(t *smartTrack) smartValue {
+		return smartValue{t: t.addedAt, ok: !t.addedAt.IsZero()}
+	}},
+	"release_date": {smartTime, smartNeedsAlbums, func(t *smartTrack) smartValue {
+		d, ok := parseReleaseDate(t.releaseDate)
+		return smartValue{t: d, ok: ok}
+	}},
+	"year": {smartNumber, smartNeedsAlbums, func(t *smartTrack) smartValue {
+		d, ok := parseReleaseDate(t.releaseDate)
+		return smartValue{num: float64(d.Year()), ok: ok}
+	}},
+	"popularity": {smartNumber, 0, func(t *smartTrack) smartValue {
+		return smartValue{num: float64(t.item.Popularity), ok: true}
+	}},
+	"duration": {smartDuration, 0, func(t *smartTrack) smartValue {
+		return smartValue{num: float64(t.item.Duration), ok: t.item.Duration > 0}
+	}},
+	"explicit": {smartBool, 0, func(t *smartTrack) smartValue {
+		return smartValue{b: t.explicit, ok: true}
+	}},
+	"key": {smartText, smartNeedsFeatures, func(t *smartTrack) smartValue {
+		if t.features == nil {
+			return smartValue{}
+		}
+		k, ok := newCamelotKey(t.features.Key, t.features.Mode)
+		return smartValue{strs: []string{k.String()}, ok: ok}
+	}},
+	"tempo":            featureField(func(f *spotify.AudioFeatures) float32 { return f.Tempo }),
+	"energy":           featureField(func(f *spotify.AudioFeatures) float32 { return f.Energy }),
+	"danceability":     featureField(func(f *spotify.AudioFeatures) float32 { return f.Danceability }),
+	"valence":          featureField(func(f *spotify.AudioFeatures) float32 { return f.Valence }),
+	"acousticness":     featureField(func(f *spotify.AudioFeatures) float32 { return f.Acousticness }),
+	"instrumentalness": featureField(func(f *spotify.AudioFeatures) float32 { return f.Instrumentalness }),
+	"liveness":         featureField(func(f *spotify.AudioFeatures) float32 { return f.Liveness }),
+	"speechiness":      featureField(func(f *spotify.AudioFeatures) float32 { return f.Speechiness }),
+	"loudness":         featureField(func(f *spotify.AudioFeatures) float32 { return f.Loudness }),
+}
+
+// parseReleaseDate parses a release date, which is a year, a month or a day
+// depending on its precision.
+func parseReleaseDate(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// smartExpr is a condition of a smart playlist query.
+type smartExpr interface {
+	match(t *smartTrack) bool
+}
+
+type smartAnd struct{ left, right smartExpr }
+
+func (e smartAnd) match(t *smartTrack) bool { return e.left.match(t) && e.right.match(t) }
+
+type smartOr struct{ left, right smartExpr }
+
+func (e smartOr) match(t *smartTrack) bool { return e.left.match(t) || e.right.match(t) }
+
+type smartNot struct{ expr smartExpr }
+
+func (e smartNot) match(t *smartTrack) bool { return !e.expr.match(t) }
+
+// smartComparison compares a field with a value of the same type. Tracks
+// without a value for the field never match.
+type smartComparison struct {
+	name  string
+	field smartField
+	op    string
+	value smartValue
+}
+
+func (c smartComparison) match(t *smartTrack) bool {
+	v := c.field.value(t)
+	if !v.ok {
+		return false
+	}
+
+	switch c.field.typ {
+	case smartText:
+		negate := c.op == "!=" || c.op == "!~"
+		want := c.value.strs[0]
+
+		for _, s := range v.strs {
+			s = strings.ToLower(s)
+			if c.op == "~" || c.op == "!~" {
+				if strings.Contains(s, want) {
+					return !negate
+				}
+			} else if s == want {
+				return !negate
+			}
+		}
+		return negate
+	case smartBool:
+		return (v.b == c.value.b) == (c.op == "=")
+	case smartTime:
+		// dates are equal if they're on the same day
+		if c.op == "=" || c.op == "!=" {
+			y1, m1, d1 := v.t.Local().Date()
+			y2, m2, d2 := c.value.t.Local().Date()
+			return (y1 == y2 && m1 == m2 && d1 == d2) == (c.op == "=")
+		}
+	}
+
+	return compareSmartOp(c.op, compareSmartValues(c.field.typ, v, c.value))
+}
+
+// compareSmartValues compares two values of a field of type typ. Text values
+// with several values are compared as a list.
+func compareSmartValues(typ smartType, a, b smartValue) int {
+	switch typ {
+	case smartText:
+		return strings.Compare(strings.ToLower(strings.Join(a.strs, ", ")), strings.ToLower(strings.Join(b.strs, ", ")))
+	case smartTime:
+		switch {
+		case a.t.Before(b.t):
+			return -1
+		case a.t.After(b.t):
+			return 1
+		}
+		return 0
+	case smartBool:
+		switch {
+		case !a.b && b.b:
+			return -1
+		case a.b && !b.b:
+			return 1
+		}
+		return 0
+	}
+
+	switch {
+	case a.num < b.num:
+		return -1
+	case a.num > b.num:
+		return 1
+	}
+	return 0
+}
+
+func compareSmartOp(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// smartOps are the operators each type supports.
+var smartOps = map[smartType][]string{
+	smartText:     {"=", "!=", "~", "!~"},
+	smartNumber:   {"=", "!=", "<", "<=", ">", ">="},
+	smartDuration: {"=", "!=", "<", "<=", ">", ">="},
+	smartTime:     {"=", "!=", "<", "<=", ">", ">="},
+	smartBool:     {"=", "!="},
+}
+
+// smartOrder is a field to order by and its direction.
+type smartOrder struct {
+	name  string
+	field smartField
+	desc  bool
+}
+
+// smartQuery is a parsed smart playlist query.
+type smartQuery struct {
+	// cond is nil if every track matches
+	cond   smartExpr
+	orders []smartOrder
+	// limit is 0 for no limit
+	limit int
+	needs smartNeeds
+}
+
+// apply returns the tracks that match q in the order of q. Tracks that are
+// equal in that order keep their order.
+func (q *smartQuery) apply(tracks []smartTrack) []smartTrack {
+	var matched []smartTrack
+	for i := range tracks {
+		if q.cond == nil || q.cond.match(&tracks[i]) {
+			matched = append(matched, tracks[i])
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		for _, o := range q.orders {
+			a, b := o.field.value(&matched[i]), o.field.value(&matched[j])
+
+			// missing values go last in either direction
+			switch {
+			case !a.ok && !b.ok:
+				continue
+			case !a.ok:
+				return false
+			case !b.ok:
+				return true
+			}
+
+			c := compareSmartValues(o.field.typ, a, b)
+			if o.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	if q.limit > 0 && len(matched) > q.limit {
+		matched = matched[:q.limit]
+	}
+
+	return matched
+}
+
+type smartTokenKind int
+
+const (
+	smartTokenEOF smartTokenKind = iota
+	smartTokenWord
+	smartTokenString
+	smartTokenOp
+	smartTokenLeftParen
+	smartTokenRightParen
+	smartTokenComma
+)
+
+type smartToken struct {
+	kind smartTokenKind
+	text string
+	pos  int
+}
+
+func (t smartToken) String() string {
+	switch t.kind {
+	case smartTokenEOF:
+		return "end of query"
+	case smartTokenString:
+		return strconv.Quote(t.text)
+	}
+
+	return t.text
+}
+
+// smartQueryError is an error at a position of a query.
+type smartQueryError struct {
+	pos int
+	msg string
+}
+
+func (e smartQueryError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.pos+1, e.msg)
+}
+
+func isSmartWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-:", r)
+}
+
+// lexSmartQuery splits a query into words, quoted strings, operators,
+// parentheses and commas.
+func lexSmartQuery(s string) ([]smartToken, error) {
+	var tokens []smartToken
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, smartToken{smartTokenLeftParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, smartToken{smartTokenRightParen, ")", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, smartToken{smartTokenComma, ",", i})
+			i++
+		case strings.ContainsRune("=!<>~", r):
+			start := i
+			i++
+			if i < len(runes) && (runes[i] == '=' || r == '!' && runes[i] == '~') {
+				i++
+			}
+
+			op := string(runes[start:i])
+			if op == "!" {
+				return nil, smartQueryError{start, `expected != or !~`}
+			}
+			if op == "==" {
+				op = "="
+			}
+			tokens = append(tokens, smartToken{smartTokenOp, op, start})
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, smartQueryError{start, "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, smartToken{smartTokenString, b.String(), start})
+		case isSmartWordRune(r):
+			start := i
+			for i < len(runes) && isSmartWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, smartToken{smartTokenWord, string(runes[start:i]), start})
+		default:
+			return nil, smartQueryError{i, fmt.Sprintf("unexpected %q", r)}
+		}
+	}
+
+	return append(tokens, smartToken{kind: smartTokenEOF, pos: len(runes)}), nil
+}
+
+// smartParser parses and type checks queries. The grammar is:
+//
+//	query      = [or] {"order" "by" order {"," order} | "limit" number}
+//	or         = and {"or" and}
+//	and        = not {"and" not}
+//	not        = "not" not | "(" or ")" | comparison
+//	comparison = field op value | field
+//	order      = field ["asc" | "desc"]
+//
+// A field without an operator must be true or false and matches if it's
+// true.
+type smartParser struct {
+	tokens []smartToken
+	pos    int
+	now    time.Time
+	needs  smartNeeds
+}
+
+// parseSmartQuery parses a query such as
+//
+//	added_at > 30d and energy > 0.7 and not artist = "Nickelback"
+//	order by added_at desc limit 100
+//
+// Times ago such as 30d are relative to now.
+func parseSmartQuery(s string, now time.Time) (*smartQuery, error) {
+	tokens, err := lexSmartQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &smartParser{tokens: tokens, now: now}
+	q := &smartQuery{}
+
+	if !p.atClause() {
+		if q.cond, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+	}
+
+	for p.peek().kind != smartTokenEOF {
+		switch tok := p.next(); {
+		case isKeyword(tok, "order") && q.orders == nil:
+			if !p.keyword("by") {
+				return nil, p.errorf(p.peek(), "expected by after order, got %s", p.peek())
+			}
+			for {
+				o, err := p.parseOrder()
+				if err != nil {
+					return nil, err
+				}
+				q.orders = append(q.orders, o)
+
+				if p.peek().kind != smartTokenComma {
+					break
+				}
+				p.next()
+			}
+		case isKeyword(tok, "limit") && q.limit == 0:
+			n := p.next()
+			limit, err := strconv.Atoi(n.text)
+			if n.kind != smartTokenWord || err != nil || limit < 1 {
+				return nil, p.errorf(n, "expected a positive number after limit, got %s", n)
+			}
+			q.limit = limit
+		default:
+			return nil, p.errorf(tok, "unexpected %s", tok)
+		}
+	}
+
+	q.needs = p.needs
+	return q, nil
+}
+
+func (p *smartParser) peek() smartToken {
+	return p.tokens[p.pos]
+}
+
+func (p *smartParser) next() smartToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != smartTokenEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+// keyword skips the next token if it's the keyword k.
+func (p *smartParser) keyword(k string) bool {
+	if !isKeyword(p.peek(), k) {
+		return false
+	}
+
+	p.next()
+	return true
+}
+
+func isKeyword(tok smartToken, k string) bool {
+	return tok.kind == smartTokenWord && strings.EqualFold(tok.text, k)
+}
+
+// atClause reports whether the condition of the query is over.
+func (p *smartParser) atClause() bool {
+	tok := p.peek()
+	return tok.kind == smartTokenEOF || isKeyword(tok, "order") || isKeyword(tok, "limit")
+}
+
+func (p *smartParser) errorf(tok smartToken, format string, args ...interface{}) error {
+	return smartQueryError{tok.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *smartParser) parseOr() (smartExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = smartOr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *smartParser) parseAnd() (smartExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = smartAnd{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *smartParser) parseNot() (smartExpr, error) {
+	if p.keyword("not") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return smartNot{expr}, nil
+	}
+
+	if p.peek().kind == smartTokenLeftParen {
+		p.next()
+
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != smartTokenRightParen {
+			return nil, p.errorf(tok, "expected ), got %s", tok)
+		}
+		return expr, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *smartParser) parseField() (string, smartField, error) {
+	tok := p.next()
+	if tok.kind != smartTokenWord {
+		return "", smartField{}, p.errorf(tok, "expected a field, got %s", tok)
+	}
+
+	name := strings.ToLower(tok.text)
+	field, ok := smartFields[name]
+	if !ok {
+		return "", smartField{}, p.errorf(tok, "unknown field %s", tok)
+	}
+	p.needs |= field.needs
+
+	return name, field, nil
+}
+
+func (p *smartParser) parseComparison() (smartExpr, error) {
+	name, field, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+
+	opTok := p.peek()
+	if opTok.kind != smartTokenOp {
+		if field.typ == smartBool {
+			return smartComparison{name, field, "=", smartValue{b: true, ok: true}}, nil
+		}
+		return nil, p.errorf(opTok, "expected an operator after %s, got %s", name, opTok)
+	}
+	p.next()
+
+	if !containsString(smartOps[field.typ], opTok.text) {
+		return nil, p.errorf(opTok, "%s is %s and can't be compared with %s", name, field.typ, opTok.text)
+	}
+
+	tok := p.next()
+	if tok.kind != smartTokenWord && tok.kind != smartTokenString {
+		return nil, p.errorf(tok, "expected a value after %s %s, got %s", name, opTok.text, tok)
+	}
+
+	value, err := p.literal(field.typ, tok.text)
+	if err != nil {
+		return nil, p.errorf(tok, "%s is %s: %s", name, field.typ, err)
+	}
+
+	return smartComparison{name, field, opTok.text, value}, nil
+}
+
+func (p *smartParser) parseOrder() (smartOrder, error) {
+	name, field, err := p.parseField()
+	if err != nil {
+		return smartOrder{}, err
+	}
+
+	o := smartOrder{name: name, field: field}
+	if p.keyword("desc") {
+		o.desc = true
+	} else {
+		p.keyword("asc")
+	}
+
+	return o, nil
+}
+
+var smartAgeRe = regexp.MustCompile(`^(\d+)([dwmy])$`)
+
+// timeAgo parses a time ago such as 30d, 12w, 6m or 1y, counting back from
+// now.
+func timeAgo(s string, now time.Time) (time.Time, bool) {
+	m := smartAgeRe.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	n, _ := strconv.Atoi(m[1])
+	switch m[2] {
+	case "d":
+		return now.AddDate(0, 0, -n), true
+	case "w":
+		return now.AddDate(0, 0, -7*n), true
+	case "m":
+		return now.AddDate(0, -n, 0), true
+	default:
+		return now.AddDate(-n, 0, 0), true
+	}
+}
+
+// literal converts the text of a value to typ.
+func (p *smartParser) literal(typ smartType, s string) (smartValue, error) {
+	v := smartValue{ok: true}
+
+	switch typ {
+	case smartText:
+		v.strs = []string{strings.ToLower(s)}
+	case smartNumber:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid number %q", s)
+		}
+		v.num = n
+	case smartDuration:
+		d, err := parseSmartDuration(s)
+		if err != nil {
+			return v, err
+		}
+		v.num = float64(d / time.Millisecond)
+	case smartTime:
+		if t, ok := timeAgo(s, p.now); ok {
+			v.t = t
+			break
+		}
+
+		t, err := parseDate(s)
+		if err != nil {
+			return v, fmt.Errorf("invalid date %q, expected a date such as 2018-01-31 or a time ago such as 30d, 12w, 6m or 1y", s)
+		}
+		v.t = t
+	case smartBool:
+		switch strings.ToLower(s) {
+		case "true":
+			v.b = true
+		case "false":
+		default:
+			return v, fmt.Errorf("invalid value %q", s)
+		}
+	}
+
+	return v, nil
+}
+
+// parseSmartDuration parses a duration such as 3:30 or 3m30s.
+func parseSmartDuration(s string) (time.Duration, error) {
+	if parts := strings.Split(s, ":"); len(parts) == 2 {
+		m, err1 := strconv.Atoi(parts[0])
+		sec, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && sec < 60 {
+			return time.Duration(m)*time.Minute + time.Duration(sec)*time.Second, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, expected a duration such as 3:30 or 3m30s", s)
+	}
+
+	return d, nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// smartQueryNow is the time relative dates in queries count back from.
+var smartQueryNow = time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+// smartQueryCases are the queries of each golden file in testdata/smartquery.
+var smartQueryCases = []struct {
+	name    string
+	queries []string
+}{
+	{"precedence", []string{
+		``,
+		`artist = "Daft Punk"`,
+		`artist = "Daft Punk" or artist = "Miles Davis" and energy > 0.5`,
+		`(artist = "Daft Punk" or artist = "Miles Davis") and energy > 0.5`,
+		`not explicit and energy > 0.5`,
+		`not (explicit and energy > 0.5)`,
+		`not not explicit`,
+		`explicit or name ~ "so" and not genre = "jazz"`,
+		`ENERGY > 0.5 AND Name ~ 'ONE' Or key = "7A"`,
+	}},
+	{"fields", []string{
+		`name = "so what"`,
+		`name != "so what"`,
+		`name ~ "o"`,
+		`name !~ "o"`,
+		`artist = "pharrell williams"`,
+		`artist ~ "punk"`,
+		`album = "kind of blue"`,
+		`genre ~ "house"`,
+		`genre != "jazz"`,
+		`popularity >= 80`,
+		`tempo > 120 and danceability > 0.6`,
+		`valence < 0.3`,
+		`acousticness > 0.5 or instrumentalness > 0.5`,
+		`liveness > 0.3 or speechiness > 0.2`,
+		`loudness > -6`,
+		`key = 7A`,
+		`explicit`,
+		`explicit = false`,
+		`explicit != true`,
+		`duration >= 5:00`,
+		`duration < 4m`,
+		`duration = 9m22s`,
+		`year < 1990`,
+		`year = 2013`,
+	}},
+	{"dates", []string{
+		`added_at > 30d`,
+		`added_at > 2w`,
+		`added_at >= 6m`,
+		`added_at < 1y`,
+		`added_at = 2024-06-01`,
+		`added_at != 2024-06-01`,
+		`added_at > 2024-06-01`,
+		`added_at <= 2023-01-01T00:00:00Z`,
+		`release_date < 2000-01-01`,
+		`release_date = 1959-08-17`,
+		`release_date >= 2013-01-01`,
+		`release_date >= 2013`,
+		`release_date > 25y`,
+	}},
+	{"order", []string{
+		`order by name`,
+		`order by name desc`,
+		`order by energy desc`,
+		`order by energy asc`,
+		`order by explicit, popularity desc`,
+		`order by release_date desc, name`,
+		`order by year`,
+		`order by added_at desc limit 3`,
+		`limit 2`,
+		`energy > 0.5 limit 2 order by tempo`,
+		`not explicit order by duration desc limit 1`,
+		`limit 100`,
+	}},
+	{"errors", []string{
+		`unknown = 1`,
+		`energy >`,
+		`energy 0.5`,
+		`name`,
+		`(energy > 0.5`,
+		`energy > 0.5)`,
+		`name = "unterminated`,
+		`energy ! 0.5`,
+		`energy > 0.5 name = "x"`,
+		`energy > 0.5 and`,
+		`or energy > 0.5`,
+		`name = @`,
+		`order energy`,
+		`order by`,
+		`order by unknown`,
+		`order by name limit 0`,
+		`limit -1`,
+		`limit many`,
+		`limit 2 limit 3`,
+		`order by name order by energy`,
+	}},
+	{"types", []string{
+		`energy ~ 0.5`,
+		`energy > high`,
+		`popularity = "80"`,
+		`name > "a"`,
+		`artist < "m"`,
+		`explicit > false`,
+		`explicit = maybe`,
+		`duration > long`,
+		`duration > 3:75`,
+		`added_at > yesterday`,
+		`added_at > 30 days`,
+		`release_date ~ 2013`,
+		`year > nineteen`,
+	}},
+}
+
+// smartQueryTracks are the saved tracks the queries are evaluated against.
+func smartQueryTracks() []smartTrack {
+	features := func(energy, tempo, dance, valence, acoustic, instrumental, live, speech, loud float32, key, mode int) *spotify.AudioFeatures {
+		return &spotify.AudioFeatures{
+			Energy:           energy,
+			Tempo:            tempo,
+			Danceability:     dance,
+			Valence:          valence,
+			Acousticness:     acoustic,
+			Instrumentalness: instrumental,
+			Liveness:         live,
+			Speechiness:      speech,
+			Loudness:         loud,
+			Key:              key,
+			Mode:             mode,
+		}
+	}
+	track := func(name string, artists []string, album string, popularity, duration int) libraryItem {
+		return libraryItem{searchItem: searchItem{Type: "track", Name: name, Artists: artists, Album: album, Popularity: popularity, Duration: duration}}
+	}
+
+	return []smartTrack{
+		{
+			item:        track("Get Lucky", []string{"Daft Punk", "Pharrell Williams", "Nile Rodgers"}, "Random Access Memories", 84, 369626),
+			addedAt:     time.Date(2024, time.June, 1, 20, 0, 0, 0, time.UTC),
+			features:    features(0.81, 116, 0.79, 0.86, 0.04, 0.001, 0.1, 0.04, -8.9, 6, 0),
+			genres:      []string{"electro", "filter house"},
+			releaseDate: "2013-05-17",
+		},
+		{
+			item:        track("One More Time", []string{"Daft Punk"}, "Discovery", 80, 320357),
+			addedAt:     time.Date(2024, time.May, 20, 9, 0, 0, 0, time.UTC),
+			features:    features(0.7, 123, 0.61, 0.48, 0.02, 0.0, 0.33, 0.13, -8.6, 2, 1),
+			genres:      []string{"electro", "filter house"},
+			releaseDate: "2001-03-12",
+		},
+		{
+			item:        track("So What", []string{"Miles Davis"}, "Kind Of Blue", 70, 562000),
+			addedAt:     time.Date(2023, time.December, 24, 18, 0, 0, 0, time.UTC),
+			features:    features(0.2, 136, 0.49, 0.27, 0.85, 0.62, 0.1, 0.05, -15.6, 2, 0),
+			genres:      []string{"jazz", "cool jazz"},
+			releaseDate: "1959-08-17",
+		},
+		{
+			item:        track("Lose Yourself", []string{"Eminem"}, "8 Mile", 85, 326466),
+			addedAt:     time.Date(2022, time.March, 3, 7, 0, 0, 0, time.UTC),
+			explicit:    true,
+			features:    features(0.74, 171, 0.69, 0.06, 0.01, 0.0, 0.36, 0.26, -4.3, 2, 1),
+			genres:      []string{"hip hop", "rap"},
+			releaseDate: "2002",
+		},
+		{
+			item:        track("Smells Like Teen Spirit", []string{"Nirvana"}, "Nevermind", 78, 301920),
+			addedAt:     time.Date(2024, time.June, 14, 23, 0, 0, 0, time.UTC),
+			explicit:    false,
+			features:    features(0.91, 117, 0.5, 0.72, 0.0, 0.0, 0.1, 0.05, -4.6, 1, 1),
+			genres:      []string{"grunge", "rock"},
+			releaseDate: "1991-09",
+		},
+		{
+			// a local file without features, genres or release date
+			item:    track("Demo Take 3", []string{"Unknown Artist"}, "", 0, 95000),
+			addedAt: time.Date(2024, time.January, 5, 12, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestSmartQueryGolden(t *testing.T) {
+	// dates without a time are in the local time zone
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	tracks := smartQueryTracks()
+
+	for _, c := range smartQueryCases {
+		var b strings.Builder
+		for i, query := range c.queries {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			writeSmartQueryResult(&b, query, tracks)
+		}
+
+		path := filepath.Join("testdata", "smartquery", c.name+".golden")
+		if *updateGolden {
+			if err := ioutil.WriteFile(path, []byte(b.String()), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s, run go test -update to create it", err)
+		}
+		if got := b.String(); got != string(want) {
+			t.Errorf("%s doesn't match, run go test -update and check the diff:\n%s", path, got)
+		}
+	}
+}
+
+func TestSmartQueryApplyKeepsTracks(t *testing.T) {
+	tracks := smartQueryTracks()
+	q, err := parseSmartQuery(`order by energy desc`, smartQueryNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q.apply(tracks)
+
+	// apply sorts a copy
+	if tracks[0].item.Name != "Get Lucky" {
+		t.Errorf("apply reordered the tracks it was given")
+	}
+}
+
+// writeSmartQueryResult writes the parsed query or its error and the names
+// of the tracks it matches, in order.
+func writeSmartQueryResult(b *strings.Builder, query string, tracks []smartTrack) {
+	fmt.Fprintln(b, strings.TrimSpace("query: "+query))
+
+	q, err := parseSmartQuery(query, smartQueryNow)
+	if err != nil {
+		fmt.Fprintf(b, "error: %s\n", err)
+		return
+	}
+
+	cond := "all"
+	if q.cond != nil {
+		cond = formatSmartExpr(q.cond)
+	}
+	fmt.Fprintf(b, "cond: %s\n", cond)
+
+	if len(q.orders) > 0 {
+		var orders []string
+		for _, o := range q.orders {
+			dir := "asc"
+			if o.desc {
+				dir = "desc"
+			}
+			orders = append(orders, o.name+" "+dir)
+		}
+		fmt.Fprintf(b, "order: %s\n", strings.Join(orders, ", "))
+	}
+	if q.limit > 0 {
+		fmt.Fprintf(b, "limit: %d\n", q.limit)
+	}
+	if q.needs != 0 {
+		fmt.Fprintf(b, "needs: %s\n", formatSmartNeeds(q.needs))
+	}
+
+	var names []string
+	for _, t := range q.apply(tracks) {
+		names = append(names, t.item.Name)
+	}
+	if len(names) == 0 {
+		names = []string{"none"}
+	}
+	fmt.Fprintf(b, "tracks: %s\n", strings.Join(names, ", "))
+}
+
+func formatSmartExpr(e smartExpr) string {
+	switch e := e.(type) {
+	case smartAnd:
+		return "and(" + formatSmartExpr(e.left) + ", " + formatSmartExpr(e.right) + ")"
+	case smartOr:
+		return "or(" + formatSmartExpr(e.left) + ", " + formatSmartExpr(e.right) + ")"
+	case smartNot:
+		return "not(" + formatSmartExpr(e.expr) + ")"
+	case smartComparison:
+		return e.name + " " + e.op + " " + formatSmartValue(e.field.typ, e.value)
+	default:
+		return fmt.Sprintf("%#v", e)
+	}
+}
+
+func formatSmartValue(typ smartType, v smartValue) string {
+	switch typ {
+	case smartText:
+		return strconv.Quote(v.strs[0])
+	case smartDuration:
+		return (time.Duration(v.num) * time.Millisecond).String()
+	case smartTime:
+		return v.t.Format(time.RFC3339)
+	case smartBool:
+		return strconv.FormatBool(v.b)
+	default:
+		return strconv.FormatFloat(v.num, 'g', -1, 64)
+	}
+}
+
+func formatSmartNeeds(n smartNeeds) string {
+	var needs []string
+	for _, need := range []struct {
+		need smartNeeds
+		name string
+	}{
+		{smartNeedsFeatures, "features"},
+		{smartNeedsGenres, "genres"},
+		{smartNeedsAlbums, "albums"},
+	} {
+		if n&need.need != 0 {
+			needs = append(needs, need.name)
+		}
+	}
+
+	return strings.Join(needs, ", ")
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+const (
+	snapshotsDir      = "snapshots"
+	snapshotIDLayout  = "20060102-150405"
+	latestSnapshotArg = "latest"
+)
+
+var playlistSnapshotCmd = &cobra.Command{
+	Use:         "snapshot <playlist>",
+	Short:       "Save the current tracks of a playlist",
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistSnapshot,
+	Annotations: map[string]string{scopesAnnotation: playlistReadScopes},
+}
+
+var playlistHistoryCmd = &cobra.Command{
+	Use:         "history <playlist>",
+	Short:       "List the saved snapshots of a playlist",
+	Args:        cobra.ExactArgs(1),
+	RunE:        playlistHistory,
+	Annotations: map[string]string{scopesAnnotation: playlistReadScopes},
+}
+
+var playlistDiffCmd = &cobra.Command{
+	Use:         "diff <playlist> [snapshot] [snapshot]",
+	Short:       "Show the tracks added, removed and moved between snapshots",
+	Long:        `Show the tracks added, removed and moved between two snapshots of a playlist. Without snapshots, the latest snapshot is compared with the current tracks, with one snapshot, that snapshot is. Snapshots are given by their ID, a unique prefix of it, or latest.`,
+	Args:        cobra.RangeArgs(1, 3),
+	RunE:        playlistDiff,
+	Annotations: map[string]string{scopesAnnotation: playlistReadScopes},
+}
+
+var playlistRestoreCmd = &cobra.Command{
+	Use:         "restore <playlist> <snapshot>",
+	Short:       "Restore the tracks of a playlist from a snapshot",
+	Long:        `Restore the tracks of a playlist from a snapshot. If only the order of the tracks changed, they're moved back into place, which keeps when and by whom they were added. Otherwise all tracks are replaced. The current tracks are saved as a snapshot first.`,
+	Args:        cobra.ExactArgs(2),
+	RunE:        playlistRestore,
+	Annotations: map[string]string{scopesAnnotation: playlistModifyScopes},
+}
+
+// savedSnapshot is the saved track list of a playlist.
+type savedSnapshot struct {
+	ID         string    `json:"id"`
+	SnapshotID string    `json:"snapshot_id"`
+	TakenAt    time.Time `json:"taken_at"`
+	exportedPlaylist
+}
+
+func playlistSnapshot(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	snap, saved, err := takeSnapshot(p)
+	if err != nil {
+		return err
+	}
+
+	if saved {
+		fmt.Printf("Saved snapshot %s of %q with %d tracks.\n", snap.ID, snap.Name, len(snap.Tracks))
+	} else {
+		fmt.Printf("%q hasn't changed since snapshot %s.\n", snap.Name, snap.ID)
+	}
+
+	return nil
+}
+
+func playlistHistory(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	snaps, err := readSnapshots(p.ID)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for i := len(snaps) - 1; i >= 0; i-- {
+		changes := ""
+		if i > 0 {
+			added, removed, moved := countChanges(diffTracks(snaps[i-1].Tracks, snaps[i].Tracks))
+			changes = fmt.Sprintf("+%d -%d ~%d", added, removed, moved)
+		}
+
+		rows = append(rows, []string{
+			snaps[i].ID,
+			snaps[i].TakenAt.Local().Format("2006-01-02 15:04"),
+			fmt.Sprint(len(snaps[i].Tracks)),
+			changes,
+			snaps[i].SnapshotID,
+		})
+	}
+
+	return printTable([]string{"ID", "TAKEN", "TRACKS", "CHANGES", "SNAPSHOT_ID"}, rows)
+}
+
+func playlistDiff(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	snaps, err := readSnapshots(p.ID)
+	if err != nil {
+		return err
+	}
+
+	fromArg, toArg := latestSnapshotArg, ""
+	if len(args) > 1 {
+		fromArg = args[1]
+	}
+	if len(args) > 2 {
+		toArg = args[2]
+	}
+
+	from, err := findSnapshot(snaps, fromArg)
+	if err != nil {
+		return err
+	}
+
+	var to savedSnapshot
+	if toArg == "" {
+		current, err := exportPlaylist(p)
+		if err != nil {
+			return err
+		}
+		to = savedSnapshot{ID: "current", exportedPlaylist: current}
+	} else if to, err = findSnapshot(snaps, toArg); err != nil {
+		return err
+	}
+
+	changes := diffTracks(from.Tracks, to.Tracks)
+	if len(changes) == 0 {
+		fmt.Printf("No changes between %s and %s.\n", from.ID, to.ID)
+		return nil
+	}
+
+	fmt.Printf("Changes from %s to %s:\n", from.ID, to.ID)
+	for _, c := range changes {
+		switch c.kind {
+		case changeAdded:
+			fmt.Printf("+ %4d        %s%s\n", c.to+1, c.track, addedByNote(c.track))
+		case changeRemoved:
+			fmt.Printf("- %4d        %s%s\n", c.from+1, c.track, addedByNote(c.track))
+		case changeMoved:
+			fmt.Printf("~ %4d → %-4d %s%s\n", c.from+1, c.to+1, c.track, addedByNote(c.track))
+		}
+	}
+
+	added, removed, moved := countChanges(changes)
+	fmt.Printf("%d added, %d removed, %d moved.\n", added, removed, moved)
+
+	return nil
+}
+
+func playlistRestore(cmd *cobra.Command, args []string) error {
+	p, err := findPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+
+	snaps, err := readSnapshots(p.ID)
+	if err != nil {
+		return err
+	}
+
+	snap, err := findSnapshot(snaps, args[1])
+	if err != nil {
+		return err
+	}
+
+	current, saved, err := takeSnapshot(p)
+	if err != nil {
+		return err
+	}
+	if saved {
+		fmt.Printf("Saved the current tracks as snapshot %s.\n", current.ID)
+	}
+
+	pairs := pairTracks(current.Tracks, snap.Tracks)
+	if len(current.Tracks) == len(snap.Tracks) && !containsInt(pairs, -1) {
+		moves, err := reorderPlaylist(p, current.SnapshotID, pairs)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Restored the order of %q from snapshot %s with %d moves.\n", p.Name, snap.ID, moves)
+		return nil
+	}
+
+	var ids []spotify.ID
+	for _, t := range snap.Tracks {
+		ref, err := spotifyuri.ParseAs(string(t.URI), spotifyuri.Track)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", t, err)
+			continue
+		}
+		ids = append(ids, spotify.ID(ref.ID))
+	}
+
+	if err := replacePlaylistTracks(p, ids); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %d tracks of %q from snapshot %s.\n", len(ids), p.Name, snap.ID)
+
+	return nil
+}
+
+// takeSnapshot saves the current tracks of a playlist unless they're
+// already saved as the latest snapshot, which is returned instead.
+func takeSnapshot(p *spotify.SimplePlaylist) (savedSnapshot, bool, error) {
+	snaps, err := readSnapshots(p.ID)
+	if err != nil {
+		return savedSnapshot{}, false, err
+	}
+
+	if len(snaps) > 0 && snaps[len(snaps)-1].SnapshotID == p.SnapshotID {
+		return snaps[len(snaps)-1], false, nil
+	}
+
+	exported, err := exportPlaylist(p)
+	if err != nil {
+		return savedSnapshot{}, false, err
+	}
+
+	now := time.Now().UTC()
+	snap := savedSnapshot{
+		ID:               now.Format(snapshotIDLayout),
+		SnapshotID:       p.SnapshotID,
+		TakenAt:          now,
+		exportedPlaylist: exported,
+	}
+
+	path, err := dataFilePath(snapshotsDir, string(p.ID), snap.ID+".json")
+	if err != nil {
+		return snap, false, err
+	}
+
+	return snap, true, writeJSONFile(path, snap)
+}
+
+// readSnapshots reads the saved snapshots of a playlist, oldest first.
+func readSnapshots(id spotify.ID) ([]savedSnapshot, error) {
+	files, err := ioutil.ReadDir(filepath.Join(dataDir, snapshotsDir, string(id)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []savedSnapshot
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		var snap savedSnapshot
+		if err := readJSONFile(filepath.Join(dataDir, snapshotsDir, string(id), f.Name()), &snap); err != nil {
+			return nil, fmt.Errorf("can't read snapshot %s: %s", f.Name(), err)
+		}
+		snaps = append(snaps, snap)
+	}
+
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].TakenAt.Before(snaps[j].TakenAt)
+	})
+
+	return snaps, nil
+}
+
+// findSnapshot finds a snapshot by ID, a unique prefix of its ID or latest.
+func findSnapshot(snaps []savedSnapshot, arg string) (savedSnapshot, error) {
+	if len(snaps) == 0 {
+		return savedSnapshot{}, errors.New("there are no snapshots of this playlist, save one with playlist snapshot")
+	}
+
+	if arg == latestSnapshotArg {
+		return snaps[len(snaps)-1], nil
+	}
+
+	var matches []savedSnapshot
+	for _, s := range snaps {
+		if s.ID == arg {
+			return s, nil
+		}
+		if strings.HasPrefix(s.ID, arg) {
+			matches = append(matches, s)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return savedSnapshot{}, fmt.Errorf("no snapshot %s", arg)
+	case 1:
+		return matches[0], nil
+	default:
+		return savedSnapshot{}, fmt.Errorf("%d snapshots start with %s", len(matches), arg)
+	}
+}
+
+func addedByNote(t exportedTrack) string {
+	if t.AddedBy == "" {
+		return ""
+	}
+
+	return " (added by " + t.AddedBy + ")"
+}
+
+// The kinds of playlist changes.
+const (
+	changeAdded = iota
+	changeRemoved
+	changeMoved
+)
+
+// playlistChange is a track added, removed or moved between two versions of
+// a playlist. Positions count from 0 and are -1 if they don't apply.
+type playlistChange struct {
+	kind  int
+	from  int
+	to    int
+	track exportedTrack
+}
+
+// diffTracks returns the tracks removed from a, the tracks added to b and the
+// fewest tracks that have to be moved to turn a into b.
+func diffTracks(a, b []exportedTrack) []playlistChange {
+	var changes []playlistChange
+
+	pairs := pairTracks(a, b)
+
+	var kept, keptFrom []int
+	for i, j := range pairs {
+		if j < 0 {
+			changes = append(changes, playlistChange{changeRemoved, i, -1, a[i]})
+			continue
+		}
+		kept = append(kept, j)
+		keptFrom = append(keptFrom, i)
+	}
+
+	paired := make([]bool, len(b))
+	for _, j := range pairs {
+		if j >= 0 {
+			paired[j] = true
+		}
+	}
+	for j, ok := range paired {
+		if !ok {
+			changes = append(changes, playlistChange{changeAdded, -1, j, b[j]})
+		}
+	}
+
+	inOrder := increasingSubsequence(kept)
+	for k, j := range kept {
+		if !inOrder[k] {
+			changes = append(changes, playlistChange{changeMoved, keptFrom[k], j, b[j]})
+		}
+	}
+
+	return changes
+}
+
+func countChanges(changes []playlistChange) (added, removed, moved int) {
+	for _, c := range changes {
+		switch c.kind {
+		case changeAdded:
+			added++
+		case changeRemoved:
+			removed++
+		case changeMoved:
+			moved++
+		}
+	}
+
+	return added, removed, moved
+}
+
+// pairTracks pairs the tracks of a with the same tracks of b, the nth
+// occurrence of a track with its nth occurrence. It returns the index in b
+// of each track of a, or -1 if it isn't in b.
+func pairTracks(a, b []exportedTrack) []int {
+	positions := make(map[spotify.URI][]int)
+	for j, t := range b {
+		positions[t.URI] = append(positions[t.URI], j)
+	}
+
+	pairs := make([]int, len(a))
+	for i, t := range a {
+		pairs[i] = -1
+		if ps := positions[t.URI]; len(ps) > 0 {
+			pairs[i] = ps[0]
+			positions[t.URI] = ps[1:]
+		}
+	}
+
+	return pairs
+}
+
+// increasingSubsequence marks the elements of a longest strictly increasing
+// subsequence of seq.
+func increasingSubsequence(seq []int) []bool {
+	var (
+		// tails[k] is the index of the smallest last element of an increasing
+		// subsequence of length k+1
+		tails []int
+		prev  = make([]int, len(seq))
+	)
+	for i, v := range seq {
+		k := sort.Search(len(tails), func(k int) bool { return seq[tails[k]] >= v })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	in := make([]bool, len(seq))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			in[i] = true
+		}
+	}
+
+	return in
+}
+
+// reorderPlaylist moves the tracks of a playlist into order, where order[i]
+// is the new position of the track at position i, and returns the number of
+// moves. It fails without moving anything if the playlist changed since the
+// version snapshotID the order is based on.
+func reorderPlaylist(p *spotify.SimplePlaylist, snapshotID string, order []int) (int, error) {
+	latest, err := client.GetPlaylistOpt(p.Owner.ID, p.ID, "snapshot_id")
+	if err != nil {
+		return 0, err
+	}
+	if latest.SnapshotID != snapshotID {
+		return 0, fmt.Errorf("%q was changed in the meantime, try again", p.Name)
+	}
+
+	moves := reorderMoves(order)
+	for _, opt := range moves {
+		opt.SnapshotID = snapshotID
+		if snapshotID, err = client.ReorderPlaylistTracks(p.Owner.ID, p.ID, opt); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(moves), nil
+}
+
+// reorderMoves returns the fewest single-track moves that put the tracks of a
+// playlist in order, where order[i] is the position the track at position i
+// belongs at. The tracks of a longest increasing subsequence stay in place,
+// every other track is moved right after the closest track before it that's
+// already in place.
+func reorderMoves(order []int) []spotify.PlaylistReorderOptions {
+	cur := append([]int{}, order...)
+
+	placed := make([]bool, len(order))
+	for i, in := range increasingSubsequence(order) {
+		if in {
+			placed[order[i]] = true
+		}
+	}
+
+	var moves []spotify.PlaylistReorderOptions
+	for t := range placed {
+		if placed[t] {
+			continue
+		}
+
+		from, insertBefore := -1, 0
+		for i, v := range cur {
+			if v == t {
+				from = i
+			} else if placed[v] && v < t {
+				insertBefore = i + 1
+			}
+		}
+		placed[t] = true
+
+		if from == insertBefore || from+1 == insertBefore {
+			continue
+		}
+
+		moves = append(moves, spotify.PlaylistReorderOptions{
+			RangeStart:   from,
+			RangeLength:  1,
+			InsertBefore: insertBefore,
+		})
+
+		cur = append(cur[:from], cur[from+1:]...)
+		if insertBefore > from {
+			insertBefore--
+		}
+		cur = append(cur[:insertBefore], append([]int{t}, cur[insertBefore:]...)...)
+	}
+
+	return moves
+}
+
+func containsInt(s []int, v int) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+// applyMoves moves the elements of s like Spotify reorders a playlist: each
+// move takes a range out and inserts it before the element that was at
+// InsertBefore before the range was taken out.
+func applyMoves(s []int, moves []spotify.PlaylistReorderOptions) []int {
+	s = append([]int{}, s...)
+	for _, m := range moves {
+		from, n, before := m.RangeStart, m.RangeLength, m.InsertBefore
+
+		moved := append([]int{}, s[from:from+n]...)
+		var rest []int
+		rest = append(rest, s[:from]...)
+		rest = append(rest, s[from+n:]...)
+		if before > from {
+			before -= n
+		}
+
+		s = append(append(append([]int{}, rest[:before]...), moved...), rest[before:]...)
+	}
+
+	return s
+}
+
+// lisLength is the length of a longest strictly increasing subsequence of
+// s, the slow way.
+func lisLength(s []int) int {
+	longest := 0
+	lengths := make([]int, len(s))
+	for i := range s {
+		lengths[i] = 1
+		for j := 0; j < i; j++ {
+			if s[j] < s[i] && lengths[j]+1 > lengths[i] {
+				lengths[i] = lengths[j] + 1
+			}
+		}
+		if lengths[i] > longest {
+			longest = lengths[i]
+		}
+	}
+
+	return longest
+}
+
+// checkReorderMoves checks that the moves of reorderMoves sort order and
+// that no fewer would.
+func checkReorderMoves(t *testing.T, order []int) {
+	moves := reorderMoves(order)
+
+	for _, m := range moves {
+		if m.RangeLength != 1 {
+			t.Errorf("reorderMoves(%v) moves %d tracks at once, want 1", order, m.RangeLength)
+			return
+		}
+	}
+
+	got := applyMoves(order, moves)
+	for i, v := range got {
+		if v != i {
+			t.Errorf("reorderMoves(%v) = %+v, which orders %v", order, moves, got)
+			return
+		}
+	}
+
+	// every track outside a longest increasing subsequence has to move
+	if want := len(order) - lisLength(order); len(moves) != want {
+		t.Errorf("reorderMoves(%v) takes %d moves, want %d", order, len(moves), want)
+	}
+}
+
+func TestReorderMoves(t *testing.T) {
+	tests := [][]int{
+		nil,
+		{0},
+		{0, 1, 2, 3},
+		{1, 0},
+		{3, 2, 1, 0},
+		{1, 2, 3, 0},
+		{3, 0, 1, 2},
+		{0, 3, 1, 2},
+		{2, 0, 3, 1},
+		{1, 0, 3, 2, 5, 4},
+		{5, 1, 2, 3, 4, 0},
+		{4, 0, 6, 2, 7, 1, 5, 3},
+	}
+
+	for _, order := range tests {
+		checkReorderMoves(t, order)
+	}
+}
+
+func TestReorderMovesAllPermutations(t *testing.T) {
+	for n := 1; n <= 6; n++ {
+		order := make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+
+		var permute func(k int)
+		permute = func(k int) {
+			if k == n {
+				checkReorderMoves(t, order)
+				return
+			}
+			for i := k; i < n; i++ {
+				order[k], order[i] = order[i], order[k]
+				permute(k + 1)
+				order[k], order[i] = order[i], order[k]
+			}
+		}
+		permute(0)
+	}
+}
+
+func TestReorderMovesRandomPermutations(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		checkReorderMoves(t, r.Perm(7+r.Intn(40)))
+	}
+}
+
+func TestIncreasingSubsequence(t *testing.T) {
+	tests := [][]int{
+		nil,
+		{5},
+		{1, 2, 3},
+		{3, 2, 1},
+		{2, 2, 2},
+		{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15},
+	}
+
+	for _, seq := range tests {
+		in := increasingSubsequence(seq)
+
+		n, last := 0, -1
+		for i, ok := range in {
+			if !ok {
+				continue
+			}
+			if n > 0 && seq[i] <= last {
+				t.Errorf("increasingSubsequence(%v) = %v, which isn't increasing", seq, in)
+			}
+			n, last = n+1, seq[i]
+		}
+		if want := lisLength(seq); n != want {
+			t.Errorf("increasingSubsequence(%v) has %d elements, want %d", seq, n, want)
+		}
+	}
+}
+
+// snapshotTracks returns tracks whose URIs are the space-separated names.
+func snapshotTracks(names string) []exportedTrack {
+	var tracks []exportedTrack
+	for _, name := range strings.Fields(names) {
+		tracks = append(tracks, exportedTrack{Title: name, URI: spotify.URI(name)})
+	}
+
+	return tracks
+}
+
+func TestDiffTracks(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		// want are the changes: +track@to, -track@from and ~track from>to
+		want string
+	}{
+		{name: "unchanged", a: "a b c", b: "a b c"},
+		{name: "both empty"},
+		{name: "added to an empty playlist", a: "", b: "a b", want: "+a@0 +b@1"},
+		{name: "emptied", a: "a b", b: "", want: "-a@0 -b@1"},
+		{name: "added at the end", a: "a b", b: "a b c", want: "+c@2"},
+		{name: "removed at the start", a: "a b c", b: "b c", want: "-a@0"},
+		{name: "move to the end", a: "a b c d", b: "b c d a", want: "~a 0>3"},
+		{name: "move to the start", a: "a b c d", b: "d a b c", want: "~d 3>0"},
+		{name: "swap", a: "a b", b: "b a", want: "~a 0>1"},
+		{name: "added and removed at the same position", a: "a b c", b: "a x c", want: "-b@1 +x@1"},
+		{name: "removed and moved", a: "a b c d", b: "c a b", want: "-d@3 ~c 2>0"},
+		{name: "duplicate moved", a: "a b a", b: "a a b", want: "~b 1>2"},
+		{name: "duplicate removed", a: "a b a c", b: "a b c", want: "-a@2"},
+		// the nth occurrence pairs with the nth occurrence, so the last one is
+		// removed
+		{name: "one of duplicates removed", a: "a b a", b: "b a", want: "-a@2 ~a 0>1"},
+		{name: "duplicate added", a: "a b", b: "a b a", want: "+a@2"},
+		{name: "duplicates unchanged", a: "a a a", b: "a a a"},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, c := range diffTracks(snapshotTracks(tt.a), snapshotTracks(tt.b)) {
+			switch c.kind {
+			case changeAdded:
+				got = append(got, fmt.Sprintf("+%s@%d", c.track.URI, c.to))
+			case changeRemoved:
+				got = append(got, fmt.Sprintf("-%s@%d", c.track.URI, c.from))
+			case changeMoved:
+				got = append(got, fmt.Sprintf("~%s %d>%d", c.track.URI, c.from, c.to))
+			}
+		}
+
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%s: diffTracks(%q, %q) = %s, want %s", tt.name, tt.a, tt.b, strings.Join(got, " "), tt.want)
+		}
+	}
+}
+
+func TestPairTracks(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []int
+	}{
+		{"a b c", "c b a", []int{2, 1, 0}},
+		{"a b", "b", []int{-1, 0}},
+		// the nth occurrence pairs with the nth occurrence
+		{"a b a", "a a b", []int{0, 2, 1}},
+		{"a a a", "b a a", []int{1, 2, -1}},
+		{"", "a", []int{}},
+	}
+
+	for _, tt := range tests {
+		got := pairTracks(snapshotTracks(tt.a), snapshotTracks(tt.b))
+		if !equalInts(got, tt.want) {
+			t.Errorf("pairTracks(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ui "github.com/gizak/termui"
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+// outputChart draws statistics as charts in the terminal.
+const outputChart = "chart"
+
+// The logs statistics are drawn from. The history log doesn't tell skips or
+// the time listened.
+const (
+	statsSourceLog     = "log"
+	statsSourceHistory = "history"
+)
+
+var (
+	statsCmdFlagSince  string
+	statsCmdFlagLimit  int
+	statsCmdFlagBy     string
+	statsCmdFlagOutput string
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show your listening statistics",
+	Long: `Show your top artists, tracks, albums and genres, when you listen and how often you skip, from the plays logged by "spotctl log". If nothing was logged, the history synced by "spotctl history" is used instead, which doesn't tell skips or the time listened.
+
+--since takes a date such as 2018-01-31, a time ago such as 30d, 12w, 6m or 1y, or all. The statistics are drawn as charts unless --output is table or json. Press q to quit the charts.`,
+	Args: cobra.NoArgs,
+	RunE: stats,
+}
+
+// statsItem is an artist, track, album or genre with the plays it got.
+type statsItem struct {
+	Name     string      `json:"name"`
+	Artist   string      `json:"artist,omitempty"`
+	URI      spotify.URI `json:"uri,omitempty"`
+	Plays    int         `json:"plays"`
+	Listened int         `json:"listened_ms"`
+	Skips    int         `json:"skips"`
+	SkipRate float64     `json:"skip_rate"`
+}
+
+// statsDay is the listening of a day.
+type statsDay struct {
+	Date     string `json:"date"`
+	Plays    int    `json:"plays"`
+	Listened int    `json:"listened_ms"`
+	Skips    int    `json:"skips"`
+}
+
+// listeningStats are the statistics of the plays between From and To.
+type listeningStats struct {
+	Source        string      `json:"source"`
+	From          time.Time   `json:"from"`
+	To            time.Time   `json:"to"`
+	Plays         int         `json:"plays"`
+	Listened      int         `json:"listened_ms"`
+	Skips         int         `json:"skips"`
+	SkipRate      float64     `json:"skip_rate"`
+	UniqueTracks  int         `json:"unique_tracks"`
+	UniqueArtists int         `json:"unique_artists"`
+	Artists       []statsItem `json:"artists"`
+	Tracks        []statsItem `json:"tracks"`
+	Albums        []statsItem `json:"albums"`
+	Genres        []statsItem `json:"genres"`
+	// ByHour is the time listened in each hour of the day.
+	ByHour []int `json:"by_hour_ms"`
+	// ByWeekday is the time listened on each day of the week, Monday first.
+	ByWeekday []int      `json:"by_weekday_ms"`
+	ByDay     []statsDay `json:"by_day"`
+}
+
+var statsWeekdays = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+func stats(cmd *cobra.Command, args []string) error {
+	if statsCmdFlagBy != "plays" && statsCmdFlagBy != "time" {
+		return fmt.Errorf("invalid --by %s, expected plays or time", statsCmdFlagBy)
+	}
+	if statsCmdFlagLimit < 1 {
+		return errors.New("--limit must be positive")
+	}
+	switch statsCmdFlagOutput {
+	case outputChart, outputTable, outputJSON:
+	default:
+		return fmt.Errorf("unsupported output format %s", statsCmdFlagOutput)
+	}
+
+	now := time.Now()
+
+	var from time.Time
+	if statsCmdFlagSince != "all" {
+		if t, ok := timeAgo(statsCmdFlagSince, now); ok {
+			from = t
+		} else if t, err := parseDate(statsCmdFlagSince); err == nil {
+			from = t
+		} else {
+			return fmt.Errorf("invalid --since %q, expected a date such as 2018-01-31, a time ago such as 30d, 12w, 6m or 1y, or all", statsCmdFlagSince)
+		}
+	}
+
+	s, err := listeningStatsBetween(from, now, statsCmdFlagLimit, statsCmdFlagBy)
+	if err != nil {
+		return err
+	}
+
+	switch statsCmdFlagOutput {
+	case outputChart:
+		if s.Plays == 0 {
+			fmt.Println(`No plays were logged in that time, run "spotctl log" to log them.`)
+			return nil
+		}
+		return drawStats(s)
+	case outputTable:
+		return printStats(s)
+	default:
+		return printJSON(s)
+	}
+}
+
+// listeningStatsBetween computes the statistics of the plays between from
+// and to, ranking the top limit items by plays or time.
+func listeningStatsBetween(from, to time.Time, limit int, by string) (*listeningStats, error) {
+	plays, source, err := loadPlays(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks, genres, err := playDetails(plays)
+	if err != nil {
+		return nil, err
+	}
+
+	return computeStats(plays, source, tracks, genres, from, to, limit, by), nil
+}
+
+// loadPlays reads the plays between from and to from the listening log or,
+// if nothing was logged, from the history log. It returns the log they're
+// from.
+func loadPlays(from, to time.Time) ([]listenRecord, string, error) {
+	records, err := readListens()
+	if err != nil {
+		return nil, "", err
+	}
+
+	source := statsSourceLog
+	if len(records) == 0 {
+		source = statsSourceHistory
+
+		entries, err := readHistory()
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, e := range entries {
+			records = append(records, listenRecord{
+				StartedAt:  e.PlayedAt,
+				URI:        e.URI,
+				Name:       e.Name,
+				Artists:    e.Artists,
+				Duration:   e.Duration,
+				Listened:   e.Duration,
+				Completion: 1,
+				ContextURI: e.ContextURI,
+			})
+		}
+	}
+
+	var plays []listenRecord
+	for _, r := range records {
+		if !r.StartedAt.Before(from) && r.StartedAt.Before(to) {
+			plays = append(plays, r)
+		}
+	}
+
+	return plays, source, nil
+}
+
+// playDetails gets the tracks played and the genres of their artists, which
+// the logs don't keep.
+func playDetails(plays []listenRecord) (map[spotify.URI]*spotify.FullTrack, map[spotify.ID][]string, error) {
+	var (
+		uris []spotify.URI
+		ids  []spotify.ID
+	)
+	seen := make(map[spotify.URI]bool)
+	for _, p := range plays {
+		if seen[p.URI] {
+			continue
+		}
+		seen[p.URI] = true
+
+		if ref, err := spotifyuri.Parse(string(p.URI)); err == nil && ref.Type == spotifyuri.Track {
+			uris = append(uris, p.URI)
+			ids = append(ids, spotify.ID(ref.ID))
+		}
+	}
+
+	tracks := make(map[spotify.URI]*spotify.FullTrack)
+	var artistIDs []spotify.ID
+	seenArtists := make(map[spotify.ID]bool)
+
+	err := inBatches(len(ids), libraryBatchSize, func(start, end int) error {
+		batch, err := client.GetTracks(ids[start:end]...)
+		if err != nil {
+			return err
+		}
+
+		// relinked tracks come back with another URI, so they're matched
+		// by position
+		for i, t := range batch {
+			if t == nil {
+				continue
+			}
+			tracks[uris[start+i]] = t
+
+			for _, a := range t.Artists {
+				if !seenArtists[a.ID] {
+					seenArtists[a.ID] = true
+					artistIDs = append(artistIDs, a.ID)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	genres, err := artistGenres(artistIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tracks, genres, nil
+}
+
+func computeStats(plays []listenRecord, source string, tracks map[spotify.URI]*spotify.FullTrack, genres map[spotify.ID][]string, from, to time.Time, limit int, by string) *listeningStats {
+	s := &listeningStats{
+		Source:    source,
+		From:      from,
+		To:        to,
+		ByHour:    make([]int, 24),
+		ByWeekday: make([]int, 7),
+		ByDay:     []statsDay{},
+	}
+
+	var (
+		artistItems = make(map[string]*statsItem)
+		trackItems  = make(map[string]*statsItem)
+		albumItems  = make(map[string]*statsItem)
+		genreItems  = make(map[string]*statsItem)
+		days        = make(map[string]*statsDay)
+	)
+
+	for _, p := range plays {
+		s.Plays++
+		s.Listened += p.Listened
+		if p.Skipped {
+			s.Skips++
+		}
+
+		t := p.StartedAt.Local()
+		s.ByHour[t.Hour()] += p.Listened
+		s.ByWeekday[(int(t.Weekday())+6)%7] += p.Listened
+
+		date := t.Format("2006-01-02")
+		day := days[date]
+		if day == nil {
+			day = &statsDay{Date: date}
+			days[date] = day
+		}
+		day.Plays++
+		day.Listened += p.Listened
+		if p.Skipped {
+			day.Skips++
+		}
+
+		tallyPlay(trackItems, string(p.URI), statsItem{Name: p.Name, Artist: strings.Join(p.Artists, ", "), URI: p.URI}, p)
+
+		full := tracks[p.URI]
+		if full == nil {
+			for _, a := range p.Artists {
+				tallyPlay(artistItems, a, statsItem{Name: a}, p)
+			}
+			continue
+		}
+
+		tallyPlay(albumItems, string(full.Album.URI), statsItem{Name: full.Album.Name, Artist: strings.Join(artistNames(full.Album.Artists), ", "), URI: full.Album.URI}, p)
+
+		// a play counts once for a genre shared by its artists
+		seenGenres := make(map[string]bool)
+		for _, a := range full.Artists {
+			tallyPlay(artistItems, a.Name, statsItem{Name: a.Name, URI: a.URI}, p)
+
+			for _, g := range genres[a.ID] {
+				if !seenGenres[g] {
+					seenGenres[g] = true
+					tallyPlay(genreItems, g, statsItem{Name: g}, p)
+				}
+			}
+		}
+	}
+
+	if s.Plays > 0 {
+		s.SkipRate = float64(s.Skips) / float64(s.Plays)
+	}
+	s.UniqueTracks = len(trackItems)
+	s.UniqueArtists = len(artistItems)
+
+	s.Artists = topStats(artistItems, limit, by)
+	s.Tracks = topStats(trackItems, limit, by)
+	s.Albums = topStats(albumItems, limit, by)
+	s.Genres = topStats(genreItems, limit, by)
+
+	// the days start at the first play if there's no start
+	if s.From.IsZero() {
+		for _, p := range plays {
+			if s.From.IsZero() || p.StartedAt.Before(s.From) {
+				s.From = p.StartedAt
+			}
+		}
+	}
+	if !s.From.IsZero() {
+		y, m, d := s.From.Local().Date()
+		for t := time.Date(y, m, d, 0, 0, 0, 0, time.Local); t.Before(to); t = t.AddDate(0, 0, 1) {
+			date := t.Format("2006-01-02")
+			if day := days[date]; day != nil {
+				s.ByDay = append(s.ByDay, *day)
+			} else {
+				s.ByDay = append(s.ByDay, statsDay{Date: date})
+			}
+		}
+	}
+
+	return s
+}
+
+// tallyPlay adds a play to the item with key, which is created from item if
+// it's not in items yet.
+func tallyPlay(items map[string]*statsItem, key string, item statsItem, p listenRecord) {
+	it := items[key]
+	if it == nil {
+		it = &item
+		items[key] = it
+	}
+
+	it.Plays++
+	it.Listened += p.Listened
+	if p.Skipped {
+		it.Skips++
+	}
+}
+
+// topStats returns the top limit items by plays or by time listened.
+func topStats(items map[string]*statsItem, limit int, by string) []statsItem {
+	top := make([]statsItem, 0, len(items))
+	for _, it := range items {
+		it.SkipRate = float64(it.Skips) / float64(it.Plays)
+		top = append(top, *it)
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		a, b := top[i], top[j]
+		if by == "time" && a.Listened != b.Listened {
+			return a.Listened > b.Listened
+		}
+		if a.Plays != b.Plays {
+			return a.Plays > b.Plays
+		}
+		if a.Listened != b.Listened {
+			return a.Listened > b.Listened
+		}
+		return a.Name < b.Name
+	})
+
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	return top
+}
+
+// listeningTimeToStr formats a time listened in hours and minutes, such as
+// 12h 05m.
+func listeningTimeToStr(ms int) string {
+	m := ms / int(time.Minute/time.Millisecond)
+	if m < 60 {
+		return fmt.Sprintf("%dm", m)
+	}
+
+	return fmt.Sprintf("%dh %02dm", m/60, m%60)
+}
+
+// skipRateToStr formats a skip rate, which only the listening log tells.
+func (s *listeningStats) skipRateToStr(rate float64) string {
+	if s.Source != statsSourceLog {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.0f%%", rate*100)
+}
+
+func (s *listeningStats) summary() string {
+	since := "All time"
+	if !s.From.IsZero() {
+		since = "Since " + s.From.Local().Format("2006-01-02")
+	}
+
+	return fmt.Sprintf("%s: %d plays of %d tracks by %d artists, %s listened, %s skipped.", since, s.Plays, s.UniqueTracks, s.UniqueArtists, listeningTimeToStr(s.Listened), s.skipRateToStr(s.SkipRate))
+}
+
+// minutes converts times listened to whole minutes.
+func minutes(ms []int) []int {
+	m := make([]int, len(ms))
+	for i, v := range ms {
+		m[i] = v / int(time.Minute/time.Millisecond)
+	}
+
+	return m
+}
+
+func printStats(s *listeningStats) error {
+	fmt.Println(s.summary())
+
+	tops := []struct {
+		title string
+		items []statsItem
+	}{
+		{"ARTIST", s.Artists},
+		{"TRACK", s.Tracks},
+		{"ALBUM", s.Albums},
+		{"GENRE", s.Genres},
+	}
+	for _, top := range tops {
+		if len(top.items) == 0 {
+			continue
+		}
+
+		rows := make([][]string, len(top.items))
+		for i, it := range top.items {
+			name := it.Name
+			if it.Artist != "" {
+				name += " - " + it.Artist
+			}
+			rows[i] = []string{fmt.Sprint(i + 1), name, fmt.Sprint(it.Plays), listeningTimeToStr(it.Listened), s.skipRateToStr(it.SkipRate)}
+		}
+
+		fmt.Println()
+		if err := printTable([]string{"#", top.title, "PLAYS", "TIME", "SKIPPED"}, rows); err != nil {
+			return err
+		}
+	}
+
+	hours := make([]string, 24)
+	for i := range hours {
+		hours[i] = fmt.Sprintf("%02d", i)
+	}
+
+	fmt.Println()
+	if err := printHistogram("HOUR", hours, s.ByHour); err != nil {
+		return err
+	}
+	fmt.Println()
+
+	return printHistogram("DAY", statsWeekdays, s.ByWeekday)
+}
+
+// printHistogram prints times listened as rows of bars.
+func printHistogram(title string, labels []string, values []int) error {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	rows := make([][]string, len(values))
+	for i, v := range values {
+		bar := ""
+		if max > 0 {
+			bar = strings.Repeat("█", v*40/max)
+		}
+		rows[i] = []string{labels[i], listeningTimeToStr(v), bar}
+	}
+
+	return printTable([]string{title, "TIME", ""}, rows)
+}
+
+// drawStats draws the statistics as charts until q is pressed.
+func drawStats(s *listeningStats) error {
+	if err := ui.Init(); err != nil {
+		return err
+	}
+	defer ui.Close()
+
+	summary := ui.NewPar(s.summary())
+	summary.Height = 3
+
+	var tops []ui.GridBufferer
+	for _, top := range []struct {
+		title string
+		items []statsItem
+	}{
+		{"Top artists", s.Artists},
+		{"Top tracks", s.Tracks},
+		{"Top albums", s.Albums},
+		{"Top genres", s.Genres},
+	} {
+		l := ui.NewList()
+		l.BorderLabel = top.title
+		l.Height = statsCmdFlagLimit + 2
+		for _, it := range top.items {
+			value := fmt.Sprint(it.Plays)
+			if statsCmdFlagBy == "time" {
+				value = listeningTimeToStr(it.Listened)
+			}
+			l.Items = append(l.Items, fmt.Sprintf("%4s %s", value, it.Name))
+		}
+		tops = append(tops, l)
+	}
+
+	hours := ui.NewBarChart()
+	hours.BorderLabel = "Minutes by hour"
+	hours.Data = minutes(s.ByHour)
+	for i := range s.ByHour {
+		hours.DataLabels = append(hours.DataLabels, fmt.Sprint(i))
+	}
+	hours.BarWidth = 2
+	hours.BarGap = 0
+	hours.Height = 10
+
+	weekdays := ui.NewBarChart()
+	weekdays.BorderLabel = "Minutes by day"
+	weekdays.Data = minutes(s.ByWeekday)
+	weekdays.DataLabels = statsWeekdays
+	weekdays.BarWidth = 3
+	weekdays.BarGap = 0
+	weekdays.Height = 10
+
+	var played, skipped []int
+	for _, d := range s.ByDay {
+		played = append(played, d.Listened/int(time.Minute/time.Millisecond))
+		skip := 0
+		if d.Plays > 0 {
+			skip = d.Skips * 100 / d.Plays
+		}
+		skipped = append(skipped, skip)
+	}
+
+	// the sparklines show the latest days that fit
+	if n := ui.TermWidth() - 2; n > 0 && len(played) > n {
+		played, skipped = played[len(played)-n:], skipped[len(skipped)-n:]
+	}
+
+	playedLine := ui.NewSparkline()
+	playedLine.Title = "Minutes listened by day"
+	playedLine.Data = played
+	playedLine.Height = 3
+	lines := ui.NewSparklines(playedLine)
+	lines.Height = 6
+	if s.Source == statsSourceLog {
+		skippedLine := ui.NewSparkline()
+		skippedLine.Title = "Percentage skipped by day"
+		skippedLine.Data = skipped
+		skippedLine.Height = 3
+		lines.Add(skippedLine)
+		lines.Height = 10
+	}
+
+	help := ui.NewPar("Press q to quit.")
+	help.Border = false
+	help.Height = 1
+
+	ui.Body.AddRows(
+		ui.NewRow(ui.NewCol(12, 0, summary)),
+		ui.NewRow(ui.NewCol(3, 0, tops[0]), ui.NewCol(3, 0, tops[1]), ui.NewCol(3, 0, tops[2]), ui.NewCol(3, 0, tops[3])),
+		ui.NewRow(ui.NewCol(8, 0, hours), ui.NewCol(4, 0, weekdays)),
+		ui.NewRow(ui.NewCol(12, 0, lines)),
+		ui.NewRow(ui.NewCol(12, 0, help)),
+	)
+
+	draw := func() {
+		ui.Body.Width = ui.TermWidth()
+		ui.Body.Align()
+		ui.Clear()
+		ui.Render(ui.Body)
+	}
+
+	ui.Handle("/sys/kbd/q", func(ui.Event) {
+		ui.StopLoop()
+	})
+
+	ui.Handle("/sys/wnd/resize", func(ui.Event) {
+		draw()
+	})
+
+	draw()
+	ui.Loop()
+
+	return nil
+}
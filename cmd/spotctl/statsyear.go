@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// statsYearTop is the number of top artists, tracks, albums and genres in a
+// year report.
+const statsYearTop = 5
+
+var statsYearCmdFlagFile string
+
+var statsYearCmd = &cobra.Command{
+	Use:   "year [year]",
+	Short: "Write a report of your year in music",
+	Long:  `Write your top artists, tracks, albums and genres of a year and when you listened to them to a self-contained HTML page, which can be opened in any browser. The year is the current one unless given.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  statsYear,
+}
+
+// statsBar is a bar of a chart in a year report.
+type statsBar struct {
+	Label   string
+	Value   string
+	Percent int
+}
+
+// statsTop is a list of top items with its title.
+type statsTop struct {
+	Title string
+	Items []statsItem
+}
+
+// yearReport is what a year report shows.
+type yearReport struct {
+	Year      int
+	Stats     *listeningStats
+	Listened  string
+	SkipRate  string
+	TopDay    statsDay
+	TopDayFor string
+	Streak    int
+	Tops      []statsTop
+	Months    []statsBar
+	Hours     []statsBar
+	Weekdays  []statsBar
+}
+
+func statsYear(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+
+	year := now.Year()
+	if len(args) == 1 {
+		y, err := strconv.Atoi(args[0])
+		if err != nil || y < 2008 || y > now.Year() {
+			return fmt.Errorf("invalid year %q, expected a year from 2008 to %d", args[0], now.Year())
+		}
+		year = y
+	}
+
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(1, 0, 0)
+	if to.After(now) {
+		to = now
+	}
+
+	s, err := listeningStatsBetween(from, to, statsYearTop, "time")
+	if err != nil {
+		return err
+	}
+	if s.Plays == 0 {
+		return fmt.Errorf(`no plays were logged in %d, run "spotctl log" to log them`, year)
+	}
+
+	path := statsYearCmdFlagFile
+	if path == "" {
+		path = fmt.Sprintf("spotctl-%d.html", year)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := yearReportTemplate.Execute(f, newYearReport(year, s)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote your %d in music to %s.\n", year, path)
+
+	return nil
+}
+
+func newYearReport(year int, s *listeningStats) *yearReport {
+	r := &yearReport{
+		Year:     year,
+		Stats:    s,
+		Listened: listeningTimeToStr(s.Listened),
+		SkipRate: s.skipRateToStr(s.SkipRate),
+		Tops: []statsTop{
+			{"Artists", s.Artists},
+			{"Tracks", s.Tracks},
+			{"Albums", s.Albums},
+			{"Genres", s.Genres},
+		},
+	}
+
+	months := make([]int, 12)
+	streak := 0
+	for _, d := range s.ByDay {
+		if t, err := time.Parse("2006-01-02", d.Date); err == nil {
+			months[t.Month()-1] += d.Listened
+		}
+
+		if d.Listened > r.TopDay.Listened {
+			r.TopDay = d
+		}
+
+		if d.Plays > 0 {
+			streak++
+			if streak > r.Streak {
+				r.Streak = streak
+			}
+		} else {
+			streak = 0
+		}
+	}
+	if t, err := time.Parse("2006-01-02", r.TopDay.Date); err == nil {
+		r.TopDayFor = t.Format("Monday, January 2")
+	}
+
+	monthNames := make([]string, 12)
+	for i := range monthNames {
+		monthNames[i] = time.Month(i + 1).String()[:3]
+	}
+	hourNames := make([]string, 24)
+	for i := range hourNames {
+		hourNames[i] = strconv.Itoa(i)
+	}
+
+	r.Months = statsBars(monthNames, months)
+	r.Hours = statsBars(hourNames, s.ByHour)
+	r.Weekdays = statsBars(statsWeekdays, s.ByWeekday)
+
+	return r
+}
+
+// statsBars makes the bars of times listened, the longest one at 100%.
+func statsBars(labels []string, values []int) []statsBar {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	bars := make([]statsBar, len(values))
+	for i, v := range values {
+		bars[i] = statsBar{Label: labels[i], Value: listeningTimeToStr(v)}
+		if max > 0 {
+			bars[i].Percent = v * 100 / max
+		}
+	}
+
+	return bars
+}
+
+var yearReportTemplate = template.Must(template.New("year").Funcs(template.FuncMap{
+	"time": listeningTimeToStr,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Your {{.Year}} in music</title>
+<style>
+body { margin: 0; background: #121212; color: #fff; font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; }
+main { max-width: 960px; margin: 0 auto; padding: 48px 24px; }
+h1 { margin: 0 0 8px; font-size: 56px; }
+h2 { margin: 48px 0 16px; color: #1db954; }
+.muted, li small, .bar span { color: #b3b3b3; }
+.totals { display: flex; flex-wrap: wrap; gap: 16px; margin-top: 32px; }
+.total { flex: 1 1 160px; padding: 16px; background: #181818; border-radius: 8px; }
+.total b { display: block; font-size: 32px; }
+.tops { display: grid; grid-template-columns: repeat(auto-fit, minmax(200px, 1fr)); gap: 24px; }
+ol { padding-left: 24px; }
+li { margin: 8px 0; }
+li small { display: block; }
+.chart { display: flex; align-items: flex-end; gap: 4px; height: 180px; }
+.bar { display: flex; flex: 1; flex-direction: column; justify-content: flex-end; height: 100%; text-align: center; font-size: 11px; }
+.bar div { min-height: 1px; background: #1db954; border-radius: 3px 3px 0 0; }
+footer { margin-top: 48px; color: #535353; font-size: 12px; }
+</style>
+</head>
+<body>
+<main>
+<h1>Your {{.Year}} in music</h1>
+<p class="muted">From {{.Stats.From.Format "January 2"}} to {{.Stats.To.Format "January 2, 2006"}}.</p>
+
+<div class="totals">
+<div class="total"><b>{{.Listened}}</b>listened</div>
+<div class="total"><b>{{.Stats.Plays}}</b>plays</div>
+<div class="total"><b>{{.Stats.UniqueTracks}}</b>tracks</div>
+<div class="total"><b>{{.Stats.UniqueArtists}}</b>artists</div>
+<div class="total"><b>{{.SkipRate}}</b>skipped</div>
+<div class="total"><b>{{.Streak}} days</b>longest streak</div>
+</div>
+
+<h2>Your favorites</h2>
+<div class="tops">
+{{- range .Tops}}
+<div>
+<h3>{{.Title}}</h3>
+<ol>
+{{- range .Items}}
+<li>{{.Name}}<small>{{if .Artist}}{{.Artist}} · {{end}}{{time .Listened}}, {{.Plays}} plays</small></li>
+{{- end}}
+</ol>
+</div>
+{{- end}}
+</div>
+
+<h2>Your months</h2>
+<div class="chart">
+{{- range .Months}}
+<div class="bar" title="{{.Label}}: {{.Value}}"><div style="height: {{.Percent}}%"></div><span>{{.Label}}</span></div>
+{{- end}}
+</div>
+
+<h2>Your days</h2>
+<p class="muted">You listened the most on {{.TopDayFor}}, for {{time .TopDay.Listened}}.</p>
+<div class="chart">
+{{- range .Weekdays}}
+<div class="bar" title="{{.Label}}: {{.Value}}"><div style="height: {{.Percent}}%"></div><span>{{.Label}}</span></div>
+{{- end}}
+</div>
+
+<h2>Your hours</h2>
+<div class="chart">
+{{- range .Hours}}
+<div class="bar" title="{{.Label}}:00: {{.Value}}"><div style="height: {{.Percent}}%"></div><span>{{.Label}}</span></div>
+{{- end}}
+</div>
+
+<footer>Made with spotctl from {{if eq .Stats.Source "log"}}the plays logged by spotctl log{{else}}the history synced by spotctl history{{end}}.</footer>
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+)
+
+// topRanges are the time ranges of top items, from the shortest.
+var topRanges = []string{"short", "medium", "long"}
+
+var (
+	topCmdFlagRange        string
+	topCmdFlagLimit        int
+	topCmdFlagCompare      bool
+	topCmdFlagOutput       string
+	topCmdFlagSavePlaylist string
+)
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show your top tracks and artists",
+	Long: `Show the tracks or artists you played the most over a time range: short for about the last 4 weeks, medium for about the last 6 months and long for several years.
+
+With --compare, the ranks in every range are shown side by side, in the order of the short term, along with how they moved from the medium to the short term. Items that dropped out of the short term come last.`,
+}
+
+var topTracksCmd = &cobra.Command{
+	Use:         "tracks",
+	Short:       "Show your top tracks",
+	Long:        `Show your top tracks. With --save-playlist, they're saved to a playlist of that name instead, which is only changed if they changed, so that it can be refreshed regularly.`,
+	Args:        cobra.NoArgs,
+	RunE:        topTracks,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserTopRead},
+}
+
+var topArtistsCmd = &cobra.Command{
+	Use:         "artists",
+	Short:       "Show your top artists",
+	Args:        cobra.NoArgs,
+	RunE:        topArtists,
+	Annotations: map[string]string{scopesAnnotation: spotify.ScopeUserTopRead},
+}
+
+// topComparison is an item with its ranks in each range, 0 if it's not in
+// the top of a range.
+type topComparison struct {
+	searchItem
+	Short  int `json:"short,omitempty"`
+	Medium int `json:"medium,omitempty"`
+	Long   int `json:"long,omitempty"`
+}
+
+// move tells how the item moved from the medium to the short term.
+func (c topComparison) move() string {
+	switch {
+	case c.Short == 0:
+		return "out"
+	case c.Medium == 0:
+		return "new"
+	case c.Short < c.Medium:
+		return fmt.Sprintf("↑%d", c.Medium-c.Short)
+	case c.Short > c.Medium:
+		return fmt.Sprintf("↓%d", c.Short-c.Medium)
+	default:
+		return "="
+	}
+}
+
+func validateTopFlags() error {
+	if !containsString(topRanges, topCmdFlagRange) {
+		return fmt.Errorf("invalid --range %s, expected short, medium or long", topCmdFlagRange)
+	}
+	if topCmdFlagLimit < 1 || topCmdFlagLimit > 50 {
+		return errors.New("--limit must be between 1 and 50")
+	}
+
+	return nil
+}
+
+func topTracks(cmd *cobra.Command, args []string) error {
+	if err := validateTopFlags(); err != nil {
+		return err
+	}
+
+	if topCmdFlagCompare {
+		if topCmdFlagSavePlaylist != "" {
+			return errors.New("--save-playlist can't be used with --compare")
+		}
+		return compareTop(getTopTracks)
+	}
+
+	items, err := getTopTracks(topCmdFlagRange)
+	if err != nil {
+		return err
+	}
+
+	if topCmdFlagSavePlaylist != "" {
+		ids := make([]spotify.ID, 0, len(items))
+		for _, item := range items {
+			if id := trackID(item.URI); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		return refreshPlaylist(topCmdFlagSavePlaylist, ids, false)
+	}
+
+	if topCmdFlagOutput == outputTable {
+		if err := fillAlbumDetails(items); err != nil {
+			return err
+		}
+	}
+
+	return printTopItems(items, topCmdFlagOutput)
+}
+
+func topArtists(cmd *cobra.Command, args []string) error {
+	if err := validateTopFlags(); err != nil {
+		return err
+	}
+
+	if topCmdFlagCompare {
+		return compareTop(getTopArtists)
+	}
+
+	items, err := getTopArtists(topCmdFlagRange)
+	if err != nil {
+		return err
+	}
+
+	return printTopItems(items, topCmdFlagOutput)
+}
+
+func getTopTracks(timerange string) ([]searchItem, error) {
+	limit := topCmdFlagLimit
+	page, err := client.CurrentUsersTopTracksOpt(&spotify.Options{Limit: &limit, Timerange: &timerange})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]searchItem, len(page.Tracks))
+	for i, t := range page.Tracks {
+		items[i] = searchItem{
+			Type:       "track",
+			Name:       t.Name,
+			Artists:    artistNames(t.Artists),
+			Album:      t.Album.Name,
+			Duration:   t.Duration,
+			Popularity: t.Popularity,
+			URI:        t.URI,
+			albumID:    t.Album.ID,
+		}
+	}
+
+	return items, nil
+}
+
+func getTopArtists(timerange string) ([]searchItem, error) {
+	limit := topCmdFlagLimit
+	page, err := client.CurrentUsersTopArtistsOpt(&spotify.Options{Limit: &limit, Timerange: &timerange})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]searchItem, len(page.Artists))
+	for i, a := range page.Artists {
+		items[i] = searchItem{
+			Type:       "artist",
+			Name:       a.Name,
+			Popularity: a.Popularity,
+			URI:        a.URI,
+		}
+	}
+
+	return items, nil
+}
+
+// compareTop gets the top items of every range and prints their ranks.
+func compareTop(get func(timerange string) ([]searchItem, error)) error {
+	byURI := make(map[spotify.URI]*topComparison)
+	var comparisons []*topComparison
+
+	for _, r := range topRanges {
+		items, err := get(r)
+		if err != nil {
+			return err
+		}
+
+		for i, item := range items {
+			c := byURI[item.URI]
+			if c == nil {
+				c = &topComparison{searchItem: item}
+				byURI[item.URI] = c
+				comparisons = append(comparisons, c)
+			}
+
+			switch r {
+			case "short":
+				c.Short = i + 1
+			case "medium":
+				c.Medium = i + 1
+			default:
+				c.Long = i + 1
+			}
+		}
+	}
+
+	// items are in the order of the shortest range they're in
+	sort.SliceStable(comparisons, func(i, j int) bool {
+		return topCompareKey(comparisons[i]) < topCompareKey(comparisons[j])
+	})
+
+	switch topCmdFlagOutput {
+	case outputTable:
+		rows := make([][]string, len(comparisons))
+		for i, c := range comparisons {
+			rows[i] = []string{rankToStr(c.Short), rankToStr(c.Medium), rankToStr(c.Long), c.move(), c.Name, strings.Join(c.Artists, ", ")}
+		}
+		return printTable([]string{"SHORT", "MEDIUM", "LONG", "MOVE", "NAME", "ARTIST"}, rows)
+	case outputJSON:
+		list := make([]topComparison, len(comparisons))
+		for i, c := range comparisons {
+			list[i] = *c
+		}
+		return printJSON(list)
+	case outputURI:
+		for _, c := range comparisons {
+			fmt.Println(c.URI)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %s", topCmdFlagOutput)
+	}
+}
+
+// topCompareKey orders items by their short term rank, then by their medium
+// term rank and then by their long term rank.
+func topCompareKey(c *topComparison) int {
+	switch {
+	case c.Short > 0:
+		return c.Short
+	case c.Medium > 0:
+		return 100 + c.Medium
+	default:
+		return 200 + c.Long
+	}
+}
+
+func rankToStr(rank int) string {
+	if rank == 0 {
+		return "-"
+	}
+
+	return strconv.Itoa(rank)
+}
+
+func printTopItems(items []searchItem, output string) error {
+	switch output {
+	case outputTable:
+		rows := make([][]string, len(items))
+		for i, item := range items {
+			rows[i] = append(append([]string{strconv.Itoa(i + 1)}, item.columns()[1:]...), string(item.URI))
+		}
+		return printTable(append(append([]string{"#"}, searchItemHeader[1:]...), "URI"), rows)
+	case outputJSON:
+		if items == nil {
+			items = []searchItem{}
+		}
+		return printJSON(items)
+	case outputURI:
+		for _, item := range items {
+			fmt.Println(item.URI)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %s", output)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/zmb3/spotify"
+)
+
+// maxPlayURIs is the number of URIs sent in a single play request. Larger
+// requests are rejected by the Web API.
+const maxPlayURIs = 100
+
+// resolvedLine is the outcome of resolving a line of a track list.
+type resolvedLine struct {
+	line int
+	text string
+	uri  spotify.URI
+	err  error
+}
+
+// readTrackList reads the non-empty lines of r that aren't # comments.
+func readTrackList(r io.Reader) ([]resolvedLine, error) {
+	var lines []resolvedLine
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		lines = append(lines, resolvedLine{line: n, text: text})
+	}
+
+	return lines, scanner.Err()
+}
+
+// resolveTrackList resolves the lines into track URIs using up to concurrency
+// requests at a time. Lines that can't be resolved keep their error.
+func resolveTrackList(lines []resolvedLine, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+	for i := range lines {
+		wg.Add(1)
+		go func(l *resolvedLine) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			l.uri, l.err = resolveTrackLine(l.text)
+		}(&lines[i])
+	}
+	wg.Wait()
+}
+
+// resolveTrackLine resolves a URI, URL, bare track ID or an "artist - title"
+// line into a playable URI.
+func resolveTrackLine(text string) (spotify.URI, error) {
+	if spotifyuri.LooksLikeURI(text) || spotifyuri.IsID(text) {
+		var t spotifyuri.Type
+		if spotifyuri.IsID(text) {
+			t = spotifyuri.Track
+		}
+
+		ref, err := spotifyuri.ParseAs(text, t)
+		if err != nil {
+			return "", err
+		}
+		if ref.IsContext() {
+			return "", fmt.Errorf("%s is a %s, only tracks and episodes can be played from a list", text, ref.Type)
+		}
+		return spotify.URI(ref.URI()), nil
+	}
+
+	queries := []string{text}
+	if parts := strings.SplitN(text, " - ", 2); len(parts) == 2 {
+		artist, title := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		queries = []string{
+			buildSearchQuery(`track:"`+strings.Replace(title, `"`, "", -1)+`"`, searchFilters{artist: artist}),
+			artist + " " + title,
+		}
+	}
+
+	limit := 1
+	for _, q := range queries {
+		result, err := client.SearchOpt(q, spotify.SearchTypeTrack, &spotify.Options{Limit: &limit})
+		if err != nil {
+			return "", err
+		}
+		if result.Tracks != nil && len(result.Tracks.Tracks) > 0 {
+			return result.Tracks.Tracks[0].URI, nil
+		}
+	}
+
+	return "", errors.New("no track found")
+}
+
+// trackListToPlay reads a track list from stdin if name is "-" or from the
+// named file and resolves it into a list of URIs to play. The tracks past
+// the maximum a play request accepts are returned to be queued.
+func trackListToPlay(name string, concurrency int) (*spotify.PlayOptions, []spotify.URI, error) {
+	r := io.Reader(os.Stdin)
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	lines, err := readTrackList(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolveTrackList(lines, concurrency)
+
+	var uris []spotify.URI
+	for _, l := range lines {
+		if l.err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %s: %s\n", l.line, l.text, l.err)
+			continue
+		}
+		uris = append(uris, l.uri)
+	}
+
+	if len(uris) == 0 {
+		return nil, nil, errors.New("no tracks to play")
+	}
+
+	var rest []spotify.URI
+	if len(uris) > maxPlayURIs {
+		uris, rest = uris[:maxPlayURIs], uris[maxPlayURIs:]
+	}
+
+	return &spotify.PlayOptions{URIs: uris}, rest, nil
+}
+
+// queueTracks adds tracks to the end of the playback queue, one request per
+// track as the Web API takes them.
+func queueTracks(uris []spotify.URI, deviceID *spotify.ID) error {
+	for i, uri := range uris {
+		params := url.Values{"uri": {string(uri)}}
+		if deviceID != nil {
+			params.Set("device_id", string(*deviceID))
+		}
+
+		if err := postAPI("me/player/queue?" + params.Encode()); err != nil {
+			return fmt.Errorf("queued %d of %d tracks: %s", i, len(uris), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jingweno/spotctl/spotifyuri"
+	"github.com/spf13/cobra"
+)
+
+var (
+	uriCmdFlagTo   string
+	uriCmdFlagType string
+)
+
+var uriCmd = &cobra.Command{
+	Use:   "uri [uri|url|id]...",
+	Short: "Convert between Spotify URLs, URIs and IDs",
+	Long:  `Convert Spotify URIs, open.spotify.com URLs and IDs into another form specified with --to. Bare IDs require their type to be specified with --type.`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  uri,
+}
+
+func uri(cmd *cobra.Command, args []string) error {
+	var t spotifyuri.Type
+	if uriCmdFlagType != "" {
+		var err error
+		if t, err = spotifyuri.ParseType(uriCmdFlagType); err != nil {
+			return err
+		}
+	}
+
+	for _, arg := range args {
+		ref, err := spotifyuri.ParseAs(arg, t)
+		if err != nil {
+			return err
+		}
+
+		switch uriCmdFlagTo {
+		case "uri":
+			fmt.Println(ref.URI())
+		case "url":
+			fmt.Println(ref.URL())
+		case "id":
+			fmt.Println(ref.ID)
+		default:
+			return fmt.Errorf("unsupported form %s", uriCmdFlagTo)
+		}
+	}
+
+	return nil
+}
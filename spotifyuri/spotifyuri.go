@@ -0,0 +1,231 @@
+// Package spotifyuri parses the different forms in which Spotify items are
+// shared: URIs such as spotify:track:6rqhFgbbKwnb9MLmUQDhG6, open.spotify.com
+// URLs and bare base-62 IDs.
+package spotifyuri
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Type is the type of a Spotify item.
+type Type string
+
+const (
+	Track    Type = "track"
+	Album    Type = "album"
+	Artist   Type = "artist"
+	Playlist Type = "playlist"
+	Show     Type = "show"
+	Episode  Type = "episode"
+)
+
+// Types lists all the supported item types.
+var Types = []Type{Track, Album, Artist, Playlist, Show, Episode}
+
+const (
+	idLength = 22
+	webHost  = "open.spotify.com"
+)
+
+// Ref identifies a Spotify item.
+type Ref struct {
+	Type Type
+	ID   string
+	// User is the owner of a playlist referenced in the legacy user-scoped
+	// form, e.g. spotify:user:spotify:playlist:37i9dQZF1DXcBWIGoYBM5M.
+	User string
+}
+
+// URI returns the Spotify URI of the item.
+func (r Ref) URI() string {
+	if r.User != "" {
+		return fmt.Sprintf("spotify:user:%s:%s:%s", r.User, r.Type, r.ID)
+	}
+
+	return fmt.Sprintf("spotify:%s:%s", r.Type, r.ID)
+}
+
+// URL returns the open.spotify.com URL of the item.
+func (r Ref) URL() string {
+	if r.User != "" {
+		return fmt.Sprintf("https://%s/user/%s/%s/%s", webHost, url.PathEscape(r.User), r.Type, r.ID)
+	}
+
+	return fmt.Sprintf("https://%s/%s/%s", webHost, r.Type, r.ID)
+}
+
+// IsContext reports whether the item is a collection that can be played as
+// a playback context rather than as a single item.
+func (r Ref) IsContext() bool {
+	return r.Type != Track && r.Type != Episode
+}
+
+// ParseType parses an item type such as "track".
+func ParseType(s string) (Type, error) {
+	for _, t := range Types {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported Spotify item type %q", s)
+}
+
+// LooksLikeURI reports whether s is meant to be a Spotify URI or URL, as
+// opposed to free text. Use it to report malformed URIs and URLs instead of
+// treating them as text.
+func LooksLikeURI(s string) bool {
+	s = strings.TrimSpace(s)
+	return isURI(s) || isURL(s)
+}
+
+// isURI reports whether s starts with the spotify: scheme. Schemes are
+// case-insensitive.
+func isURI(s string) bool {
+	return strings.HasPrefix(strings.ToLower(s), "spotify:")
+}
+
+// isURL reports whether s starts with the host of a spotify.com URL,
+// optionally preceded by an http or https scheme. Schemes and host names
+// are case-insensitive.
+func isURL(s string) bool {
+	s = strings.ToLower(s)
+	for _, scheme := range []string{"https://", "http://"} {
+		if strings.HasPrefix(s, scheme) {
+			s = s[len(scheme):]
+			break
+		}
+	}
+
+	return strings.HasPrefix(s, webHost+"/") || strings.HasPrefix(s, "play.spotify.com/")
+}
+
+// IsID reports whether s is a well-formed base-62 Spotify ID.
+func IsID(s string) bool {
+	if len(s) != idLength {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Parse parses a Spotify URI or open.spotify.com URL. Query parameters such
+// as the ?si= tracking parameter of share links are ignored.
+func Parse(s string) (Ref, error) {
+	return ParseAs(s, "")
+}
+
+// ParseAs is like Parse but also accepts a bare ID, which is assumed to be
+// of type t. If t isn't empty, URIs and URLs must be of type t as well.
+func ParseAs(s string, t Type) (Ref, error) {
+	s = strings.TrimSpace(s)
+
+	var (
+		ref Ref
+		err error
+	)
+	switch {
+	case isURI(s):
+		ref, err = parseURI(s)
+	case isURL(s):
+		ref, err = parseURL(s)
+	case t != "":
+		ref = Ref{Type: t, ID: s}
+		err = validateID(s, ref.Type)
+	default:
+		err = fmt.Errorf("%q is not a Spotify URI or URL", s)
+	}
+	if err != nil {
+		return Ref{}, err
+	}
+
+	if t != "" && ref.Type != t {
+		return Ref{}, fmt.Errorf("%q is a %s, not a %s", s, ref.Type, t)
+	}
+
+	return ref, nil
+}
+
+func parseURI(s string) (Ref, error) {
+	parts := strings.Split(s, ":")[1:]
+	return parseSegments(s, parts)
+}
+
+func parseURL(s string) (Ref, error) {
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return Ref{}, fmt.Errorf("%q is not a valid URL: %s", s, err)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host != webHost && host != "play.spotify.com" {
+		return Ref{}, fmt.Errorf("%q is not an %s URL", s, webHost)
+	}
+
+	var parts []string
+	for _, p := range strings.Split(u.Path, "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+
+	// skip prefixes such as /embed and localized paths such as /intl-de
+	for len(parts) > 0 && (parts[0] == "embed" || strings.HasPrefix(parts[0], "intl-")) {
+		parts = parts[1:]
+	}
+
+	for i, p := range parts {
+		if parts[i], err = url.PathUnescape(p); err != nil {
+			return Ref{}, fmt.Errorf("%q is not a valid URL: %s", s, err)
+		}
+	}
+
+	return parseSegments(s, parts)
+}
+
+// parseSegments parses the path of a URI or URL, either type/id or
+// user/name/playlist/id.
+func parseSegments(s string, parts []string) (Ref, error) {
+	var ref Ref
+
+	if len(parts) == 4 && parts[0] == "user" {
+		if parts[2] != string(Playlist) {
+			return ref, fmt.Errorf("%q is not a playlist, only playlists can be scoped to a user", s)
+		}
+		ref.User = parts[1]
+		parts = parts[2:]
+	}
+
+	if len(parts) != 2 {
+		return ref, fmt.Errorf("%q is malformed, expected a type followed by an ID", s)
+	}
+
+	t, err := ParseType(parts[0])
+	if err != nil {
+		return ref, fmt.Errorf("%q: %s", s, err)
+	}
+	ref.Type = t
+	ref.ID = parts[1]
+
+	return ref, validateID(ref.ID, ref.Type)
+}
+
+func validateID(id string, t Type) error {
+	if !IsID(id) {
+		return fmt.Errorf("%q is not a valid %s ID, expected %d letters and digits", id, t, idLength)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package spotifyuri
+
+import (
+	"testing"
+)
+
+const (
+	trackID    = "6rqhFgbbKwnb9MLmUQDhG6"
+	playlistID = "37i9dQZF1DXcBWIGoYBM5M"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Ref
+		err  bool
+	}{
+		{in: "spotify:track:" + trackID, want: Ref{Type: Track, ID: trackID}},
+		{in: "  spotify:album:" + trackID + "\n", want: Ref{Type: Album, ID: trackID}},
+		{in: "spotify:artist:" + trackID, want: Ref{Type: Artist, ID: trackID}},
+		{in: "spotify:playlist:" + playlistID, want: Ref{Type: Playlist, ID: playlistID}},
+		{in: "spotify:show:" + trackID, want: Ref{Type: Show, ID: trackID}},
+		{in: "spotify:episode:" + trackID, want: Ref{Type: Episode, ID: trackID}},
+		{in: "spotify:user:spotify:playlist:" + playlistID, want: Ref{Type: Playlist, ID: playlistID, User: "spotify"}},
+		{in: "https://open.spotify.com/track/" + trackID, want: Ref{Type: Track, ID: trackID}},
+		{in: "https://open.spotify.com/track/" + trackID + "?si=a1b2c3d4e5f6", want: Ref{Type: Track, ID: trackID}},
+		{in: "https://open.spotify.com/track/" + trackID + "/", want: Ref{Type: Track, ID: trackID}},
+		{in: "http://open.spotify.com/album/" + trackID + "#top", want: Ref{Type: Album, ID: trackID}},
+		{in: "open.spotify.com/artist/" + trackID, want: Ref{Type: Artist, ID: trackID}},
+		{in: "https://OPEN.SPOTIFY.COM/track/" + trackID, want: Ref{Type: Track, ID: trackID}},
+		{in: "https://open.spotify.com/intl-de/track/" + trackID, want: Ref{Type: Track, ID: trackID}},
+		{in: "https://open.spotify.com/embed/playlist/" + playlistID, want: Ref{Type: Playlist, ID: playlistID}},
+		{in: "https://open.spotify.com/embed/intl-pt/episode/" + trackID, want: Ref{Type: Episode, ID: trackID}},
+		{in: "https://open.spotify.com/user/some%20one/playlist/" + playlistID, want: Ref{Type: Playlist, ID: playlistID, User: "some one"}},
+		{in: "https://play.spotify.com/show/" + trackID, want: Ref{Type: Show, ID: trackID}},
+		{in: "Spotify:track:" + trackID, want: Ref{Type: Track, ID: trackID}},
+		{in: "HTTPS://open.spotify.com/track/" + trackID, want: Ref{Type: Track, ID: trackID}},
+
+		{in: "", err: true},
+		{in: trackID, err: true},
+		{in: "spotify:", err: true},
+		{in: "spotify:track", err: true},
+		{in: "spotify:track:", err: true},
+		{in: "spotify:track:tooshort", err: true},
+		{in: "spotify:track:" + trackID + "x", err: true},
+		{in: "spotify:track:6rqhFgbbKwnb9MLmUQDh-6", err: true},
+		{in: "spotify:podcast:" + trackID, err: true},
+		{in: "spotify:track:" + trackID + ":extra", err: true},
+		{in: "spotify:user:spotify:album:" + trackID, err: true},
+		{in: "https://open.spotify.com/", err: true},
+		{in: "https://open.spotify.com/track", err: true},
+		{in: "https://open.spotify.com/genre/" + trackID, err: true},
+		{in: "https://evil.spotify.com/track/" + trackID, err: true},
+		{in: "https://open.spotify.com/track/%zz", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Parse(%q) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseAs(t *testing.T) {
+	tests := []struct {
+		in   string
+		t    Type
+		want Ref
+		err  bool
+	}{
+		{in: trackID, t: Track, want: Ref{Type: Track, ID: trackID}},
+		{in: " " + playlistID + " ", t: Playlist, want: Ref{Type: Playlist, ID: playlistID}},
+		{in: "spotify:album:" + trackID, t: Album, want: Ref{Type: Album, ID: trackID}},
+		{in: "https://open.spotify.com/album/" + trackID + "?si=x", t: Album, want: Ref{Type: Album, ID: trackID}},
+		{in: "spotify:album:" + trackID, t: "", want: Ref{Type: Album, ID: trackID}},
+
+		{in: trackID, t: "", err: true},
+		{in: "spotify:album:" + trackID, t: Track, err: true},
+		{in: "https://open.spotify.com/playlist/" + playlistID, t: Artist, err: true},
+		{in: "bohemian rhapsody", t: Track, err: true},
+		{in: "6rqhFgbbKwnb9MLmUQDhG", t: Track, err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAs(tt.in, tt.t)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseAs(%q, %q) = %+v, want an error", tt.in, tt.t, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAs(%q, %q) failed: %s", tt.in, tt.t, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAs(%q, %q) = %+v, want %+v", tt.in, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestRefURIAndURL(t *testing.T) {
+	tests := []struct {
+		ref     Ref
+		uri     string
+		url     string
+		context bool
+	}{
+		{Ref{Type: Track, ID: trackID}, "spotify:track:" + trackID, "https://open.spotify.com/track/" + trackID, false},
+		{Ref{Type: Episode, ID: trackID}, "spotify:episode:" + trackID, "https://open.spotify.com/episode/" + trackID, false},
+		{Ref{Type: Album, ID: trackID}, "spotify:album:" + trackID, "https://open.spotify.com/album/" + trackID, true},
+		{Ref{Type: Playlist, ID: playlistID, User: "some one"}, "spotify:user:some one:playlist:" + playlistID, "https://open.spotify.com/user/some%20one/playlist/" + playlistID, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.ref.URI(); got != tt.uri {
+			t.Errorf("%+v URI() = %s, want %s", tt.ref, got, tt.uri)
+		}
+		if got := tt.ref.URL(); got != tt.url {
+			t.Errorf("%+v URL() = %s, want %s", tt.ref, got, tt.url)
+		}
+		if got := tt.ref.IsContext(); got != tt.context {
+			t.Errorf("%+v IsContext() = %t, want %t", tt.ref, got, tt.context)
+		}
+
+		// URLs parse back to the same item
+		if got, err := Parse(tt.ref.URL()); err != nil || got != tt.ref {
+			t.Errorf("Parse(%s) = %+v, %v, want %+v", tt.ref.URL(), got, err, tt.ref)
+		}
+	}
+}
+
+func TestLooksLikeURI(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"spotify:track:" + trackID, true},
+		{"spotify:track:bad", true},
+		{" spotify:", true},
+		{"https://open.spotify.com/track/" + trackID, true},
+		{"open.spotify.com/nonsense", true},
+		{trackID, false},
+		{"bohemian rhapsody", false},
+		{"spotify", false},
+		{"the spotify song", false},
+		{"SPOTIFY:track:" + trackID, true},
+		{"HTTP://Open.Spotify.com/track/" + trackID, true},
+		{"play.spotify.com/show/" + trackID, true},
+		{"podcast about spotify.com/" + trackID, false},
+		{"songs from open.spotify.com/", false},
+		{"https://evil.spotify.com/track/" + trackID, false},
+		{"https://example.com/open.spotify.com/track/" + trackID, false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := LooksLikeURI(tt.in); got != tt.want {
+			t.Errorf("LooksLikeURI(%q) = %t, want %t", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsID(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{trackID, true},
+		{"0000000000000000000000", true},
+		{"zzzzzzzzzzzzzzzzzzzzzz", true},
+		{"", false},
+		{"6rqhFgbbKwnb9MLmUQDhG", false},
+		{"6rqhFgbbKwnb9MLmUQDhG66", false},
+		{"6rqhFgbbKwnb9MLmUQDh_6", false},
+		{"6rqhFgbbKwnb9MLmUQDh 6", false},
+		{"6rqhFgbbKwnb9MLmUQDhé", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsID(tt.in); got != tt.want {
+			t.Errorf("IsID(%q) = %t, want %t", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	for _, want := range Types {
+		if got, err := ParseType(string(want)); err != nil || got != want {
+			t.Errorf("ParseType(%q) = %q, %v", want, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "auto", "Track", "tracks"} {
+		if got, err := ParseType(s); err == nil {
+			t.Errorf("ParseType(%q) = %q, want an error", s, got)
+		}
+	}
+}